@@ -1,44 +1,65 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/sol1corejz/enricher/internal/app"
 	"github.com/sol1corejz/enricher/internal/config"
 	"log/slog"
 	"os"
-)
-
-const (
-	envLocal = "local"
-	envDev   = "dev"
-	envProd  = "prod"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	cfg := config.MustLoad()
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-	log := setupLogger(cfg.Env)
+	log := setupLogger(cfg.Log)
 
 	log.Info("starting application", slog.String("env", cfg.Env))
 
-	application := app.New(log)
+	application := app.New(log, cfg)
 
-	err := application.FiberSrv.Listen(cfg.Port)
-	if err != nil {
-		log.Error("failed to run server: ", err.Error())
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	exitCode := 0
+
+	if err := application.Run(ctx); err != nil {
+		log.Error("failed to run server", slog.String("error", err.Error()))
+		exitCode = 1
+	}
+
+	// Повторный сигнал во время остановки завершает процесс сразу
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := application.Stop(shutdownCtx); err != nil {
+		log.Error("failed to stop application", slog.String("error", err.Error()))
+		exitCode = 1
+	}
+
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
 }
 
-func setupLogger(env string) *slog.Logger {
-	var log *slog.Logger
+// setupLogger создает логгер по уровню и формату из конфига (оба уже проверены при загрузке)
+func setupLogger(cfg config.Log) *slog.Logger {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(cfg.Level))
+
+	opts := &slog.HandlerOptions{Level: level}
 
-	switch env {
-	case envLocal:
-		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	case envDev:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	case envProd:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	if cfg.Format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stdout, opts))
 	}
 
-	return log
+	return slog.New(slog.NewTextHandler(os.Stdout, opts))
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/services/enricher"
+	"strings"
+	"time"
+)
+
+// runEnrich показывает результат обогащения имени, ничего не сохраняя
+func runEnrich(ctx context.Context, service *enricher.Enricher, args []string) error {
+	if len(args) == 0 {
+		return errors.New("enrich: name is required")
+	}
+
+	user, err := service.Enrich(ctx, models.SaveUserPayload{Name: strings.Join(args, " ")})
+	if err != nil {
+		return err
+	}
+
+	return printJSON(models.Enrichment{
+		Age:     user.Age,
+		Sex:     user.Sex,
+		Country: user.Country,
+	})
+}
+
+func runReEnrich(ctx context.Context, service *enricher.Enricher, args []string) error {
+	fs := flag.NewFlagSet("reenrich", flag.ContinueOnError)
+
+	var staleSince string
+	var limit int
+	var dryRun bool
+
+	fs.StringVar(&staleSince, "stale-since", "", "RFC 3339 time (2026-01-02T15:04:05Z) or age like 720h: re-enrich users enriched before it")
+	fs.IntVar(&limit, "limit", 0, "maximum number of users to check, 0 - all")
+	fs.BoolVar(&dryRun, "dry-run", false, "query enrichment sources without saving")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	since, err := parseStaleSince(staleSince)
+	if err != nil {
+		return err
+	}
+
+	result, err := service.ReEnrich(ctx, since, limit, dryRun)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(result)
+}
+
+// parseStaleSince принимает момент времени в RFC 3339 или давность (720h = старше 30 дней)
+func parseStaleSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("reenrich: -stale-since is required")
+	}
+
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return time.Time{}, fmt.Errorf("reenrich: invalid -stale-since %q, expected RFC 3339 time or positive duration", value)
+	}
+
+	return time.Now().Add(-age), nil
+}
+
+func runPurge(ctx context.Context, service *enricher.Enricher, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+
+	var olderThan time.Duration
+	fs.DurationVar(&olderThan, "older-than", 0, "retention, e.g. 720h: users deleted earlier are removed permanently")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if olderThan <= 0 {
+		return errors.New("purge: positive -older-than is required")
+	}
+
+	purged, err := service.PurgeDeletedUsers(ctx, olderThan)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d users purged\n", purged)
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/importfile"
+	"github.com/sol1corejz/enricher/internal/lib/validate"
+	"github.com/sol1corejz/enricher/internal/services/enricher"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runImport(ctx context.Context, service *enricher.Enricher, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New("import: file is required")
+	}
+	path := args[0]
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+
+	mapping := importfile.DefaultMapping()
+	var formatValue string
+
+	fs.StringVar(&formatValue, "format", "", "csv or ndjson (default: from file extension)")
+	fs.StringVar(&mapping.Name, "name-column", mapping.Name, "column/key holding the name")
+	fs.StringVar(&mapping.Surname, "surname-column", mapping.Surname, "column/key holding the surname")
+	fs.StringVar(&mapping.Patronymic, "patronymic-column", mapping.Patronymic, "column/key holding the patronymic")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if formatValue == "" {
+		formatValue = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	format, err := importfile.ParseFormat(formatValue)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, rejected, err := importfile.Parse(file, format, mapping)
+	if err != nil {
+		return err
+	}
+
+	valid := make([]models.ImportRow, 0, len(rows))
+	for _, row := range rows {
+		if err := validate.Names(row.Payload.Name, row.Payload.Surname, row.Payload.Patronymic); err != nil {
+			rejected = append(rejected, models.ImportRowError{Row: row.Row, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, row)
+	}
+
+	fmt.Fprintf(os.Stderr, "importing %d rows (%d rejected)...\n", len(valid), len(rejected))
+
+	imp, err := service.RunImport(ctx, string(format), valid, rejected)
+	if err != nil {
+		return err
+	}
+
+	// Полный отчет, включая ошибки строк, хранится в задаче
+	report, err := service.GetImport(ctx, imp.ID)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(report)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/services/auth"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func runKeys(ctx context.Context, service *auth.Auth, args []string) error {
+	if len(args) == 0 {
+		return errors.New("keys: expected subcommand create, list or revoke")
+	}
+
+	switch args[0] {
+	case "create":
+		return keysCreate(ctx, service, args[1:])
+	case "list":
+		return keysList(ctx, service, args[1:])
+	case "revoke":
+		return keysRevoke(ctx, service, args[1:])
+	default:
+		return fmt.Errorf("keys: unknown subcommand %q", args[0])
+	}
+}
+
+func keysCreate(ctx context.Context, service *auth.Auth, args []string) error {
+	fs := flag.NewFlagSet("keys create", flag.ContinueOnError)
+
+	var name, role string
+	fs.StringVar(&name, "name", "", "key name, unique among active keys; recorded as the actor in the audit log")
+	fs.StringVar(&role, "role", string(models.RoleReader), "reader (read-only), editor (also add, edit, import) or admin (also delete, restore)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if name == "" {
+		return errors.New("keys create: -name is required")
+	}
+
+	key, created, err := service.CreateAPIKey(ctx, name, models.Role(role))
+	if err != nil {
+		return err
+	}
+
+	// Ключ печатается в stdout отдельной строкой, чтобы его было удобно забрать в скрипте
+	fmt.Fprintf(os.Stderr, "created %s api key %d %q, it is shown only once:\n", created.Role, created.ID, created.Name)
+	fmt.Println(key)
+
+	return nil
+}
+
+func keysList(ctx context.Context, service *auth.Auth, args []string) error {
+	fs := flag.NewFlagSet("keys list", flag.ContinueOnError)
+
+	var asJSON bool
+	fs.BoolVar(&asJSON, "json", false, "print JSON instead of a table")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keys, err := service.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(keys)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tROLE\tCREATED AT\tLAST USED AT\tREVOKED AT")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			key.ID, key.Name, key.Prefix, key.Role, key.CreatedAt.Format("2006-01-02 15:04"),
+			formatOptionalTime(key.LastUsedAt), formatOptionalTime(key.RevokedAt),
+		)
+	}
+
+	return w.Flush()
+}
+
+func keysRevoke(ctx context.Context, service *auth.Auth, args []string) error {
+	if len(args) == 0 {
+		return errors.New("keys revoke: key id is required")
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id <= 0 {
+		return fmt.Errorf("invalid key id %q", args[0])
+	}
+
+	if err := service.RevokeAPIKey(ctx, id); err != nil {
+		return err
+	}
+
+	fmt.Printf("api key %d revoked\n", id)
+
+	return nil
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.Format("2006-01-02 15:04")
+}
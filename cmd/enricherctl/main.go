@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/clients/nameapi"
+	"github.com/sol1corejz/enricher/internal/config"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"github.com/sol1corejz/enricher/internal/services/auth"
+	"github.com/sol1corejz/enricher/internal/services/enricher"
+	"github.com/sol1corejz/enricher/internal/storage/postgres"
+	"github.com/sol1corejz/enricher/internal/storage/sqlite"
+	"log/slog"
+	"os"
+	"os/signal"
+	"os/user"
+	"syscall"
+)
+
+const usage = `enricherctl - administration of enriched users directly against the database
+
+Usage:
+  enricherctl [-v] <command> [arguments]
+
+Commands:
+  users list [filters]                 list users (see "enricherctl users list -h")
+  users get <id> [-as-of T]            show a user, optionally as it was at time T
+  users add -name N -surname S [-patronymic P]
+                                       enrich and save a user
+  users edit <id> [-name N] [-surname S] [-patronymic P]
+                                       update name fields of a user
+  users delete <id>                    soft-delete a user
+  users restore <id>                   restore a soft-deleted user
+  users history <id>                   show the audit log of a user
+  enrich <name>                        show enrichment for a name without saving anything
+  reenrich -stale-since <time|duration> [-limit N] [-dry-run]
+                                       re-enrich users enriched before the given time
+  purge -older-than <duration>         permanently remove users soft-deleted before now minus duration
+  import <file> [-format csv|ndjson] [-name-column C] [-surname-column C] [-patronymic-column C]
+                                       import users from a file and wait for completion
+  keys create -name N [-role R]        issue an API key for the service (printed once),
+                                       role reader (default), editor or admin
+  keys list [-json]                    list API keys, including revoked ones
+  keys revoke <id>                     revoke an API key
+
+The database is taken from DB_URL (.env), or from SQLITE_PATH when STORAGE=sqlite, same as the service.
+`
+
+func main() {
+	args := os.Args[1:]
+
+	verbose := false
+	if len(args) > 0 && args[0] == "-v" {
+		verbose = true
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Изменения из CLI попадают в журнал аудита от имени пользователя ОС
+	ctx = reqctx.WithActor(ctx, cliActor())
+
+	service, authService, closeStorage := newService(ctx, verbose)
+	defer closeStorage()
+
+	if err := run(ctx, service, authService, args); err != nil {
+		closeStorage()
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, service *enricher.Enricher, authService *auth.Auth, args []string) error {
+	switch args[0] {
+	case "users":
+		return runUsers(ctx, service, args[1:])
+	case "enrich":
+		return runEnrich(ctx, service, args[1:])
+	case "reenrich":
+		return runReEnrich(ctx, service, args[1:])
+	case "import":
+		return runImport(ctx, service, args[1:])
+	case "purge":
+		return runPurge(ctx, service, args[1:])
+	case "keys":
+		return runKeys(ctx, authService, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, see enricherctl help", args[0])
+	}
+}
+
+// newService собирает тот же сервис и на том же хранилище (STORAGE), что и HTTP-приложение,
+// и сервис аутентификации для управления ключами API. Логи сервисов по умолчанию скрыты,
+// чтобы не смешиваться с выводом команд
+func newService(ctx context.Context, verbose bool) (*enricher.Enricher, *auth.Auth, func()) {
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelDebug
+	}
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	var provider enricher.Provider
+	var closeStorage func()
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	switch cfg.Storage {
+	case config.StorageSQLite:
+		storage, err := sqlite.New(ctx, sqlite.Config{Path: cfg.Database.SQLitePath})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		provider, closeStorage = storage, func() { storage.Close() }
+	case config.StorageMemory:
+		fmt.Fprintln(os.Stderr, "error: STORAGE=memory is not shared with the service, nothing to administer")
+		os.Exit(1)
+	default:
+		storage, err := postgres.New(ctx, postgres.Config{URL: cfg.Database.URL})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		provider, closeStorage = storage, storage.Close
+	}
+
+	client := nameapi.New(nameapi.Config{
+		AgifyURL:       cfg.Enrichment.AgifyURL,
+		GenderizeURL:   cfg.Enrichment.GenderizeURL,
+		NationalizeURL: cfg.Enrichment.NationalizeURL,
+		Timeout:        cfg.Enrichment.Timeout,
+		CacheTTL:       cfg.Cache.TTL,
+		CacheMax:       cfg.Cache.MaxEntries,
+	})
+
+	// JWT проверяет только HTTP-сервис, здесь нужны лишь ключи API
+	keys, _ := provider.(auth.KeyStore)
+	authService, err := auth.New(log, keys, auth.Config{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	return enricher.New(log, provider, client), authService, closeStorage
+}
+
+func cliActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+
+	return "cli"
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/filterexpr"
+	"github.com/sol1corejz/enricher/internal/lib/validate"
+	"github.com/sol1corejz/enricher/internal/services/enricher"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func runUsers(ctx context.Context, service *enricher.Enricher, args []string) error {
+	if len(args) == 0 {
+		return errors.New("users: expected subcommand list, get, add, edit, delete, restore or history")
+	}
+
+	switch args[0] {
+	case "list":
+		return usersList(ctx, service, args[1:])
+	case "get":
+		return usersGet(ctx, service, args[1:])
+	case "add":
+		return usersAdd(ctx, service, args[1:])
+	case "edit":
+		return usersEdit(ctx, service, args[1:])
+	case "delete":
+		return usersDelete(ctx, service, args[1:])
+	case "restore":
+		return usersRestore(ctx, service, args[1:])
+	case "history":
+		return usersHistory(ctx, service, args[1:])
+	default:
+		return fmt.Errorf("users: unknown subcommand %q", args[0])
+	}
+}
+
+func usersList(ctx context.Context, service *enricher.Enricher, args []string) error {
+	fs := flag.NewFlagSet("users list", flag.ContinueOnError)
+
+	var filter models.UserFilter
+	var expression, asOf string
+	var asJSON bool
+
+	fs.StringVar(&filter.Search, "q", "", "full-name search with prefix matching")
+	fs.StringVar(&filter.Name, "name", "", "name (partial match)")
+	fs.StringVar(&filter.Surname, "surname", "", "surname (partial match)")
+	fs.StringVar(&filter.Patronymic, "patronymic", "", "patronymic (partial match)")
+	fs.IntVar(&filter.AgeFrom, "age-from", 0, "minimum age")
+	fs.IntVar(&filter.AgeTo, "age-to", 0, "maximum age")
+	fs.StringVar(&filter.Sex, "sex", "", "male or female")
+	fs.StringVar(&filter.Country, "country", "", "country code (partial match)")
+	fs.StringVar(&expression, "filter", "", "boolean filter expression, e.g. \"age gt 30 and sex eq 'female'\"")
+	fs.IntVar(&filter.Limit, "limit", 50, "maximum number of users, 0 - all")
+	fs.IntVar(&filter.Offset, "offset", 0, "number of users to skip")
+	fs.BoolVar(&filter.IncludeDeleted, "include-deleted", false, "include soft-deleted users")
+	fs.StringVar(&asOf, "as-of", "", "RFC 3339 time: list users as they were at that moment")
+	fs.BoolVar(&asJSON, "json", false, "print users as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			return fmt.Errorf("invalid -as-of %q, expected RFC 3339 time", asOf)
+		}
+		filter.AsOf = t
+	}
+
+	if expression != "" {
+		node, err := filterexpr.Parse(expression, models.UserFilterFields)
+		if err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
+		filter.Expression = node
+	}
+
+	users, err := service.GetUsers(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(users)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSURNAME\tPATRONYMIC\tAGE\tSEX\tCOUNTRY\tENRICHED AT")
+	for _, user := range users {
+		country := ""
+		if user.PrimaryCountry != nil {
+			country = user.PrimaryCountry.CountryID
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			user.ID, user.Name, user.Surname, user.Patronymic, user.Age, user.Sex, country,
+			user.EnrichedAt.Format("2006-01-02 15:04"),
+		)
+	}
+
+	return w.Flush()
+}
+
+func usersGet(ctx context.Context, service *enricher.Enricher, args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("users get", flag.ContinueOnError)
+
+	var asOf string
+	fs.StringVar(&asOf, "as-of", "", "RFC 3339 time: show the user as it was at that moment")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var user models.EnrichedUser
+	if asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			return fmt.Errorf("invalid -as-of %q, expected RFC 3339 time", asOf)
+		}
+
+		user, err = service.GetUserAsOf(ctx, id, t)
+		if err != nil {
+			return err
+		}
+	} else {
+		user, err = service.GetUser(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return printJSON(user)
+}
+
+func usersAdd(ctx context.Context, service *enricher.Enricher, args []string) error {
+	fs := flag.NewFlagSet("users add", flag.ContinueOnError)
+
+	var payload models.SaveUserPayload
+	fs.StringVar(&payload.Name, "name", "", "name (required)")
+	fs.StringVar(&payload.Surname, "surname", "", "surname (required)")
+	fs.StringVar(&payload.Patronymic, "patronymic", "", "patronymic")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := validate.Names(payload.Name, payload.Surname, payload.Patronymic); err != nil {
+		return err
+	}
+
+	user, err := service.Enrich(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	id, err := service.SaveUser(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	created, err := service.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(created)
+}
+
+func usersEdit(ctx context.Context, service *enricher.Enricher, args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("users edit", flag.ContinueOnError)
+
+	var payload models.EditUserPayload
+	fs.StringVar(&payload.Name, "name", "", "new name")
+	fs.StringVar(&payload.Surname, "surname", "", "new surname")
+	fs.StringVar(&payload.Patronymic, "patronymic", "", "new patronymic")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	updated, err := service.UpdateUser(ctx, id, func(user *models.EnrichedUser) error {
+		// Обновляем только переданные поля, как и POST /edit
+		if payload.Name != "" {
+			user.Name = payload.Name
+		}
+		if payload.Surname != "" {
+			user.Surname = payload.Surname
+		}
+		if payload.Patronymic != "" {
+			user.Patronymic = payload.Patronymic
+		}
+
+		return validate.Names(user.Name, user.Surname, user.Patronymic)
+	})
+	if err != nil {
+		return err
+	}
+
+	return printJSON(updated)
+}
+
+func usersDelete(ctx context.Context, service *enricher.Enricher, args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+
+	if err := service.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+
+	fmt.Printf("user %d deleted\n", id)
+
+	return nil
+}
+
+func usersRestore(ctx context.Context, service *enricher.Enricher, args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+
+	user, err := service.RestoreUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(user)
+}
+
+func usersHistory(ctx context.Context, service *enricher.Enricher, args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+
+	history, err := service.GetUserHistory(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(history)
+}
+
+func parseID(args []string) (int64, error) {
+	if len(args) == 0 {
+		return 0, errors.New("user id is required")
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid user id %q", args[0])
+	}
+
+	return id, nil
+}
@@ -1,41 +1,163 @@
 package main
 
 import (
-	"errors"
 	"fmt"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/sol1corejz/enricher/internal/storage/postgres"
+	"github.com/sol1corejz/enricher/internal/config"
+	"github.com/sol1corejz/enricher/internal/migrator"
+	"github.com/sol1corejz/enricher/internal/storage/sqlite"
 	"log"
+	"os"
+	"strconv"
 )
 
+const usage = `migrator - applies migrations embedded into the binary
+
+Usage:
+  migrator [command]
+
+Commands:
+  up            apply all pending migrations (default)
+  down [-all]   roll back the last migration, or every migration with -all
+  steps <n>     apply n migrations, or roll back -n migrations when n is negative
+  goto <v>      migrate up or down to version v
+  version       print the current and the latest embedded version
+  force <v>     set version v without running migrations (clears the dirty flag), -1 - no version
+
+The database is taken from DB_URL, or from SQLITE_PATH when STORAGE=sqlite
+(environment, .env or the YAML file in CONFIG_PATH).
+`
+
 func main() {
+	args := os.Args[1:]
 
-	dbURL := postgres.GetDatabaseURL()
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
 
-	fmt.Println(dbURL)
+	if command == "help" || command == "-h" || command == "--help" {
+		fmt.Print(usage)
+		return
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Создаем экземпляр мигратора
-	m, err := migrate.New(
-		"file://migrations",
-		dbURL,
-	)
+	m, err := migrator.New(databaseURL(cfg))
 	if err != nil {
 		log.Fatalf("Failed to create migrate instance: %v", err)
 	}
 	defer m.Close()
 
-	// Применяем миграции
-	if err := m.Up(); err != nil {
-		if errors.Is(err, migrate.ErrNoChange) {
-			fmt.Println("Nothing to migrate")
+	if err := run(m, command, args); err != nil {
+		m.Close()
+		log.Fatal(err)
+	}
+}
+
+// databaseURL возвращает адрес базы выбранного хранилища
+func databaseURL(cfg *config.Config) string {
+	switch cfg.Storage {
+	case config.StorageSQLite:
+		return sqlite.DatabaseURL(cfg.Database.SQLitePath)
+	case config.StorageMemory:
+		log.Fatal("STORAGE=memory has no database to migrate")
+	}
+
+	return cfg.Database.URL
+}
+
+func run(m *migrator.Migrator, command string, args []string) error {
+	switch command {
+	case "up":
+		if err := m.Up(); err != nil {
+			return err
+		}
+	case "down":
+		all := len(args) > 0 && args[0] == "-all"
+		if len(args) > 0 && !all {
+			return fmt.Errorf("down: unexpected argument %q", args[0])
+		}
+
+		if all {
+			if err := m.Down(); err != nil {
+				return err
+			}
+		} else if err := m.Steps(-1); err != nil {
+			return err
+		}
+	case "steps":
+		n, err := intArg(command, args)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("steps: n must not be 0")
+		}
+
+		if err := m.Steps(n); err != nil {
+			return err
+		}
+	case "goto":
+		v, err := intArg(command, args)
+		if err != nil {
+			return err
+		}
+		if v < 0 {
+			return fmt.Errorf("goto: version must not be negative")
+		}
 
-			return
+		if err := m.Goto(uint(v)); err != nil {
+			return err
+		}
+	case "force":
+		v, err := intArg(command, args)
+		if err != nil {
+			return err
+		}
+		if v < -1 {
+			return fmt.Errorf("force: version must be -1 or greater")
 		}
 
-		panic(err)
+		if err := m.Force(v); err != nil {
+			return err
+		}
+	case "version":
+	default:
+		return fmt.Errorf("unknown command %q, see migrator help", command)
+	}
+
+	return printVersion(m)
+}
+
+func printVersion(m *migrator.Migrator) error {
+	version, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	state := ""
+	if dirty {
+		state = " (dirty)"
+	}
+
+	fmt.Printf("version %d%s, latest embedded %d\n", version, state, m.Latest())
+
+	return nil
+}
+
+func intArg(command string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%s: exactly one numeric argument expected", command)
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid number %q", command, args[0])
 	}
 
-	fmt.Println("Migrations applied successfully")
+	return n, nil
 }
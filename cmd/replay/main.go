@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/journal"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type headers []string
+
+func (h *headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headers) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header must look like 'Name: value', got %q", value)
+	}
+	*h = append(*h, value)
+
+	return nil
+}
+
+// Воспроизводит журнал изменяющих запросов (JOURNAL_PATH) на указанном инстансе:
+//
+//	go run ./cmd/replay -journal journal.jsonl -target http://localhost:8080
+//
+// ID созданных при воспроизведении пользователей отличаются от записанных, поэтому
+// ответы с "id" запоминаются, и последующие ссылки на старые ID (поле "id" в теле,
+// сегмент /users/{id} в пути) подменяются на новые
+func main() {
+	var (
+		journalPath string
+		target      string
+		dryRun      bool
+		strict      bool
+		delay       time.Duration
+		extra       headers
+	)
+
+	flag.StringVar(&journalPath, "journal", "", "path to the request journal (JSONL)")
+	flag.StringVar(&target, "target", "http://localhost:8080", "base URL of the instance to replay against")
+	flag.BoolVar(&dryRun, "dry-run", false, "print requests without sending them")
+	flag.BoolVar(&strict, "strict", false, "stop at the first status mismatch")
+	flag.DurationVar(&delay, "delay", 0, "pause between requests")
+	flag.Var(&extra, "header", "extra request header 'Name: value' (repeatable), e.g. for authorization")
+	flag.Parse()
+
+	if journalPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(journalPath)
+	if err != nil {
+		log.Fatalf("Failed to open journal: %v", err)
+	}
+	defer file.Close()
+
+	// Читаем журнал только до его текущего конца: если целевой инстанс пишет в этот же
+	// файл, воспроизведенные запросы не должны попасть в воспроизведение повторно
+	info, err := file.Stat()
+	if err != nil {
+		log.Fatalf("Failed to stat journal: %v", err)
+	}
+
+	r := &replayer{
+		client:  &http.Client{Timeout: time.Minute},
+		target:  strings.TrimRight(target, "/"),
+		headers: extra,
+		ids:     map[int64]int64{},
+	}
+
+	replayed, mismatches := 0, 0
+
+	err = journal.Read(io.LimitReader(file, info.Size()), func(line int, entry journal.Entry) error {
+		if replayed > 0 && delay > 0 {
+			time.Sleep(delay)
+		}
+		replayed++
+
+		if dryRun {
+			fmt.Printf("#%d %s %s (recorded %d)\n", line, entry.Method, r.url(entry), entry.Status)
+			return nil
+		}
+
+		status, err := r.replay(entry)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		mark := "ok"
+		if status != entry.Status {
+			mark = "MISMATCH"
+			mismatches++
+		}
+		fmt.Printf("#%d %s %s -> %d (recorded %d) %s\n", line, entry.Method, r.url(entry), status, entry.Status, mark)
+
+		if strict && status != entry.Status {
+			return fmt.Errorf("line %d: status mismatch", line)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Replay failed: %v", err)
+	}
+
+	fmt.Printf("Replayed %d requests, %d status mismatches\n", replayed, mismatches)
+
+	if mismatches > 0 {
+		os.Exit(1)
+	}
+}
+
+var userPathID = regexp.MustCompile(`^(/users/)(\d+)(/|$)`)
+
+type replayer struct {
+	client  *http.Client
+	target  string
+	headers headers
+	// записанный ID -> ID на целевом инстансе
+	ids map[int64]int64
+}
+
+func (r *replayer) url(entry journal.Entry) string {
+	path := userPathID.ReplaceAllStringFunc(entry.Path, func(match string) string {
+		parts := userPathID.FindStringSubmatch(match)
+		id, _ := strconv.ParseInt(parts[2], 10, 64)
+
+		return parts[1] + strconv.FormatInt(r.mapID(id), 10) + parts[3]
+	})
+
+	url := r.target + path
+	if entry.Query != "" {
+		url += "?" + entry.Query
+	}
+
+	return url
+}
+
+func (r *replayer) replay(entry journal.Entry) (int, error) {
+	req, err := http.NewRequest(entry.Method, r.url(entry), bytes.NewReader(r.body(entry)))
+	if err != nil {
+		return 0, err
+	}
+
+	if entry.ContentType != "" {
+		req.Header.Set("Content-Type", entry.ContentType)
+	}
+	for _, header := range r.headers {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	// ID в ответах других запросов (например, задач импорта) к пользователям не относятся
+	if entry.Path == "/add" {
+		r.rememberID(entry.Response, respBody)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// body подменяет поле "id" JSON-тела на ID, полученный при воспроизведении
+func (r *replayer) body(entry journal.Entry) []byte {
+	if len(entry.Body) == 0 {
+		return entry.RequestBody()
+	}
+
+	var object map[string]any
+	if err := json.Unmarshal(entry.Body, &object); err != nil {
+		return entry.Body
+	}
+
+	id, ok := object["id"].(float64)
+	if !ok {
+		return entry.Body
+	}
+
+	object["id"] = r.mapID(int64(id))
+
+	body, err := json.Marshal(object)
+	if err != nil {
+		return entry.Body
+	}
+
+	return body
+}
+
+// rememberID сопоставляет "id" записанного ответа с "id" ответа целевого инстанса
+func (r *replayer) rememberID(recorded []byte, actual []byte) {
+	recordedID, ok := responseID(recorded)
+	if !ok {
+		return
+	}
+
+	actualID, ok := responseID(actual)
+	if !ok {
+		return
+	}
+
+	r.ids[recordedID] = actualID
+}
+
+func (r *replayer) mapID(id int64) int64 {
+	if mapped, ok := r.ids[id]; ok {
+		return mapped
+	}
+
+	return id
+}
+
+func responseID(body []byte) (int64, bool) {
+	var response struct {
+		ID *int64 `json:"id"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.ID == nil {
+		return 0, false
+	}
+
+	return *response.ID, true
+}
@@ -1,17 +1,48 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/swagger"
 	_ "github.com/sol1corejz/enricher/docs"
+	"github.com/sol1corejz/enricher/internal/clients/nameapi"
+	"github.com/sol1corejz/enricher/internal/config"
+	"github.com/sol1corejz/enricher/internal/domain/models"
 	"github.com/sol1corejz/enricher/internal/handlers"
+	"github.com/sol1corejz/enricher/internal/journal"
+	"github.com/sol1corejz/enricher/internal/metrics"
+	"github.com/sol1corejz/enricher/internal/migrator"
+	"github.com/sol1corejz/enricher/internal/ratelimit"
+	"github.com/sol1corejz/enricher/internal/requestlog"
+	"github.com/sol1corejz/enricher/internal/services/auth"
 	"github.com/sol1corejz/enricher/internal/services/enricher"
+	"github.com/sol1corejz/enricher/internal/services/health"
+	"github.com/sol1corejz/enricher/internal/services/quota"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"github.com/sol1corejz/enricher/internal/storage/instrumented"
+	"github.com/sol1corejz/enricher/internal/storage/memory"
 	"github.com/sol1corejz/enricher/internal/storage/postgres"
+	"github.com/sol1corejz/enricher/internal/storage/sqlite"
+	"github.com/sol1corejz/enricher/internal/tracing"
 	"log/slog"
+	"sync"
 )
 
 type App struct {
 	FiberSrv *fiber.App
+
+	log      *slog.Logger
+	cfg      *config.Config
+	enricher *enricher.Enricher
+
+	// closers освобождают ресурсы (трассировка, хранилище, журнал) в обратном порядке после остановки сервера
+	closers []func(ctx context.Context) error
+
+	// Фоновые задачи приложения (очистка удаленных), отменяются в Stop
+	cancelJobs context.CancelFunc
+	jobs       sync.WaitGroup
 }
 
 // @title User Enricher API
@@ -19,34 +50,378 @@ type App struct {
 // @description API for managing and enriching user data
 // @host localhost:8080
 // @BasePath /
-func New(log *slog.Logger) *App {
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description API key or JWT as "Bearer <token>"
+func New(log *slog.Logger, cfg *config.Config) *App {
 
-	storage, err := postgres.New()
-	log.Info("connected to database")
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
 		panic(err)
 	}
+	if cfg.Tracing.Exporter != config.TracingNone {
+		log.Info("tracing enabled",
+			slog.String("exporter", cfg.Tracing.Exporter),
+			slog.Float64("sample_ratio", cfg.Tracing.SampleRatio),
+		)
+	}
+
+	provider, opPrefix, closeStorage := mustStorage(log, cfg)
+
+	appMetrics := metrics.New()
+
+	a := &App{
+		log: log,
+		cfg: cfg,
+		closers: []func(ctx context.Context) error{
+			shutdownTracing,
+			func(context.Context) error { return closeStorage() },
+		},
+	}
+
+	nameClient := nameapi.New(nameapi.Config{
+		AgifyURL:       cfg.Enrichment.AgifyURL,
+		GenderizeURL:   cfg.Enrichment.GenderizeURL,
+		NationalizeURL: cfg.Enrichment.NationalizeURL,
+		Timeout:        cfg.Enrichment.Timeout,
+		CacheTTL:       cfg.Cache.TTL,
+		CacheMax:       cfg.Cache.MaxEntries,
+		Observer:       appMetrics,
+	})
+
+	enricherService := enricher.New(log, instrumented.New(provider, opPrefix, appMetrics), nameClient)
+	a.enricher = enricherService
+
+	appMetrics.RegisterCache(nameClient.CacheStats)
+	appMetrics.RegisterImportQueue(enricherService.ImportQueue)
+	if pg, ok := provider.(*postgres.Storage); ok {
+		appMetrics.RegisterDBPool(pg.Stats)
+	}
+
+	// Проверкам нужны Ping и SchemaVersion самого хранилища, поэтому без обертки
+	healthService := newHealth(log, cfg, provider, nameClient)
 
-	enricherService := enricher.New(log, storage)
+	authService := mustAuth(log, cfg, provider, opPrefix, appMetrics)
+	quotaService := mustQuota(log, cfg, provider, opPrefix, appMetrics)
 
-	fiberApp := fiber.New()
+	fiberApp := fiber.New(fiber.Config{
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
+	})
+	fiberApp.Use(tracing.Middleware())
+	fiberApp.Use(appMetrics.Middleware())
+	// Идентификатор запроса попадает в логи, журнал и аудит
+	fiberApp.Use(requestlog.Middleware(log))
 	fiberApp.Use(func(c *fiber.Ctx) error {
 		c.Locals("enricherService", enricherService)
+		c.Locals("healthService", healthService)
+		c.Locals("authService", authService)
+		c.Locals("quotaService", quotaService)
+
 		return c.Next()
 	})
 
+	if cfg.JournalPath != "" {
+		journalWriter, err := journal.Open(cfg.JournalPath)
+		if err != nil {
+			panic(err)
+		}
+		log.Info("writing request journal", slog.String("path", cfg.JournalPath))
+		a.closers = append(a.closers, func(context.Context) error { return journalWriter.Close() })
+
+		fiberApp.Use(journal.Middleware(log, journalWriter))
+	}
+
 	// Swagger UI
 	fiberApp.Get("/swagger/*", swagger.New(swagger.Config{
 		URL:         "/swagger/doc.json",
 		DeepLinking: false,
 	}))
 
-	fiberApp.Get("/", handlers.DataWithFilters)
-	fiberApp.Post("/add", handlers.Add)
-	fiberApp.Post("/delete", handlers.Delete)
-	fiberApp.Post("/edit", handlers.Edit)
+	fiberApp.Get("/healthz", handlers.Healthz)
+	fiberApp.Get("/readyz", handlers.Readyz)
+	fiberApp.Get("/metrics", appMetrics.Handler())
+
+	// Маршруты выше открыты всегда, ниже - только с ключом API или JWT
+	if cfg.Auth.Enabled {
+		fiberApp.Use(handlers.Authenticate)
+	}
+
+	// Роли по группам операций: чтение - reader, добавление и изменение (в том числе импорт,
+	// расходующий квоту API обогащения) - editor, удаление и восстановление - admin
+	read := handlers.RequireRole(models.RoleReader)
+	write := handlers.RequireRole(models.RoleEditor)
+	admin := handlers.RequireRole(models.RoleAdmin)
+
+	// Лимиты частоты считаются по клиенту, которого определила аутентификация, и проверяются
+	// после роли, чтобы запрещенные запросы не расходовали корзину. Запросы, запускающие
+	// обогащение, ограничиваются отдельно от остальных
+	limit, limitEnrich := newLimiters(log, cfg, appMetrics)
+
+	// Первым обработчиком маршрута в логгер запроса добавляются маршрут и пользователь из пути
+	route := requestlog.Route
+
+	fiberApp.Get("/", route, read, limit, handlers.DataWithFilters)
+	fiberApp.Post("/add", route, write, limitEnrich, handlers.Add)
+	fiberApp.Post("/delete", route, admin, limit, handlers.Delete)
+	fiberApp.Post("/edit", route, write, limit, handlers.Edit)
+
+	users := fiberApp.Group("/users")
+	users.Get("/", route, read, limit, handlers.DataWithFilters)
+	users.Get("/suggest", route, read, limit, handlers.Suggest)
+	users.Get("/stats", route, read, limit, handlers.Stats)
+	users.Get("/export", route, read, limit, handlers.Export)
+	users.Post("/import", route, write, limitEnrich, handlers.Import)
+	users.Post("/:id/restore", route, admin, limit, handlers.Restore)
+	users.Get("/:id/history", route, read, limit, handlers.History)
+	users.Get("/:id", route, read, limit, handlers.GetUser)
+
+	fiberApp.Get("/imports/:id", route, read, limit, handlers.GetImport)
 
-	return &App{
-		FiberSrv: fiberApp,
+	// В статусе адреса API обогащения и тексты их ошибок, поэтому он только для admin
+	fiberApp.Get("/status", route, admin, limit, handlers.Status)
+
+	a.FiberSrv = fiberApp
+
+	return a
+}
+
+// Run запускает фоновые задачи и HTTP-сервер и блокируется до отмены ctx (например,
+// по SIGINT/SIGTERM) или ошибки сервера. После Run нужно вызвать Stop
+func (a *App) Run(ctx context.Context) error {
+	const op = "app.Run"
+
+	jobsCtx, cancel := context.WithCancel(context.Background())
+	a.cancelJobs = cancel
+
+	// Импорты, брошенные прошлым запуском, иначе навсегда остались бы running. Ошибка
+	// не мешает старту: она уже записана в лог, а задачи будут помечены при следующем
+	_, _ = a.enricher.FailStaleImports(ctx, a.cfg.StaleImportAfter)
+
+	if a.cfg.DeletedRetention > 0 {
+		a.log.Info("purging deleted users",
+			slog.Duration("retention", a.cfg.DeletedRetention),
+			slog.Duration("interval", a.cfg.PurgeInterval),
+		)
+
+		a.jobs.Add(1)
+		go func() {
+			defer a.jobs.Done()
+			a.enricher.RunPurgeJob(jobsCtx, a.cfg.DeletedRetention, a.cfg.PurgeInterval)
+		}()
+	}
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- a.FiberSrv.Listen(a.cfg.HTTP.Port)
+	}()
+
+	select {
+	case <-ctx.Done():
+		a.log.Info("shutdown requested")
+		return nil
+	case err := <-listenErr:
+		return fmt.Errorf("%s: %w", op, err)
 	}
 }
+
+// Stop останавливает приложение не дольше ctx: перестает принимать соединения и дожидается
+// текущих запросов, останавливает фоновые задачи (импорты сохраняют прогресс), закрывает
+// журнал и хранилище и отправляет оставшиеся спаны. Ресурсы закрываются, даже если
+// предыдущие шаги не уложились в срок
+func (a *App) Stop(ctx context.Context) error {
+	const op = "app.Stop"
+
+	var errs []error
+
+	if err := a.FiberSrv.ShutdownWithContext(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("%s: shutdown http server: %w", op, err))
+	}
+
+	if a.cancelJobs != nil {
+		a.cancelJobs()
+	}
+	a.jobs.Wait()
+
+	if err := a.enricher.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", op, err))
+	}
+
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		if err := a.closers[i](ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", op, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		a.log.Info("application stopped")
+	}
+
+	return errors.Join(errs...)
+}
+
+// mustStorage создает хранилище, выбранное в конфиге, и функцию его закрытия и возвращает
+// префикс его op для метрик и спанов. Для баз сначала применяются миграции, если включен AUTO_MIGRATE
+func mustStorage(log *slog.Logger, cfg *config.Config) (enricher.Provider, string, func() error) {
+	switch cfg.Storage {
+	case config.StorageMemory:
+		log.Warn("using in-memory storage, data will be lost on restart")
+		return memory.New(), storage.OpPrefixMemory, func() error { return nil }
+	case config.StorageSQLite:
+		if cfg.Database.AutoMigrate {
+			if err := migrate(log, sqlite.DatabaseURL(cfg.Database.SQLitePath)); err != nil {
+				panic(err)
+			}
+		}
+
+		db, err := sqlite.New(context.Background(), sqlite.Config{Path: cfg.Database.SQLitePath})
+		if err != nil {
+			panic(err)
+		}
+		log.Info("opened sqlite database", slog.String("path", cfg.Database.SQLitePath))
+
+		return db, storage.OpPrefixSQLite, db.Close
+	}
+
+	if cfg.Database.AutoMigrate {
+		if err := migrate(log, cfg.Database.URL); err != nil {
+			panic(err)
+		}
+	}
+
+	db, err := postgres.New(context.Background(), postgres.Config{
+		URL:                    cfg.Database.URL,
+		MaxConns:               cfg.Database.MaxConns,
+		MinConns:               cfg.Database.MinConns,
+		MaxConnLifetime:        cfg.Database.MaxConnLifetime,
+		MaxConnIdleTime:        cfg.Database.MaxConnIdleTime,
+		StatementCacheCapacity: cfg.Database.StatementCacheCapacity,
+	})
+	if err != nil {
+		panic(err)
+	}
+	log.Info("connected to database", slog.Int("max_conns", int(db.Stats().MaxConns)))
+
+	return db, storage.OpPrefixPostgres, func() error {
+		db.Close()
+		return nil
+	}
+}
+
+// newHealth собирает проверки готовности для выбранного хранилища: база и версия схемы
+// проверяются, только если хранилище их поддерживает
+func newHealth(log *slog.Logger, cfg *config.Config, provider enricher.Provider, client *nameapi.Client) *health.Health {
+	pinger, _ := provider.(health.Pinger)
+	schema, _ := provider.(health.SchemaVersioner)
+
+	var latest uint
+	if schema != nil {
+		dbURL := cfg.Database.URL
+		if cfg.Storage == config.StorageSQLite {
+			dbURL = sqlite.DatabaseURL(cfg.Database.SQLitePath)
+		}
+
+		var err error
+		latest, err = migrator.LatestVersion(dbURL)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return health.New(log, pinger, schema, latest, client)
+}
+
+// mustAuth создает сервис аутентификации или возвращает nil, если она выключена
+func mustAuth(log *slog.Logger, cfg *config.Config, provider enricher.Provider, opPrefix string, appMetrics *metrics.Metrics) *auth.Auth {
+	if !cfg.Auth.Enabled {
+		log.Warn("authentication is disabled, the API is open to anyone who can reach it")
+		return nil
+	}
+
+	keys, ok := provider.(auth.KeyStore)
+	if !ok {
+		panic(fmt.Sprintf("storage %s does not support api keys", cfg.Storage))
+	}
+
+	authService, err := auth.New(log, instrumented.NewKeyStore(keys, opPrefix, appMetrics), auth.Config{
+		HMACSecret: cfg.Auth.JWTSecret,
+		JWKSPath:   cfg.Auth.JWKSPath,
+		Issuer:     cfg.Auth.JWTIssuer,
+		Audience:   cfg.Auth.JWTAudience,
+		RoleClaim:  cfg.Auth.JWTRoleClaim,
+	})
+	if err != nil {
+		panic(err)
+	}
+	log.Info("authentication enabled",
+		slog.Bool("jwt_hmac", cfg.Auth.JWTSecret != ""),
+		slog.Bool("jwt_jwks", cfg.Auth.JWKSPath != ""),
+	)
+
+	return authService
+}
+
+// mustQuota создает сервис суточных квот обогащения или возвращает nil, если квота не задана
+func mustQuota(log *slog.Logger, cfg *config.Config, provider enricher.Provider, opPrefix string, appMetrics *metrics.Metrics) *quota.Quota {
+	if cfg.RateLimit.DailyEnrichments == 0 {
+		return nil
+	}
+
+	store, ok := provider.(quota.Store)
+	if !ok {
+		panic(fmt.Sprintf("storage %s does not support enrichment quotas", cfg.Storage))
+	}
+	log.Info("daily enrichment quota enabled", slog.Int("per_client", cfg.RateLimit.DailyEnrichments))
+
+	return quota.New(log, instrumented.NewQuotaStore(store, opPrefix, appMetrics), cfg.RateLimit.DailyEnrichments, appMetrics)
+}
+
+// newLimiters создает middleware лимитов частоты для обычных запросов и запросов,
+// запускающих обогащение. Класс без лимита в конфиге не ограничивается
+func newLimiters(log *slog.Logger, cfg *config.Config, observer ratelimit.Observer) (general, enrich fiber.Handler) {
+	limits := cfg.RateLimit
+
+	var generalLimiter, enrichLimiter *ratelimit.Limiter
+	if limits.PerMinute > 0 {
+		generalLimiter = ratelimit.New(limits.PerMinute, limits.Burst)
+	}
+	if limits.EnrichPerMinute > 0 {
+		enrichLimiter = ratelimit.New(limits.EnrichPerMinute, limits.EnrichBurst)
+	}
+
+	if generalLimiter != nil || enrichLimiter != nil {
+		log.Info("rate limits enabled",
+			slog.Int("per_minute", limits.PerMinute),
+			slog.Int("enrich_per_minute", limits.EnrichPerMinute),
+		)
+	}
+
+	return ratelimit.Middleware(generalLimiter, ratelimit.ClassGeneral, observer),
+		ratelimit.Middleware(enrichLimiter, ratelimit.ClassEnrich, observer)
+}
+
+// migrate применяет встроенные миграции до последней версии перед подключением сервиса к базе
+func migrate(log *slog.Logger, dbURL string) error {
+	m, err := migrator.New(dbURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil {
+		return err
+	}
+
+	version, _, err := m.Version()
+	if err != nil {
+		return err
+	}
+	log.Info("database migrated", slog.Uint64("version", uint64(version)))
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sol1corejz/enricher/internal/config"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// TestRouteRoles проверяет роли, которые app.New назначает маршрутам: вызывающему с ролью
+// ниже требуемой - 403, остальным - ответ самого обработчика
+func TestRouteRoles(t *testing.T) {
+	cfg := config.Default()
+	cfg.Storage = config.StorageMemory
+	cfg.Auth.Enabled = true
+	cfg.Auth.JWTSecret = testSecret
+
+	app := New(slog.New(slog.NewTextHandler(io.Discard, nil)), &cfg)
+
+	routes := []struct {
+		method   string
+		path     string
+		required models.Role
+	}{
+		{fiber.MethodGet, "/", models.RoleReader},
+		{fiber.MethodGet, "/users", models.RoleReader},
+		{fiber.MethodGet, "/users/suggest?q=iv", models.RoleReader},
+		{fiber.MethodGet, "/users/stats", models.RoleReader},
+		{fiber.MethodGet, "/users/export", models.RoleReader},
+		{fiber.MethodGet, "/users/1", models.RoleReader},
+		{fiber.MethodGet, "/users/1/history", models.RoleReader},
+		{fiber.MethodGet, "/imports/1", models.RoleReader},
+		{fiber.MethodPost, "/add", models.RoleEditor},
+		{fiber.MethodPost, "/edit", models.RoleEditor},
+		{fiber.MethodPost, "/users/import", models.RoleEditor},
+		{fiber.MethodPost, "/delete", models.RoleAdmin},
+		{fiber.MethodPost, "/users/1/restore", models.RoleAdmin},
+		{fiber.MethodGet, "/status", models.RoleAdmin},
+	}
+
+	// Роль из claim role. Без claim и с неизвестной ролью токен опознается, но прав не дает
+	callers := []struct {
+		name string
+		role any
+		rank int
+	}{
+		{"no role", nil, 0},
+		{"unknown role", "owner", 0},
+		{"reader", "reader", 1},
+		{"editor", "editor", 2},
+		{"admin", "admin", 3},
+		{"roles array", []string{"reader", "admin"}, 3},
+	}
+
+	rank := map[models.Role]int{models.RoleReader: 1, models.RoleEditor: 2, models.RoleAdmin: 3}
+
+	for _, caller := range callers {
+		claims := jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+		if caller.role != nil {
+			claims["role"] = caller.role
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, route := range routes {
+			t.Run(caller.name+" "+route.method+" "+route.path, func(t *testing.T) {
+				req := httptest.NewRequest(route.method, route.path, nil)
+				req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+				resp, err := app.FiberSrv.Test(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				allowed := caller.rank >= rank[route.required]
+				switch {
+				case resp.StatusCode == fiber.StatusUnauthorized:
+					t.Errorf("status = 401, token must be accepted")
+				case !allowed && resp.StatusCode != fiber.StatusForbidden:
+					t.Errorf("status = %d, want 403 (route requires %s)", resp.StatusCode, route.required)
+				case allowed && resp.StatusCode == fiber.StatusForbidden:
+					t.Errorf("status = 403, want access (route requires %s)", route.required)
+				}
+			})
+		}
+	}
+
+	// Без учетных данных защищенные маршруты недоступны
+	for _, route := range routes {
+		resp, err := app.FiberSrv.Test(httptest.NewRequest(route.method, route.path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("%s %s without credentials: status = %d, want 401", route.method, route.path, resp.StatusCode)
+		}
+	}
+}
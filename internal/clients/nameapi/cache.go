@@ -0,0 +1,102 @@
+package nameapi
+
+import (
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"sync"
+	"time"
+)
+
+// Cache - потокобезопасный кэш результатов обогащения с TTL и ограничением размера
+type Cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]cacheEntry
+
+	hits   int64
+	misses int64
+}
+
+type cacheEntry struct {
+	enrichment models.Enrichment
+	expiresAt  time.Time
+}
+
+func NewCache(ttl time.Duration, max int) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		max:     max,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *Cache) Get(key string) (models.Enrichment, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return models.Enrichment{}, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		c.misses++
+		return models.Enrichment{}, false
+	}
+
+	c.hits++
+
+	return entry.enrichment, true
+}
+
+// Stats возвращает размер кэша и счетчики попаданий с момента запуска
+func (c *Cache) Stats() models.CacheStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := models.CacheStatus{
+		Entries: len(c.entries),
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		status.HitRatio = float64(c.hits) / float64(total)
+	}
+
+	return status
+}
+
+func (c *Cache) Set(key string, enrichment models.Enrichment) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.max {
+		c.evict()
+	}
+
+	c.entries[key] = cacheEntry{
+		enrichment: enrichment,
+		expiresAt:  time.Now().Add(c.ttl),
+	}
+}
+
+// evict освобождает место: удаляет просроченные записи, а если таких нет - произвольную
+func (c *Cache) evict() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+
+	if len(c.entries) < c.max {
+		return
+	}
+
+	for key := range c.entries {
+		delete(c.entries, key)
+		return
+	}
+}
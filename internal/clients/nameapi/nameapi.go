@@ -0,0 +1,243 @@
+// Package nameapi - клиент публичных API обогащения по имени: agify (возраст),
+// genderize (пол) и nationalize (национальность). Результаты кэшируются в памяти,
+// кэш общий для всех вызывающих (HTTP-обработчики, фоновый импорт)
+package nameapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	AgifyURL       = "https://api.agify.io/"
+	GenderizeURL   = "https://api.genderize.io/"
+	NationalizeURL = "https://api.nationalize.io/"
+
+	defaultTimeout  = 10 * time.Second
+	defaultCacheTTL = 24 * time.Hour
+	defaultCacheMax = 10000
+)
+
+type Client struct {
+	httpClient     *http.Client
+	agifyURL       string
+	genderizeURL   string
+	nationalizeURL string
+	cache          *Cache
+
+	agifyStats       *sourceStats
+	genderizeStats   *sourceStats
+	nationalizeStats *sourceStats
+
+	observer Observer
+	tracer   trace.Tracer
+}
+
+// Observer получает длительность и исход каждого запроса к API (например, для метрик)
+type Observer interface {
+	ObserveEnrichment(source string, duration time.Duration, err error)
+}
+
+// Config - адреса API, таймаут и параметры кэша. Нулевые значения заменяются значениями по умолчанию
+type Config struct {
+	AgifyURL       string
+	GenderizeURL   string
+	NationalizeURL string
+	Timeout        time.Duration
+	CacheTTL       time.Duration
+	CacheMax       int
+
+	// Необязательный наблюдатель запросов к API
+	Observer Observer
+}
+
+// New создает клиент API из cfg; для незаданных полей берутся публичные значения по умолчанию
+func New(cfg Config) *Client {
+	if cfg.AgifyURL == "" {
+		cfg.AgifyURL = AgifyURL
+	}
+	if cfg.GenderizeURL == "" {
+		cfg.GenderizeURL = GenderizeURL
+	}
+	if cfg.NationalizeURL == "" {
+		cfg.NationalizeURL = NationalizeURL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultCacheTTL
+	}
+	if cfg.CacheMax <= 0 {
+		cfg.CacheMax = defaultCacheMax
+	}
+
+	return &Client{
+		httpClient:     &http.Client{Timeout: cfg.Timeout},
+		agifyURL:       cfg.AgifyURL,
+		genderizeURL:   cfg.GenderizeURL,
+		nationalizeURL: cfg.NationalizeURL,
+		cache:          NewCache(cfg.CacheTTL, cfg.CacheMax),
+
+		agifyStats:       newSourceStats("agify", cfg.AgifyURL),
+		genderizeStats:   newSourceStats("genderize", cfg.GenderizeURL),
+		nationalizeStats: newSourceStats("nationalize", cfg.NationalizeURL),
+
+		observer: cfg.Observer,
+		tracer:   otel.Tracer("github.com/sol1corejz/enricher/internal/clients/nameapi"),
+	}
+}
+
+// Enrich возвращает возраст, пол и национальность для имени, сначала проверяя кэш.
+// В кэш попадают только полностью успешные ответы
+func (c *Client) Enrich(ctx context.Context, name string) (models.Enrichment, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+
+	if enrichment, ok := c.cache.Get(key); ok {
+		return enrichment, nil
+	}
+
+	var enrichment models.Enrichment
+
+	// Получаем возраст
+	age, err := c.getAge(ctx, name)
+	if err != nil {
+		return models.Enrichment{}, fmt.Errorf("failed to get age: %w", err)
+	}
+	enrichment.Age = age
+
+	// Получаем пол
+	sex, err := c.getGender(ctx, name)
+	if err != nil {
+		return models.Enrichment{}, fmt.Errorf("failed to get gender: %w", err)
+	}
+	enrichment.Sex = sex
+
+	// Получаем национальность
+	countries, err := c.getNationality(ctx, name)
+	if err != nil {
+		return models.Enrichment{}, fmt.Errorf("failed to get nationality: %w", err)
+	}
+	enrichment.Country = countries
+
+	c.cache.Set(key, enrichment)
+
+	return enrichment, nil
+}
+
+func (c *Client) getAge(ctx context.Context, name string) (int, error) {
+	var result struct {
+		Age int `json:"age"`
+	}
+	if err := c.get(ctx, c.agifyURL, c.agifyStats, name, &result); err != nil {
+		return 0, err
+	}
+
+	return result.Age, nil
+}
+
+func (c *Client) getGender(ctx context.Context, name string) (string, error) {
+	var result struct {
+		Gender string `json:"gender"`
+	}
+	if err := c.get(ctx, c.genderizeURL, c.genderizeStats, name, &result); err != nil {
+		return "", err
+	}
+
+	return result.Gender, nil
+}
+
+func (c *Client) getNationality(ctx context.Context, name string) ([]models.Country, error) {
+	var result struct {
+		Country []struct {
+			CountryID   string  `json:"country_id"`
+			Probability float64 `json:"probability"`
+		} `json:"country"`
+	}
+	if err := c.get(ctx, c.nationalizeURL, c.nationalizeStats, name, &result); err != nil {
+		return nil, err
+	}
+
+	countries := make([]models.Country, len(result.Country))
+	for i, country := range result.Country {
+		countries[i] = models.Country{
+			CountryID:   country.CountryID,
+			Probability: country.Probability,
+		}
+	}
+
+	return countries, nil
+}
+
+// get выполняет запрос к API и учитывает его исход в stats. Отмена запроса вызывающим
+// не считается ошибкой источника
+func (c *Client) get(ctx context.Context, baseURL string, stats *sourceStats, name string, result any) error {
+	ctx, span := c.tracer.Start(ctx, "GET "+stats.name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(http.MethodGet),
+			semconv.ServerAddress(serverAddress(baseURL)),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := c.fetch(ctx, baseURL, name, result)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if ctx.Err() == nil {
+		stats.record(err)
+		if c.observer != nil {
+			c.observer.ObserveEnrichment(stats.name, time.Since(start), err)
+		}
+	}
+
+	return err
+}
+
+func (c *Client) fetch(ctx context.Context, baseURL string, name string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"?name="+url.QueryEscape(name), nil)
+	if err != nil {
+		return err
+	}
+
+	// Источнику передается только контекст трассировки (traceparent). Глобальный пропагатор
+	// добавил бы и baggage, пришедший от клиента, а его нельзя отдавать сторонним API
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, baseURL)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// serverAddress возвращает хост API для атрибутов спана; сам адрес запроса с именем
+// в спан не попадает
+func serverAddress(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
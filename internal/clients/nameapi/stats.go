@@ -0,0 +1,113 @@
+package nameapi
+
+import (
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"sync"
+	"time"
+)
+
+// statsWindow - по скольким последним запросам к источнику считается доля ошибок
+const statsWindow = 100
+
+// sourceStats накапливает исходы запросов к одному API: общие счетчики и кольцевой
+// буфер последних statsWindow исходов для доли ошибок
+type sourceStats struct {
+	name string
+	url  string
+
+	mu            sync.Mutex
+	requests      int64
+	errors        int64
+	recent        [statsWindow]bool
+	recentLen     int
+	recentNext    int
+	lastSuccessAt time.Time
+	lastErrorAt   time.Time
+	lastError     string
+}
+
+func newSourceStats(name, url string) *sourceStats {
+	return &sourceStats{name: name, url: url}
+}
+
+func (s *sourceStats) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	failed := err != nil
+	if failed {
+		s.errors++
+		s.lastErrorAt = time.Now()
+		s.lastError = err.Error()
+	} else {
+		s.lastSuccessAt = time.Now()
+	}
+
+	s.recent[s.recentNext] = failed
+	s.recentNext = (s.recentNext + 1) % statsWindow
+	if s.recentLen < statsWindow {
+		s.recentLen++
+	}
+}
+
+// status считает источник доступным, если последний запрос к нему был успешным.
+// Пока запросов не было, состояние неизвестно: сами по себе источники не опрашиваются,
+// чтобы не тратить их лимиты
+func (s *sourceStats) status() models.SourceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := models.SourceStatus{
+		Name:     s.name,
+		URL:      s.url,
+		Status:   models.CheckUnknown,
+		Requests: s.requests,
+		Errors:   s.errors,
+		Window:   s.recentLen,
+	}
+
+	if s.recentLen > 0 {
+		failed := 0
+		for _, f := range s.recent[:s.recentLen] {
+			if f {
+				failed++
+			}
+		}
+		status.ErrorRate = float64(failed) / float64(s.recentLen)
+
+		status.Status = models.CheckOK
+		if s.lastErrorAt.After(s.lastSuccessAt) {
+			status.Status = models.CheckFailing
+		}
+	}
+
+	if !s.lastSuccessAt.IsZero() {
+		at := s.lastSuccessAt
+		status.LastSuccessAt = &at
+	}
+	if !s.lastErrorAt.IsZero() {
+		at := s.lastErrorAt
+		status.LastErrorAt = &at
+		status.LastError = s.lastError
+	}
+
+	return status
+}
+
+// Status возвращает состояние всех источников и кэша
+func (c *Client) Status() models.EnrichmentStatus {
+	return models.EnrichmentStatus{
+		Sources: []models.SourceStatus{
+			c.agifyStats.status(),
+			c.genderizeStats.status(),
+			c.nationalizeStats.status(),
+		},
+		Cache: c.cache.Stats(),
+	}
+}
+
+// CacheStats возвращает счетчики кэша результатов
+func (c *Client) CacheStats() models.CacheStatus {
+	return c.cache.Stats()
+}
@@ -1,24 +1,277 @@
+// Package config - типизированная конфигурация сервиса и утилит. Значения берутся
+// (от меньшего приоритета к большему) из значений по умолчанию, YAML-файла CONFIG_PATH,
+// файла .env и переменных окружения процесса, после чего проверяются целиком
 package config
 
 import (
-	"github.com/joho/godotenv"
 	"os"
+	"strings"
+	"time"
+)
+
+const (
+	EnvLocal = "local"
+	EnvDev   = "dev"
+	EnvProd  = "prod"
+)
+
+const (
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+)
+
+const (
+	StoragePostgres = "postgres"
+	StorageSQLite   = "sqlite"
+	StorageMemory   = "memory"
 )
 
 type Config struct {
-	Env  string
-	Port string
+	// Окружение: local, dev или prod. От него зависят настройки логов по умолчанию
+	Env string `yaml:"env" env:"ENV"`
+
+	HTTP HTTP `yaml:"http"`
+	Log  Log  `yaml:"log"`
+
+	// Хранилище: postgres (по умолчанию), sqlite - файл встроенной базы Database.SQLitePath
+	// или memory - данные в памяти процесса, без базы
+	Storage string `yaml:"storage" env:"STORAGE"`
+
+	Database   Database   `yaml:"database"`
+	Enrichment Enrichment `yaml:"enrichment"`
+	Cache      Cache      `yaml:"cache"`
+	Tracing    Tracing    `yaml:"tracing"`
+	Auth       Auth       `yaml:"auth"`
+	RateLimit  RateLimit  `yaml:"rate_limit"`
+
+	// Путь к журналу изменяющих запросов (JSONL). Пустой - журнал не ведется
+	JournalPath string `yaml:"journal_path" env:"JOURNAL_PATH"`
+
+	// Сколько хранить мягко удаленных пользователей до окончательной очистки. 0 - не очищать
+	DeletedRetention time.Duration `yaml:"deleted_retention" env:"DELETED_RETENTION"`
+
+	// Как часто запускать очистку удаленных пользователей
+	PurgeInterval time.Duration `yaml:"purge_interval" env:"PURGE_INTERVAL"`
+
+	// Сколько ждать завершения запросов и фоновых задач при остановке сервиса
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+
+	// Незавершенные импорты без прогресса дольше этого при старте сервиса помечаются failed.
+	// 0 - все незавершенные (один экземпляр сервиса); при нескольких экземплярах значение
+	// должно быть больше времени обработки пачки, чтобы не задеть импорты соседей
+	StaleImportAfter time.Duration `yaml:"stale_import_after" env:"STALE_IMPORT_AFTER"`
+}
+
+// HTTP - настройки HTTP-сервера. Нулевой таймаут - без ограничения
+type HTTP struct {
+	// Адрес для Listen, например :8080
+	Port string `yaml:"port" env:"PORT"`
+
+	ReadTimeout  time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+}
+
+// Log - настройки логов. Пустые значения выбираются по Env: local - text/debug,
+// dev - json/debug, prod - json/info
+type Log struct {
+	// debug, info, warn или error
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+
+	// text или json
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// Database - подключение к базе и пул соединений Postgres. Нулевые значения пула - значения pgxpool по умолчанию
+type Database struct {
+	// Строка подключения к Postgres
+	URL string `yaml:"url" env:"DB_URL"`
+
+	// Путь к файлу базы для STORAGE=sqlite
+	SQLitePath string `yaml:"sqlite_path" env:"SQLITE_PATH"`
+
+	// Применять встроенные миграции при старте сервиса
+	AutoMigrate bool `yaml:"auto_migrate" env:"AUTO_MIGRATE"`
+
+	MaxConns               int32         `yaml:"max_conns" env:"DB_MAX_CONNS"`
+	MinConns               int32         `yaml:"min_conns" env:"DB_MIN_CONNS"`
+	MaxConnLifetime        time.Duration `yaml:"max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
+	MaxConnIdleTime        time.Duration `yaml:"max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
+	StatementCacheCapacity int           `yaml:"statement_cache_capacity" env:"DB_STATEMENT_CACHE_CAPACITY"`
+}
+
+// Enrichment - внешние API обогащения по имени
+type Enrichment struct {
+	AgifyURL       string `yaml:"agify_url" env:"ENRICH_AGIFY_URL"`
+	GenderizeURL   string `yaml:"genderize_url" env:"ENRICH_GENDERIZE_URL"`
+	NationalizeURL string `yaml:"nationalize_url" env:"ENRICH_NATIONALIZE_URL"`
+
+	// Таймаут одного запроса к API
+	Timeout time.Duration `yaml:"timeout" env:"ENRICH_TIMEOUT"`
+}
+
+// Cache - кэш результатов обогащения в памяти
+type Cache struct {
+	TTL        time.Duration `yaml:"ttl" env:"CACHE_TTL"`
+	MaxEntries int           `yaml:"max_entries" env:"CACHE_MAX_ENTRIES"`
+}
+
+// Tracing - трассировка OpenTelemetry
+type Tracing struct {
+	// none (по умолчанию), otlp - экспорт по OTLP/HTTP или stdout - вывод спанов в консоль
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER"`
+
+	// Адрес коллектора OTLP/HTTP, например http://localhost:4318. Пустой - из стандартных
+	// переменных OTEL_EXPORTER_OTLP_*, иначе localhost:4318
+	Endpoint string `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+
+	// Доля трассировок, начинающихся в сервисе, которые записываются (0..1).
+	// Для входящих запросов решение вызывающего сохраняется
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+
+	ServiceName string `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
 }
 
+// Auth - аутентификация запросов к API. Пробы, метрики и документация доступны без нее
+type Auth struct {
+	// Требовать ключ API или JWT. Ключи выдаются командой enricherctl keys create
+	Enabled bool `yaml:"enabled" env:"AUTH_ENABLED"`
+
+	// Общий секрет для JWT с подписью HS256/384/512, не короче 32 байт
+	JWTSecret string `yaml:"jwt_secret" env:"AUTH_JWT_SECRET"`
+
+	// Файл JWKS с открытыми ключами для JWT с подписью RS*, PS* или ES*
+	JWKSPath string `yaml:"jwks_path" env:"AUTH_JWKS_PATH"`
+
+	// Ожидаемые iss и aud токенов. Пустые - не проверяются
+	JWTIssuer   string `yaml:"jwt_issuer" env:"AUTH_JWT_ISSUER"`
+	JWTAudience string `yaml:"jwt_audience" env:"AUTH_JWT_AUDIENCE"`
+
+	// Claim токена с ролью (reader, editor или admin), строка или массив строк
+	JWTRoleClaim string `yaml:"jwt_role_claim" env:"AUTH_JWT_ROLE_CLAIM"`
+}
+
+// RateLimit - ограничения для каждого клиента API: ключа API, субъекта JWT или, без
+// аутентификации, IP-адреса. Нулевые значения - без ограничения
+type RateLimit struct {
+	// Запросов, не запускающих обогащение (чтение, правка, удаление), в минуту и сколько
+	// из них можно сделать подряд (0 - столько же)
+	PerMinute int `yaml:"per_minute" env:"RATE_LIMIT_PER_MINUTE"`
+	Burst     int `yaml:"burst" env:"RATE_LIMIT_BURST"`
+
+	// То же для запросов, запускающих обогащение (/add, /users/import); у них своя корзина
+	EnrichPerMinute int `yaml:"enrich_per_minute" env:"RATE_LIMIT_ENRICH_PER_MINUTE"`
+	EnrichBurst     int `yaml:"enrich_burst" env:"RATE_LIMIT_ENRICH_BURST"`
+
+	// Обогащений (добавленных и импортированных пользователей) на клиента за сутки по UTC
+	DailyEnrichments int `yaml:"daily_enrichments" env:"ENRICHMENT_DAILY_QUOTA"`
+}
+
+// ValidationError перечисляет все проблемы конфигурации сразу, а не только первую
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Default возвращает конфигурацию со значениями по умолчанию
+func Default() Config {
+	return Config{
+		Env: EnvLocal,
+		HTTP: HTTP{
+			Port:        ":8080",
+			ReadTimeout: 30 * time.Second,
+			IdleTimeout: 2 * time.Minute,
+		},
+		Storage: StoragePostgres,
+		Database: Database{
+			SQLitePath: "enricher.db",
+		},
+		Enrichment: Enrichment{
+			AgifyURL:       "https://api.agify.io/",
+			GenderizeURL:   "https://api.genderize.io/",
+			NationalizeURL: "https://api.nationalize.io/",
+			Timeout:        10 * time.Second,
+		},
+		Cache: Cache{
+			TTL:        24 * time.Hour,
+			MaxEntries: 10000,
+		},
+		Tracing: Tracing{
+			Exporter:    TracingNone,
+			SampleRatio: 1,
+			ServiceName: "enricher",
+		},
+		Auth: Auth{
+			JWTRoleClaim: "role",
+		},
+		PurgeInterval:   time.Hour,
+		ShutdownTimeout: 15 * time.Second,
+	}
+}
+
+// Load собирает конфигурацию из всех источников и проверяет ее. Ошибки разбора значений
+// и проверки возвращаются вместе одной *ValidationError
+func Load() (*Config, error) {
+	cfg := Default()
+
+	dotenv, err := readDotenv(dotenvPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := func(key string) (string, bool) {
+		if value, ok := os.LookupEnv(key); ok {
+			return value, true
+		}
+		value, ok := dotenv[key]
+		return value, ok
+	}
+
+	var problems []string
+
+	if path, ok := lookup("CONFIG_PATH"); ok && path != "" {
+		problems = append(problems, loadYAML(path, &cfg)...)
+	}
+
+	problems = append(problems, loadEnv(lookup, &cfg)...)
+
+	cfg.applyDerivedDefaults()
+	problems = append(problems, cfg.validate()...)
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	return &cfg, nil
+}
+
+// MustLoad - Load, паникующий при ошибке
 func MustLoad() *Config {
-	var cfg Config
-	if err := godotenv.Load(); err == nil {
-		env := os.Getenv("ENV")
-		port := os.Getenv("PORT")
+	cfg, err := Load()
+	if err != nil {
+		panic(err)
+	}
+
+	return cfg
+}
 
-		cfg.Env = env
-		cfg.Port = port
+// applyDerivedDefaults заполняет значения, умолчания для которых зависят от других настроек
+func (c *Config) applyDerivedDefaults() {
+	if c.Log.Format == "" {
+		c.Log.Format = "json"
+		if c.Env == EnvLocal {
+			c.Log.Format = "text"
+		}
 	}
 
-	return &cfg
+	if c.Log.Level == "" {
+		c.Log.Level = "debug"
+		if c.Env == EnvProd {
+			c.Log.Level = "info"
+		}
+	}
 }
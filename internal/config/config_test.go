@@ -0,0 +1,354 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chdir переходит во временную директорию на время теста: Load читает .env из текущей
+func chdir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	return dir
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lookupMap - источник переменных окружения для loadEnv
+func lookupMap(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := chdir(t)
+
+	configPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, configPath, `
+env: dev
+storage: memory
+http:
+  port: ":1000"
+  read_timeout: 5s
+log:
+  level: info
+cache:
+  ttl: 1h
+  max_entries: 10
+rate_limit:
+  per_minute: 60
+`)
+
+	// CONFIG_PATH тоже можно задать в .env
+	writeFile(t, filepath.Join(dir, ".env"), `
+CONFIG_PATH=`+configPath+`
+PORT=:2000
+CACHE_TTL=2h
+LOG_FORMAT=text
+`)
+
+	t.Setenv("PORT", ":3000")
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "120")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		// Окружение процесса важнее .env и YAML
+		{"PORT from env", cfg.HTTP.Port, ":3000"},
+		{"RATE_LIMIT_PER_MINUTE from env", cfg.RateLimit.PerMinute, 120},
+		// .env важнее YAML
+		{"CACHE_TTL from .env", cfg.Cache.TTL, 2 * time.Hour},
+		{"LOG_FORMAT from .env", cfg.Log.Format, "text"},
+		// YAML важнее значений по умолчанию
+		{"env from yaml", cfg.Env, EnvDev},
+		{"storage from yaml", cfg.Storage, StorageMemory},
+		{"read timeout from yaml", cfg.HTTP.ReadTimeout, 5 * time.Second},
+		{"log level from yaml", cfg.Log.Level, "info"},
+		{"cache entries from yaml", cfg.Cache.MaxEntries, 10},
+		// Остальное - значения по умолчанию
+		{"idle timeout default", cfg.HTTP.IdleTimeout, 2 * time.Minute},
+		{"agify default", cfg.Enrichment.AgifyURL, "https://api.agify.io/"},
+		{"role claim default", cfg.Auth.JWTRoleClaim, "role"},
+	}
+
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	chdir(t)
+	t.Setenv("STORAGE", StorageMemory)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := Default()
+	want.Storage = StorageMemory
+	want.Log = Log{Level: "debug", Format: "text"}
+
+	if !reflect.DeepEqual(*cfg, want) {
+		t.Errorf("Load() = %+v, want %+v", *cfg, want)
+	}
+}
+
+func TestDerivedDefaults(t *testing.T) {
+	tests := []struct {
+		env  string
+		log  Log
+		want Log
+	}{
+		{EnvLocal, Log{}, Log{Level: "debug", Format: "text"}},
+		{EnvDev, Log{}, Log{Level: "debug", Format: "json"}},
+		{EnvProd, Log{}, Log{Level: "info", Format: "json"}},
+		// Заданные значения не меняются
+		{EnvProd, Log{Level: "warn", Format: "text"}, Log{Level: "warn", Format: "text"}},
+	}
+
+	for _, tt := range tests {
+		cfg := Config{Env: tt.env, Log: tt.log}
+		cfg.applyDerivedDefaults()
+
+		if cfg.Log != tt.want {
+			t.Errorf("env %s, log %+v: got %+v, want %+v", tt.env, tt.log, cfg.Log, tt.want)
+		}
+	}
+}
+
+func TestLoadEnvKinds(t *testing.T) {
+	cfg := Default()
+
+	problems := loadEnv(lookupMap(map[string]string{
+		"ENV":                  "prod",
+		"AUTO_MIGRATE":         "true",
+		"AUTH_ENABLED":         "1",
+		"DB_MAX_CONNS":         "20",
+		"CACHE_MAX_ENTRIES":    "500",
+		"CACHE_TTL":            "90m",
+		"DELETED_RETENTION":    "720h",
+		"TRACING_SAMPLE_RATIO": "0.25",
+		// Пустое значение не меняет поле
+		"PORT": "",
+	}), &cfg)
+	if len(problems) > 0 {
+		t.Fatalf("loadEnv() problems = %v", problems)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"string", cfg.Env, EnvProd},
+		{"bool true", cfg.Database.AutoMigrate, true},
+		{"bool 1", cfg.Auth.Enabled, true},
+		{"int32", cfg.Database.MaxConns, int32(20)},
+		{"int", cfg.Cache.MaxEntries, 500},
+		{"duration", cfg.Cache.TTL, 90 * time.Minute},
+		{"long duration", cfg.DeletedRetention, 720 * time.Hour},
+		{"float", cfg.Tracing.SampleRatio, 0.25},
+		{"empty value", cfg.HTTP.Port, ":8080"},
+	}
+
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadEnvInvalid(t *testing.T) {
+	cfg := Default()
+
+	problems := loadEnv(lookupMap(map[string]string{
+		"AUTO_MIGRATE":         "yes please",
+		"DB_MAX_CONNS":         "3000000000",
+		"CACHE_MAX_ENTRIES":    "ten",
+		"CACHE_TTL":            "10",
+		"SHUTDOWN_TIMEOUT":     "soon",
+		"TRACING_SAMPLE_RATIO": "half",
+	}), &cfg)
+
+	want := []string{
+		`AUTO_MIGRATE: invalid boolean "yes please"`,
+		`DB_MAX_CONNS: invalid integer "3000000000"`,
+		`CACHE_TTL: invalid duration "10", expected a value like 30s or 720h`,
+		`CACHE_MAX_ENTRIES: invalid integer "ten"`,
+		`TRACING_SAMPLE_RATIO: invalid number "half"`,
+		`SHUTDOWN_TIMEOUT: invalid duration "soon", expected a value like 30s or 720h`,
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("loadEnv() problems:\n%s\nwant:\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Поля с неразобранными значениями сохраняют прежние
+	defaults := Default()
+	if cfg.Cache != defaults.Cache || cfg.Database.MaxConns != 0 || cfg.ShutdownTimeout != defaults.ShutdownTimeout {
+		t.Errorf("invalid values changed fields: %+v", cfg)
+	}
+}
+
+func TestSetValueUnsupported(t *testing.T) {
+	var s struct {
+		List []string
+		Map  map[string]string
+		Uint uint
+	}
+	v := reflect.ValueOf(&s).Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		err := setValue(v.Field(i), "a,b")
+		if err == nil || !strings.Contains(err.Error(), "unsupported type") {
+			t.Errorf("%s: error = %v, want unsupported type", v.Type().Field(i).Name, err)
+		}
+	}
+}
+
+func TestLoadYAMLInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"empty file", "", nil},
+		{"unknown key", "http:\n  prot: \":80\"\n", []string{"field prot not found"}},
+		{
+			"wrong types",
+			"cache:\n  max_entries: many\nauth:\n  enabled: maybe\n",
+			[]string{"cannot unmarshal !!str `many` into int", "cannot unmarshal !!str `maybe` into bool"},
+		},
+		{"invalid duration", "cache:\n  ttl: forever\n", []string{"forever"}},
+		{"syntax error", "http: [", []string{"did not find expected node content"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".yaml")
+			writeFile(t, path, tt.data)
+
+			cfg := Default()
+			problems := loadYAML(path, &cfg)
+
+			if len(problems) != len(tt.want) {
+				t.Fatalf("loadYAML() problems = %q, want %d", problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(problems[i], path+": ") || !strings.Contains(problems[i], want) {
+					t.Errorf("problem %d = %q, want %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+
+	problems := loadYAML(filepath.Join(dir, "missing.yaml"), &Config{})
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "CONFIG_PATH: ") {
+		t.Errorf("loadYAML(missing) problems = %q", problems)
+	}
+}
+
+func TestLoadValidationError(t *testing.T) {
+	dir := chdir(t)
+
+	configPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, configPath, "cache:\n  max_entries: many\n")
+
+	t.Setenv("CONFIG_PATH", configPath)
+	t.Setenv("ENV", "staging")
+	t.Setenv("STORAGE", StoragePostgres)
+	t.Setenv("DB_URL", "")
+	t.Setenv("CACHE_TTL", "0s")
+	t.Setenv("ENRICH_AGIFY_URL", "agify.io")
+	t.Setenv("AUTH_JWT_SECRET", "short")
+	t.Setenv("DB_MIN_CONNS", "10")
+	t.Setenv("DB_MAX_CONNS", "5")
+	t.Setenv("RATE_LIMIT_BURST", "-1")
+	t.Setenv("TRACING_SAMPLE_RATIO", "2")
+	t.Setenv("SHUTDOWN_TIMEOUT", "later")
+
+	_, err := Load()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Load() error = %v, want *ValidationError", err)
+	}
+
+	// Все проблемы разом: ошибки YAML и разбора переменных, затем проверки
+	want := []string{
+		"config.yaml: line 2: cannot unmarshal !!str `many` into int",
+		`SHUTDOWN_TIMEOUT: invalid duration "later"`,
+		`ENV: unknown environment "staging"`,
+		"DB_URL: required for STORAGE=postgres",
+		"DB_MIN_CONNS: 10 is greater than DB_MAX_CONNS 5",
+		`ENRICH_AGIFY_URL: "agify.io" is not an absolute http(s) URL`,
+		"CACHE_TTL: must be positive",
+		"TRACING_SAMPLE_RATIO: must be between 0 and 1",
+		"AUTH_JWT_SECRET: must be at least 32 bytes",
+		"RATE_LIMIT_BURST: must not be negative",
+	}
+
+	if len(validationErr.Problems) != len(want) {
+		t.Fatalf("problems:\n%s\nwant %d", strings.Join(validationErr.Problems, "\n"), len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(validationErr.Problems[i], w) {
+			t.Errorf("problem %d = %q, want %q", i, validationErr.Problems[i], w)
+		}
+		if !strings.Contains(err.Error(), "\n  - "+validationErr.Problems[i]) {
+			t.Errorf("Error() does not list %q", validationErr.Problems[i])
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "invalid configuration:\n") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestValidateDefaults(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://localhost/enricher"
+	cfg.applyDerivedDefaults()
+
+	if problems := cfg.validate(); len(problems) > 0 {
+		t.Errorf("validate() of defaults = %q", problems)
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// dotenvPath - файл .env в текущей директории, как и раньше
+const dotenvPath = ".env"
+
+// readDotenv читает .env без изменения окружения процесса. Отсутствие файла - не ошибка
+func readDotenv(path string) (map[string]string, error) {
+	values, err := godotenv.Read(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("config: read %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// loadYAML накладывает значения из YAML-файла поверх cfg. Неизвестные ключи считаются
+// ошибкой, чтобы опечатка не превращалась молча в значение по умолчанию
+func loadYAML(path string, cfg *Config) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []string{fmt.Sprintf("CONFIG_PATH: %v", err)}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	err = dec.Decode(cfg)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+
+	problems := make([]string, 0, len(typeErr.Errors))
+	for _, msg := range typeErr.Errors {
+		problems = append(problems, fmt.Sprintf("%s: %s", path, msg))
+	}
+
+	return problems
+}
+
+// loadEnv заполняет поля с тегом env значениями из lookup. Каждое неразобранное
+// значение - отдельная проблема, поле при этом сохраняет прежнее значение
+func loadEnv(lookup func(string) (string, bool), cfg *Config) []string {
+	var problems []string
+
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field, value := t.Field(i), v.Field(i)
+
+			if field.Type.Kind() == reflect.Struct {
+				walk(value)
+				continue
+			}
+
+			key := field.Tag.Get("env")
+			if key == "" {
+				continue
+			}
+
+			raw, ok := lookup(key)
+			if !ok || raw == "" {
+				continue
+			}
+
+			if err := setValue(value, raw); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			}
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+
+	return problems
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected a value like 30s or 720h", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
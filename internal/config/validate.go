@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// minJWTSecretLength - минимальная длина секрета HMAC, как размер выхода HS256
+const minJWTSecretLength = 32
+
+// validate возвращает все найденные проблемы конфигурации, а не только первую
+func (c *Config) validate() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch c.Env {
+	case EnvLocal, EnvDev, EnvProd:
+	default:
+		add("ENV: unknown environment %q, expected local, dev or prod", c.Env)
+	}
+
+	if c.HTTP.Port == "" {
+		add("PORT: must not be empty")
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		add("LOG_LEVEL: unknown level %q, expected debug, info, warn or error", c.Log.Level)
+	}
+
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		add("LOG_FORMAT: unknown format %q, expected text or json", c.Log.Format)
+	}
+
+	switch c.Storage {
+	case StoragePostgres:
+		if c.Database.URL == "" {
+			add("DB_URL: required for STORAGE=postgres")
+		}
+	case StorageSQLite:
+		if c.Database.SQLitePath == "" {
+			add("SQLITE_PATH: required for STORAGE=sqlite")
+		}
+	case StorageMemory:
+	default:
+		add("STORAGE: unknown storage %q, expected postgres, sqlite or memory", c.Storage)
+	}
+
+	if c.Database.MaxConns < 0 {
+		add("DB_MAX_CONNS: must not be negative")
+	}
+	if c.Database.MinConns < 0 {
+		add("DB_MIN_CONNS: must not be negative")
+	}
+	if c.Database.MaxConns > 0 && c.Database.MinConns > c.Database.MaxConns {
+		add("DB_MIN_CONNS: %d is greater than DB_MAX_CONNS %d", c.Database.MinConns, c.Database.MaxConns)
+	}
+	if c.Database.StatementCacheCapacity < 0 {
+		add("DB_STATEMENT_CACHE_CAPACITY: must not be negative")
+	}
+
+	for _, u := range []struct{ key, value string }{
+		{"ENRICH_AGIFY_URL", c.Enrichment.AgifyURL},
+		{"ENRICH_GENDERIZE_URL", c.Enrichment.GenderizeURL},
+		{"ENRICH_NATIONALIZE_URL", c.Enrichment.NationalizeURL},
+	} {
+		if !isHTTPURL(u.value) {
+			add("%s: %q is not an absolute http(s) URL", u.key, u.value)
+		}
+	}
+	if c.Enrichment.Timeout <= 0 {
+		add("ENRICH_TIMEOUT: must be positive")
+	}
+
+	if c.Cache.TTL <= 0 {
+		add("CACHE_TTL: must be positive")
+	}
+	if c.Cache.MaxEntries <= 0 {
+		add("CACHE_MAX_ENTRIES: must be positive")
+	}
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", c.HTTP.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.HTTP.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.HTTP.IdleTimeout},
+		{"DB_MAX_CONN_LIFETIME", c.Database.MaxConnLifetime},
+		{"DB_MAX_CONN_IDLE_TIME", c.Database.MaxConnIdleTime},
+		{"DELETED_RETENTION", c.DeletedRetention},
+		{"STALE_IMPORT_AFTER", c.StaleImportAfter},
+	} {
+		if d.value < 0 {
+			add("%s: must not be negative", d.key)
+		}
+	}
+
+	if c.DeletedRetention > 0 && c.PurgeInterval <= 0 {
+		add("PURGE_INTERVAL: must be positive when DELETED_RETENTION is set")
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if c.Tracing.Endpoint != "" && !isHTTPURL(c.Tracing.Endpoint) {
+			add("TRACING_ENDPOINT: %q is not an absolute http(s) URL", c.Tracing.Endpoint)
+		}
+	default:
+		add("TRACING_EXPORTER: unknown exporter %q, expected none, otlp or stdout", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("TRACING_SAMPLE_RATIO: must be between 0 and 1")
+	}
+	if c.Tracing.ServiceName == "" {
+		add("TRACING_SERVICE_NAME: must not be empty")
+	}
+
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < minJWTSecretLength {
+		add("AUTH_JWT_SECRET: must be at least %d bytes", minJWTSecretLength)
+	}
+	if c.Auth.JWTRoleClaim == "" {
+		add("AUTH_JWT_ROLE_CLAIM: must not be empty")
+	}
+
+	for _, n := range []struct {
+		key   string
+		value int
+	}{
+		{"RATE_LIMIT_PER_MINUTE", c.RateLimit.PerMinute},
+		{"RATE_LIMIT_BURST", c.RateLimit.Burst},
+		{"RATE_LIMIT_ENRICH_PER_MINUTE", c.RateLimit.EnrichPerMinute},
+		{"RATE_LIMIT_ENRICH_BURST", c.RateLimit.EnrichBurst},
+		{"ENRICHMENT_DAILY_QUOTA", c.RateLimit.DailyEnrichments},
+	} {
+		if n.value < 0 {
+			add("%s: must not be negative", n.key)
+		}
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		add("SHUTDOWN_TIMEOUT: must be positive")
+	}
+
+	return problems
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"github.com/sol1corejz/enricher/internal/lib/filterexpr"
+	"time"
+)
+
 type SaveUserPayload struct {
 	Name       string `json:"name"`
 	Surname    string `json:"surname"`
@@ -19,20 +24,90 @@ type DeleteUserPayload struct {
 
 type Country struct {
 	CountryID   string  `json:"country_id"`
+	Name        string  `json:"name,omitempty"`
 	Probability float64 `json:"probability"`
 }
 
 type EnrichedUser struct {
-	ID         int64     `json:"id"`
-	Name       string    `json:"name"`
-	Surname    string    `json:"surname,omitempty"`
-	Patronymic string    `json:"patronymic"`
-	Age        int       `json:"age"`
-	Sex        string    `json:"sex"`
-	Country    []Country `json:"country"`
+	ID             int64      `json:"id"`
+	Name           string     `json:"name"`
+	Surname        string     `json:"surname,omitempty"`
+	Patronymic     string     `json:"patronymic"`
+	Age            int        `json:"age"`
+	Sex            string     `json:"sex"`
+	Country        []Country  `json:"country"`
+	PrimaryCountry *Country   `json:"primary_country,omitempty"`
+	EnrichedAt     time.Time  `json:"enriched_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Enrichment - данные, полученные из внешних API по имени
+type Enrichment struct {
+	Age     int       `json:"age"`
+	Sex     string    `json:"sex"`
+	Country []Country `json:"country"`
+}
+
+// TopCountry возвращает страну с наибольшей вероятностью или nil, если список пуст
+func TopCountry(countries []Country) *Country {
+	var top *Country
+	for i := range countries {
+		if top == nil || countries[i].Probability > top.Probability {
+			top = &countries[i]
+		}
+	}
+	if top == nil {
+		return nil
+	}
+
+	c := *top
+	return &c
+}
+
+// AuditAction - вид изменения пользователя в журнале аудита
+type AuditAction string
+
+const (
+	AuditCreate   AuditAction = "create"
+	AuditEdit     AuditAction = "edit"
+	AuditDelete   AuditAction = "delete"
+	AuditRestore  AuditAction = "restore"
+	AuditReEnrich AuditAction = "re_enrich"
+)
+
+// UserAuditEntry - запись журнала аудита со снимками пользователя до и после изменения
+type UserAuditEntry struct {
+	ID        int64         `json:"id"`
+	UserID    int64         `json:"user_id"`
+	Action    AuditAction   `json:"action"`
+	Before    *EnrichedUser `json:"before,omitempty"`
+	After     *EnrichedUser `json:"after,omitempty"`
+	Actor     string        `json:"actor,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type UserSuggestion struct {
+	ID       int64  `json:"id"`
+	FullName string `json:"full_name"`
+}
+
+// UserFilterFields - поля, доступные в выражении параметра filter.
+// country - код наиболее вероятной страны (primary_country)
+var UserFilterFields = filterexpr.Fields{
+	"id":         filterexpr.Int,
+	"name":       filterexpr.String,
+	"surname":    filterexpr.String,
+	"patronymic": filterexpr.String,
+	"age":        filterexpr.Int32,
+	"sex":        filterexpr.String,
+	"country":    filterexpr.String,
 }
 
 type UserFilter struct {
+	// Полнотекстовый поиск по ФИО (префиксное совпадение, результаты ранжируются)
+	Search string `json:"q,omitempty"`
+
 	// Поиск по имени (частичное совпадение)
 	Name string `json:"name,omitempty"`
 
@@ -48,15 +123,277 @@ type UserFilter struct {
 	// Возраст до (включительно)
 	AgeTo int `json:"ageTo,omitempty"`
 
+	// Данные обогащены раньше указанного момента (для повторного обогащения)
+	EnrichedBefore time.Time `json:"-"`
+
 	// Пол (точное совпадение)
 	Sex string `json:"sex,omitempty"`
 
 	// Страна (частичное совпадение)
 	Country string `json:"country,omitempty"`
 
+	// Произвольное булево выражение из параметра filter, разобранное по UserFilterFields
+	Expression filterexpr.Node `json:"-"`
+
+	// Выбрать данные в том виде, в каком они были в указанный момент (по истории версий)
+	AsOf time.Time `json:"asOf,omitempty"`
+
+	// Включать мягко удаленных пользователей (по умолчанию они скрыты)
+	IncludeDeleted bool `json:"includeDeleted,omitempty"`
+
 	// Пагинация - количество записей на странице
 	Limit int `json:"limit,omitempty"`
 
 	// Пагинация - смещение (пропуск записей)
 	Offset int `json:"offset,omitempty"`
 }
+
+// ReEnrichResult - итог повторного обогащения устаревших записей
+type ReEnrichResult struct {
+	Checked int `json:"checked"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+}
+
+// StatsOptions - параметры агрегированной статистики
+type StatsOptions struct {
+	// Границы корзин гистограммы возраста по возрастанию, например [18, 30, 45]
+	AgeBuckets []int
+
+	// Количество стран в топе
+	TopCountries int
+}
+
+type UserStats struct {
+	Total        int64            `json:"total"`
+	BySex        map[string]int64 `json:"by_sex"`
+	AgeHistogram []AgeBucket      `json:"age_histogram"`
+	TopCountries []CountryStats   `json:"top_countries"`
+}
+
+// AgeBucket - корзина гистограммы возраста [From, To). To == nil - без верхней границы
+type AgeBucket struct {
+	From  int   `json:"from"`
+	To    *int  `json:"to,omitempty"`
+	Count int64 `json:"count"`
+}
+
+// NewAgeHistogram строит пустые корзины гистограммы по возрастающим границам:
+// корзина i покрывает [bounds[i-1], bounds[i]), первая начинается с 0, последняя не ограничена
+// сверху. Порядок корзин совпадает с номерами width_bucket в Postgres
+func NewAgeHistogram(bounds []int) []AgeBucket {
+	buckets := make([]AgeBucket, 0, len(bounds)+1)
+
+	from := 0
+	for _, bound := range bounds {
+		to := bound
+		buckets = append(buckets, AgeBucket{From: from, To: &to})
+		from = bound
+	}
+
+	return append(buckets, AgeBucket{From: from})
+}
+
+type CountryStats struct {
+	CountryID  string  `json:"country_id"`
+	Name       string  `json:"name,omitempty"`
+	Count      int64   `json:"count"`
+	AverageAge float64 `json:"average_age"`
+}
+
+type ImportStatus string
+
+const (
+	ImportPending   ImportStatus = "pending"
+	ImportRunning   ImportStatus = "running"
+	ImportCompleted ImportStatus = "completed"
+	ImportFailed    ImportStatus = "failed"
+)
+
+// Import - задача массового импорта пользователей из файла
+type Import struct {
+	ID     int64        `json:"id"`
+	Status ImportStatus `json:"status"`
+	Format string       `json:"format"`
+
+	// Всего строк в файле (без заголовка)
+	Total int `json:"total"`
+	// Обработано строк, включая отклоненные при разборе и валидации
+	Processed int `json:"processed"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+
+	// Причина, по которой задача целиком завершилась с ошибкой
+	Error string `json:"error,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	Errors []ImportRowError `json:"errors"`
+}
+
+// ImportRowError - ошибка обработки строки файла импорта. Row - номер строки в файле, начиная с 1
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportRow - строка файла импорта, прошедшая разбор
+type ImportRow struct {
+	Row     int
+	Payload SaveUserPayload
+}
+
+// CheckStatus - результат проверки зависимости
+type CheckStatus string
+
+const (
+	CheckOK      CheckStatus = "ok"
+	CheckFailing CheckStatus = "failing"
+	CheckUnknown CheckStatus = "unknown"
+)
+
+// Check - состояние одной зависимости в ответе /readyz
+type Check struct {
+	Status CheckStatus `json:"status"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// MigrationsCheck - версия схемы базы в сравнении с последней встроенной миграцией
+type MigrationsCheck struct {
+	Check
+	Version uint `json:"version"`
+	Latest  uint `json:"latest"`
+	Dirty   bool `json:"dirty"`
+}
+
+// Readiness - ответ /readyz. Ready - все проверки прошли, сервис можно включать в балансировку
+type Readiness struct {
+	Ready      bool             `json:"ready"`
+	Database   *Check           `json:"database,omitempty"`
+	Migrations *MigrationsCheck `json:"migrations,omitempty"`
+}
+
+// SourceStatus - доступность внешнего API обогащения по последним запросам к нему.
+// ErrorRate считается по окну из Window последних запросов
+type SourceStatus struct {
+	Name          string      `json:"name"`
+	URL           string      `json:"url"`
+	Status        CheckStatus `json:"status"`
+	Requests      int64       `json:"requests"`
+	Errors        int64       `json:"errors"`
+	Window        int         `json:"window"`
+	ErrorRate     float64     `json:"error_rate"`
+	LastSuccessAt *time.Time  `json:"last_success_at,omitempty"`
+	LastErrorAt   *time.Time  `json:"last_error_at,omitempty"`
+	LastError     string      `json:"last_error,omitempty"`
+}
+
+// CacheStatus - счетчики кэша результатов обогащения
+type CacheStatus struct {
+	Entries  int     `json:"entries"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// PoolStats - состояние пула соединений с Postgres
+type PoolStats struct {
+	MaxConns             int32         `json:"max_conns"`
+	TotalConns           int32         `json:"total_conns"`
+	AcquiredConns        int32         `json:"acquired_conns"`
+	IdleConns            int32         `json:"idle_conns"`
+	ConstructingConns    int32         `json:"constructing_conns"`
+	AcquireCount         int64         `json:"acquire_count"`
+	EmptyAcquireCount    int64         `json:"empty_acquire_count"`
+	CanceledAcquireCount int64         `json:"canceled_acquire_count"`
+	AcquireDuration      time.Duration `json:"acquire_duration"`
+	NewConnsCount        int64         `json:"new_conns_count"`
+}
+
+// EnrichmentStatus - состояние источников обогащения и кэша
+type EnrichmentStatus struct {
+	Sources []SourceStatus `json:"sources"`
+	Cache   CacheStatus    `json:"cache"`
+}
+
+// ServiceStatus - ответ /status
+type ServiceStatus struct {
+	Readiness
+	Enrichment EnrichmentStatus `json:"enrichment"`
+}
+
+// Role - набор разрешенных операций. Роли упорядочены: каждая следующая включает предыдущие
+type Role string
+
+const (
+	// RoleReader - чтение пользователей, статистики, выгрузки и задач импорта
+	RoleReader Role = "reader"
+	// RoleEditor - еще и добавление, изменение и импорт пользователей
+	RoleEditor Role = "editor"
+	// RoleAdmin - еще и удаление и восстановление
+	RoleAdmin Role = "admin"
+)
+
+// Roles - все роли по возрастанию прав
+var Roles = []Role{RoleReader, RoleEditor, RoleAdmin}
+
+// Allows сообщает, разрешены ли роли r операции, требующие роли required.
+// Пустая или неизвестная роль не разрешает ничего
+func (r Role) Allows(required Role) bool {
+	rank := r.rank()
+	return rank > 0 && rank >= required.rank()
+}
+
+// Valid сообщает, что r - одна из Roles
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// APIKey - ключ API. Сам ключ не хранится, KeyHash - его SHA-256 в hex
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Role       Role       `json:"role"`
+	KeyHash    string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Identity - аутентифицированный вызывающий
+type Identity struct {
+	// api_key или jwt
+	Method string `json:"method"`
+
+	// Имя ключа API или subject токена
+	Subject string `json:"subject"`
+
+	// Роль ключа или из claim токена. Пустая - вызывающий опознан, но прав у него нет
+	Role Role `json:"role,omitempty"`
+}
+
+// Actor возвращает инициатора действия для журнала аудита, например api_key:importer или jwt:alice
+func (i Identity) Actor() string {
+	return i.Method + ":" + i.Subject
+}
+
+// QuotaUsage - расход суточной квоты обогащения клиента
+type QuotaUsage struct {
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"github.com/sol1corejz/enricher/internal/services/auth"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"strings"
+)
+
+// headerAPIKey - альтернатива Authorization: Bearer для клиентов, которые не умеют его задавать
+const headerAPIKey = "X-API-Key"
+
+// Authenticate пропускает дальше только запросы с действующим ключом API или JWT в
+// Authorization: Bearer (или ключом в X-API-Key). Инициатор запроса попадает в аудит,
+// журнал и логи запроса
+func Authenticate(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("authService").(*auth.Auth)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
+	}
+
+	credential := bearerToken(ctx.Get(fiber.HeaderAuthorization))
+	if credential == "" {
+		credential = ctx.Get(headerAPIKey)
+	}
+	if credential == "" {
+		ctx.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="enricher"`)
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "authentication required",
+		})
+	}
+
+	identity, err := service.Authenticate(ctx.UserContext(), credential)
+	if err != nil {
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			ctx.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="enricher", error="invalid_token"`)
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid credentials",
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to authenticate",
+			"details": err.Error(),
+		})
+	}
+
+	ctx.Locals("identity", identity)
+
+	actor := identity.Actor()
+
+	userCtx := reqctx.WithActor(ctx.UserContext(), actor)
+	userCtx = reqctx.WithLogger(userCtx, reqctx.Logger(userCtx, slog.Default()).With(slog.String("actor", actor)))
+	ctx.SetUserContext(userCtx)
+
+	trace.SpanFromContext(userCtx).SetAttributes(attribute.String("enduser.id", actor))
+
+	return ctx.Next()
+}
+
+// RequireRole пропускает дальше только вызывающих с ролью не ниже required. Если
+// аутентификация выключена (сервиса нет), проверять нечего и запрос проходит
+func RequireRole(required models.Role) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if service, _ := ctx.Locals("authService").(*auth.Auth); service == nil {
+			return ctx.Next()
+		}
+
+		identity, ok := ctx.Locals("identity").(models.Identity)
+		if !ok {
+			ctx.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="enricher"`)
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "authentication required",
+			})
+		}
+
+		if !identity.Role.Allows(required) {
+			reqctx.Logger(ctx.UserContext(), slog.Default()).Info("access denied",
+				slog.String("role", string(identity.Role)),
+				slog.String("required_role", string(required)),
+			)
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":         "insufficient permissions",
+				"required_role": required,
+			})
+		}
+
+		return ctx.Next()
+	}
+}
+
+// bearerToken возвращает токен из заголовка Authorization со схемой Bearer
+func bearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/services/auth"
+	"github.com/sol1corejz/enricher/internal/storage/memory"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// newTestAuth возвращает сервис аутентификации с HS256 и ключами API по ролям
+func newTestAuth(t *testing.T) (*auth.Auth, map[models.Role]string) {
+	t.Helper()
+
+	service, err := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), memory.New(), auth.Config{HMACSecret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[models.Role]string{}
+	for _, role := range models.Roles {
+		key, _, err := service.CreateAPIKey(context.Background(), string(role), role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[role] = key
+	}
+
+	return service, keys
+}
+
+func signTestJWT(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// newAuthApp собирает приложение с сервисом аутентификации в Locals, как app.New. Эндпоинт
+// отвечает ролью вызывающего
+func newAuthApp(service *auth.Auth, handlers ...fiber.Handler) *fiber.App {
+	app := fiber.New()
+
+	app.Use(func(ctx *fiber.Ctx) error {
+		if service != nil {
+			ctx.Locals("authService", service)
+		}
+		return ctx.Next()
+	})
+
+	handlers = append(handlers, func(ctx *fiber.Ctx) error {
+		identity, _ := ctx.Locals("identity").(models.Identity)
+		return ctx.SendString(string(identity.Role))
+	})
+	app.Get("/", handlers...)
+
+	return app
+}
+
+func TestAuthenticate(t *testing.T) {
+	service, keys := newTestAuth(t)
+	app := newAuthApp(service, Authenticate)
+
+	tests := []struct {
+		name      string
+		header    string
+		value     string
+		status    int
+		challenge string
+		role      string
+	}{
+		{"no credentials", "", "", fiber.StatusUnauthorized, `Bearer realm="enricher"`, ""},
+		{"not bearer", fiber.HeaderAuthorization, "Basic " + keys[models.RoleAdmin], fiber.StatusUnauthorized, `Bearer realm="enricher"`, ""},
+		{"empty bearer", fiber.HeaderAuthorization, "Bearer ", fiber.StatusUnauthorized, `Bearer realm="enricher"`, ""},
+		{"unknown api key", fiber.HeaderAuthorization, "Bearer enr_unknown", fiber.StatusUnauthorized, `Bearer realm="enricher", error="invalid_token"`, ""},
+		{"unknown api key in header", headerAPIKey, "enr_unknown", fiber.StatusUnauthorized, `Bearer realm="enricher", error="invalid_token"`, ""},
+		{"malformed jwt", fiber.HeaderAuthorization, "Bearer not.a.jwt", fiber.StatusUnauthorized, `Bearer realm="enricher", error="invalid_token"`, ""},
+		{
+			"expired jwt",
+			fiber.HeaderAuthorization,
+			"Bearer " + signTestJWT(t, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()}),
+			fiber.StatusUnauthorized,
+			`Bearer realm="enricher", error="invalid_token"`,
+			"",
+		},
+		{"api key", fiber.HeaderAuthorization, "Bearer " + keys[models.RoleEditor], fiber.StatusOK, "", "editor"},
+		{"api key, lowercase scheme", fiber.HeaderAuthorization, "bearer " + keys[models.RoleReader], fiber.StatusOK, "", "reader"},
+		{"api key in header", headerAPIKey, keys[models.RoleAdmin], fiber.StatusOK, "", "admin"},
+		{"jwt", fiber.HeaderAuthorization, "Bearer " + signTestJWT(t, jwt.MapClaims{"sub": "alice", "role": "admin"}), fiber.StatusOK, "", "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", resp.StatusCode, tt.status, body)
+			}
+			if got := resp.Header.Get(fiber.HeaderWWWAuthenticate); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.challenge)
+			}
+			if tt.status == fiber.StatusOK && string(body) != tt.role {
+				t.Errorf("role = %q, want %q", body, tt.role)
+			}
+		})
+	}
+}
+
+func TestAuthenticateWithoutService(t *testing.T) {
+	resp, err := newAuthApp(nil, Authenticate).Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusInternalServerError)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	service, keys := newTestAuth(t)
+
+	tests := []struct {
+		name     string
+		required models.Role
+		token    string
+		status   int
+	}{
+		{"reader on reader route", models.RoleReader, keys[models.RoleReader], fiber.StatusOK},
+		{"reader on editor route", models.RoleEditor, keys[models.RoleReader], fiber.StatusForbidden},
+		{"editor on editor route", models.RoleEditor, keys[models.RoleEditor], fiber.StatusOK},
+		{"editor on admin route", models.RoleAdmin, keys[models.RoleEditor], fiber.StatusForbidden},
+		{"admin on admin route", models.RoleAdmin, keys[models.RoleAdmin], fiber.StatusOK},
+		{"admin on reader route", models.RoleReader, keys[models.RoleAdmin], fiber.StatusOK},
+		// Токен без известной роли опознается, но не получает никаких прав
+		{"jwt without role", models.RoleReader, signTestJWT(t, jwt.MapClaims{"sub": "alice"}), fiber.StatusForbidden},
+		{"jwt with unknown role", models.RoleReader, signTestJWT(t, jwt.MapClaims{"sub": "alice", "role": "owner"}), fiber.StatusForbidden},
+		{"jwt with role", models.RoleEditor, signTestJWT(t, jwt.MapClaims{"sub": "alice", "role": []string{"owner", "editor"}}), fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newAuthApp(service, Authenticate, RequireRole(tt.required))
+
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tt.token)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", resp.StatusCode, tt.status, body)
+			}
+			if tt.status == fiber.StatusForbidden && !strings.Contains(string(body), `"required_role":"`+string(tt.required)+`"`) {
+				t.Errorf("body = %s, want required_role %s", body, tt.required)
+			}
+		})
+	}
+}
+
+func TestRequireRoleWithoutIdentity(t *testing.T) {
+	service, _ := newTestAuth(t)
+
+	// Аутентификация включена, но вызывающий не опознан
+	resp, err := newAuthApp(service, RequireRole(models.RoleReader)).Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+
+	// Аутентификация выключена: проверять нечего
+	resp, err = newAuthApp(nil, RequireRole(models.RoleAdmin)).Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status without auth = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+}
@@ -1,24 +1,43 @@
 package handlers
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/export"
+	"github.com/sol1corejz/enricher/internal/lib/filterexpr"
+	"github.com/sol1corejz/enricher/internal/lib/importfile"
+	"github.com/sol1corejz/enricher/internal/lib/validate"
 	"github.com/sol1corejz/enricher/internal/services/enricher"
-	"net/http"
+	"io"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"unicode"
+	"time"
 )
 
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+
+	defaultTopCountries = 10
+	maxTopCountries     = 100
+	maxAgeBuckets       = 50
+)
+
+var defaultAgeBuckets = []int{18, 25, 35, 45, 55, 65}
+
 // DataWithFilters godoc
 // @Summary Get filtered users
 // @Description Retrieve users with optional filters
 // @Tags users
 // @Accept json
 // @Produce json
+// @Param q query string false "Full-name search with prefix matching, results are ranked"
 // @Param name query string false "Filter by name (partial match)"
 // @Param surname query string false "Filter by surname (partial match)"
 // @Param patronymic query string false "Filter by patronymic (partial match)"
@@ -26,12 +45,21 @@ import (
 // @Param ageTo query int false "Maximum age"
 // @Param sex query string false "Filter by sex (male/female)"
 // @Param country query string false "Filter by country code (partial match)"
+// @Param filter query string false "Boolean filter expression, e.g. (sex eq 'female' and age gt 30) or country in ('RU','KZ')"
+// @Param includeDeleted query bool false "Include soft-deleted users"
+// @Param asOf query string false "Return data as it was at this RFC 3339 time"
 // @Param limit query int false "Pagination limit (default 10)"
 // @Param offset query int false "Pagination offset"
 // @Success 200 {object} map[string]interface{} "Success response"
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router / [get]
+// @Router /users [get]
 func DataWithFilters(ctx *fiber.Ctx) error {
 	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
 	if !ok {
@@ -40,8 +68,36 @@ func DataWithFilters(ctx *fiber.Ctx) error {
 		})
 	}
 
+	filter, err := parseUserFilter(ctx)
+	if err != nil {
+		return userFilterError(ctx, err)
+	}
+
+	// Получаем данные с фильтрами
+	users, err := service.GetUsers(ctx.UserContext(), filter)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to get users",
+			"details": err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"count": len(users),
+		"users": users,
+	})
+}
+
+var (
+	errInvalidSex  = errors.New("invalid sex value, must be 'male' or 'female'")
+	errInvalidAsOf = errors.New("invalid asOf value, must be an RFC 3339 time like 2026-01-01T00:00:00Z")
+)
+
+// parseUserFilter собирает фильтр пользователей из query-параметров (общий для списка, статистики и выгрузки)
+func parseUserFilter(ctx *fiber.Ctx) (models.UserFilter, error) {
 	// Создаем фильтр из query-параметров
 	filter := models.UserFilter{
+		Search:     ctx.Query("q"),
 		Name:       ctx.Query("name"),
 		Surname:    ctx.Query("surname"),
 		Patronymic: ctx.Query("patronymic"),
@@ -63,9 +119,25 @@ func DataWithFilters(ctx *fiber.Ctx) error {
 	}
 
 	if filter.Sex != "" && filter.Sex != "male" && filter.Sex != "female" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid sex value, must be 'male' or 'female'",
-		})
+		return models.UserFilter{}, errInvalidSex
+	}
+
+	if expression := ctx.Query("filter"); expression != "" {
+		node, err := filterexpr.Parse(expression, models.UserFilterFields)
+		if err != nil {
+			return models.UserFilter{}, err
+		}
+		filter.Expression = node
+	}
+
+	filter.IncludeDeleted = ctx.QueryBool("includeDeleted")
+
+	if asOf := ctx.Query("asOf"); asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			return models.UserFilter{}, errInvalidAsOf
+		}
+		filter.AsOf = t
 	}
 
 	if limit := ctx.Query("limit"); limit != "" {
@@ -80,32 +152,274 @@ func DataWithFilters(ctx *fiber.Ctx) error {
 		}
 	}
 
-	// Получаем данные с фильтрами
-	users, err := service.GetUsers(ctx.Context(), filter)
+	return filter, nil
+}
+
+// userFilterError отвечает 400 на ошибку parseUserFilter. Для ошибок выражения filter
+// указываются позиция и токен, на котором споткнулся разбор
+func userFilterError(ctx *fiber.Ctx, err error) error {
+	var exprErr *filterexpr.Error
+	if !errors.As(err, &exprErr) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":    "invalid filter expression",
+		"details":  exprErr.Error(),
+		"position": exprErr.Pos,
+		"token":    exprErr.Token,
+	})
+}
+
+// Stats godoc
+// @Summary Aggregated user statistics
+// @Description Counts by sex, age histogram, top countries with average age. Accepts the same filters as the user list
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param q query string false "Full-name search with prefix matching"
+// @Param name query string false "Filter by name (partial match)"
+// @Param surname query string false "Filter by surname (partial match)"
+// @Param patronymic query string false "Filter by patronymic (partial match)"
+// @Param ageFrom query int false "Minimum age"
+// @Param ageTo query int false "Maximum age"
+// @Param sex query string false "Filter by sex (male/female)"
+// @Param country query string false "Filter by country code (partial match)"
+// @Param filter query string false "Boolean filter expression"
+// @Param includeDeleted query bool false "Include soft-deleted users"
+// @Param asOf query string false "Return data as it was at this RFC 3339 time"
+// @Param buckets query string false "Ascending age histogram boundaries (default 18,25,35,45,55,65)"
+// @Param top query int false "Number of top countries (default 10, max 100)"
+// @Success 200 {object} models.UserStats "Success response"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/stats [get]
+func Stats(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
+	}
+
+	filter, err := parseUserFilter(ctx)
+	if err != nil {
+		return userFilterError(ctx, err)
+	}
+
+	opts := models.StatsOptions{
+		AgeBuckets:   defaultAgeBuckets,
+		TopCountries: defaultTopCountries,
+	}
+
+	if buckets := ctx.Query("buckets"); buckets != "" {
+		opts.AgeBuckets, err = parseAgeBuckets(buckets)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "invalid buckets",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	if top := ctx.Query("top"); top != "" {
+		n, err := strconv.Atoi(top)
+		if err != nil || n < 1 || n > maxTopCountries {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("top must be an integer between 1 and %d", maxTopCountries),
+			})
+		}
+		opts.TopCountries = n
+	}
+
+	stats, err := service.GetUserStats(ctx.UserContext(), filter, opts)
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "failed to get users",
+			"error":   "failed to get user stats",
+			"details": err.Error(),
+		})
+	}
+
+	return ctx.JSON(stats)
+}
+
+// Export godoc
+// @Summary Export users
+// @Description Stream all users matching the filters as CSV, NDJSON or XLSX. Pagination parameters are ignored
+// @Tags users
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param format query string false "Export format: csv (default), ndjson or xlsx"
+// @Param q query string false "Full-name search with prefix matching"
+// @Param name query string false "Filter by name (partial match)"
+// @Param surname query string false "Filter by surname (partial match)"
+// @Param patronymic query string false "Filter by patronymic (partial match)"
+// @Param ageFrom query int false "Minimum age"
+// @Param ageTo query int false "Maximum age"
+// @Param sex query string false "Filter by sex (male/female)"
+// @Param country query string false "Filter by country code (partial match)"
+// @Param filter query string false "Boolean filter expression"
+// @Param includeDeleted query bool false "Include soft-deleted users"
+// @Param asOf query string false "Return data as it was at this RFC 3339 time"
+// @Success 200 {file} file "Exported users"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/export [get]
+func Export(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
+	}
+
+	filter, err := parseUserFilter(ctx)
+	if err != nil {
+		return userFilterError(ctx, err)
+	}
+
+	format, err := export.ParseFormat(ctx.Query("format", string(export.FormatCSV)))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Контекст запроса переиспользуется после выхода из обработчика, поэтому
+	// для выгрузки берутся только его значения
+	exportCtx := context.WithoutCancel(ctx.UserContext())
+
+	ctx.Set(fiber.HeaderContentType, format.ContentType())
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="users.%s"`, format))
+
+	// Тело пишется после выхода из обработчика, по мере чтения строк из курсора.
+	// Статус к этому моменту уже отправлен, поэтому ошибка посреди выгрузки
+	// только обрывает файл (и логируется сервисом)
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		writer, err := export.NewWriter(format, w)
+		if err != nil {
+			return
+		}
+
+		err = service.ExportUsers(exportCtx, filter, func(user models.EnrichedUser) error {
+			return writer.Write(user)
+		})
+		if err != nil {
+			return
+		}
+
+		if err := writer.Close(); err != nil {
+			return
+		}
+
+		_ = w.Flush()
+	})
+
+	return nil
+}
+
+// parseAgeBuckets разбирает границы корзин вида "18,30,45"
+func parseAgeBuckets(value string) ([]int, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) > maxAgeBuckets {
+		return nil, fmt.Errorf("too many boundaries (max %d)", maxAgeBuckets)
+	}
+
+	bounds := make([]int, 0, len(parts))
+	for _, part := range parts {
+		bound, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || bound <= 0 {
+			return nil, fmt.Errorf("boundary %q is not a positive integer", part)
+		}
+		if len(bounds) > 0 && bound <= bounds[len(bounds)-1] {
+			return nil, errors.New("boundaries must be strictly ascending")
+		}
+		bounds = append(bounds, bound)
+	}
+
+	return bounds, nil
+}
+
+// Suggest godoc
+// @Summary Autocomplete users by full name
+// @Description Suggest users whose full name matches the query by word prefixes or similarity
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param q query string true "Part of the full name, e.g. ivan pet"
+// @Param limit query int false "Maximum number of suggestions (default 10, max 50)"
+// @Success 200 {object} map[string]interface{} "Success response"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/suggest [get]
+func Suggest(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
+	}
+
+	query := strings.TrimSpace(ctx.Query("q"))
+	if query == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "query parameter 'q' is required",
+		})
+	}
+
+	limit := defaultSuggestLimit
+	if l, err := strconv.Atoi(ctx.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxSuggestLimit)
+	}
+
+	suggestions, err := service.SuggestUsers(ctx.UserContext(), query, limit)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to suggest users",
 			"details": err.Error(),
 		})
 	}
 
 	return ctx.JSON(fiber.Map{
-		"count": len(users),
-		"users": users,
+		"count":       len(suggestions),
+		"suggestions": suggestions,
 	})
 }
 
 // Delete godoc
 // @Summary Delete a user
-// @Description Delete user by ID
+// @Description Soft-delete user by ID. The user can be restored until purged
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param request body models.DeleteUserPayload true "Delete request"
 // @Success 200 {object} map[string]interface{} "Success response"
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
 // @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /delete [post]
 func Delete(ctx *fiber.Ctx) error {
 	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
@@ -124,8 +438,14 @@ func Delete(ctx *fiber.Ctx) error {
 		})
 	}
 
-	err = service.DeleteUser(context.Background(), payloadData.ID)
+	err = service.DeleteUser(ctx.UserContext(), payloadData.ID)
 	if err != nil {
+		if errors.Is(err, enricher.ErrUserNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
@@ -136,6 +456,171 @@ func Delete(ctx *fiber.Ctx) error {
 	})
 }
 
+// Restore godoc
+// @Summary Restore a deleted user
+// @Description Undo a soft delete. Restoring a user that is not deleted is a no-op
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Success response"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/restore [post]
+func Restore(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
+	}
+
+	id, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid user id",
+		})
+	}
+
+	user, err := service.RestoreUser(ctx.UserContext(), id)
+	if err != nil {
+		if errors.Is(err, enricher.ErrUserNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to restore user",
+			"details": err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "user restored",
+		"user":    user,
+	})
+}
+
+// GetUser godoc
+// @Summary Get a user
+// @Description Current user data, or the version that was valid at as_of
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Param as_of query string false "RFC 3339 time, e.g. 2026-01-01T00:00:00Z"
+// @Success 200 {object} map[string]interface{} "Success response"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id} [get]
+func GetUser(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
+	}
+
+	id, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid user id",
+		})
+	}
+
+	var user models.EnrichedUser
+	if asOf := ctx.Query("as_of"); asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid as_of value, must be an RFC 3339 time like 2026-01-01T00:00:00Z",
+			})
+		}
+
+		user, err = service.GetUserAsOf(ctx.UserContext(), id, t)
+	} else {
+		user, err = service.GetUser(ctx.UserContext(), id)
+	}
+	if err != nil {
+		if errors.Is(err, enricher.ErrUserNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to get user",
+			"details": err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"user": user,
+	})
+}
+
+// History godoc
+// @Summary User change history
+// @Description Audit log of creates, edits, deletes, restores and re-enrichments with before/after snapshots, oldest first
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Success response"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/history [get]
+func History(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
+	}
+
+	id, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid user id",
+		})
+	}
+
+	history, err := service.GetUserHistory(ctx.UserContext(), id)
+	if err != nil {
+		if errors.Is(err, enricher.ErrUserNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to get user history",
+			"details": err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"count":   len(history),
+		"history": history,
+	})
+}
+
 // Edit godoc
 // @Summary Update a user
 // @Description Update user information
@@ -145,8 +630,13 @@ func Delete(ctx *fiber.Ctx) error {
 // @Param request body models.EditUserPayload true "Update data"
 // @Success 200 {object} map[string]interface{} "Success response"
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
 // @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /edit [post]
 func Edit(ctx *fiber.Ctx) error {
 	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
@@ -164,29 +654,28 @@ func Edit(ctx *fiber.Ctx) error {
 		})
 	}
 
-	// Получаем текущие данные пользователя
-	existingUser, err := service.GetUser(ctx.Context(), payloadData.ID)
-	if err != nil {
-		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "user not found",
-			"details": err.Error(),
-		})
-	}
-
-	// Обновляем только те поля, которые пришли в запросе
-	if payloadData.Name != "" {
-		existingUser.Name = payloadData.Name
-	}
-	if payloadData.Surname != "" {
-		existingUser.Surname = payloadData.Surname
-	}
-	if payloadData.Patronymic != "" {
-		existingUser.Patronymic = payloadData.Patronymic
-	}
+	// Чтение и запись идут в одной транзакции с блокировкой строки
+	updatedUser, err := service.UpdateUser(ctx.UserContext(), payloadData.ID, func(user *models.EnrichedUser) error {
+		// Обновляем только те поля, которые пришли в запросе
+		if payloadData.Name != "" {
+			user.Name = payloadData.Name
+		}
+		if payloadData.Surname != "" {
+			user.Surname = payloadData.Surname
+		}
+		if payloadData.Patronymic != "" {
+			user.Patronymic = payloadData.Patronymic
+		}
 
-	// Сохраняем обновленные данные
-	updatedUser, err := service.EditUser(ctx.Context(), existingUser)
+		return nil
+	})
 	if err != nil {
+		if errors.Is(err, enricher.ErrUserNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   "failed to update user",
 			"details": err.Error(),
@@ -201,15 +690,20 @@ func Edit(ctx *fiber.Ctx) error {
 
 // Add godoc
 // @Summary Create a new user
-// @Description Add new user with data enrichment
+// @Description Add new user with data enrichment. When ENRICHMENT_DAILY_QUOTA is set, one enrichment is charged to the client's daily quota before the enrichment APIs are called and refunded if the user is not created (424 or 500)
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param request body models.SaveUserPayload true "User data"
 // @Success 201 {object} map[string]interface{} "User created"
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
 // @Failure 422 {object} map[string]interface{} "Validation error"
+// @Failure 429 {object} map[string]interface{} "Rate limit or daily enrichment quota exceeded"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /add [post]
 func Add(ctx *fiber.Ctx) error {
 	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
@@ -228,16 +722,24 @@ func Add(ctx *fiber.Ctx) error {
 	}
 
 	// Validate all name fields
-	if err := ValidateAllNames(payloadData.Name, payloadData.Surname, payloadData.Patronymic); err != nil {
+	if err := validate.Names(payloadData.Name, payloadData.Surname, payloadData.Patronymic); err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "invalid name format",
 			"details": err.Error(),
 		})
 	}
 
+	// Квота списывается до обращения к API обогащения, чтобы клиент сверх квоты его не вызывал,
+	// и возвращается, если пользователь так и не был добавлен
+	refundQuota, handled, err := consumeEnrichmentQuota(ctx, 1)
+	if handled {
+		return err
+	}
+
 	// Обогащаем данные
-	enrichedUser, err := enrichUserData(payloadData)
+	enrichedUser, err := service.Enrich(ctx.UserContext(), payloadData)
 	if err != nil {
+		refundQuota()
 		return ctx.Status(fiber.StatusFailedDependency).JSON(fiber.Map{
 			"error":   "failed to enrich user data",
 			"details": err.Error(),
@@ -245,8 +747,9 @@ func Add(ctx *fiber.Ctx) error {
 	}
 
 	// Сохраняем в базу
-	id, err := service.SaveUser(ctx.Context(), enrichedUser)
+	id, err := service.SaveUser(ctx.UserContext(), enrichedUser)
 	if err != nil {
+		refundQuota()
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   "failed to save user",
 			"details": err.Error(),
@@ -258,150 +761,187 @@ func Add(ctx *fiber.Ctx) error {
 	})
 }
 
-func enrichUserData(userData models.SaveUserPayload) (models.EnrichedUser, error) {
-	var enriched models.EnrichedUser
-	enriched.Name = userData.Name
-	enriched.Surname = userData.Surname
-	enriched.Patronymic = userData.Patronymic
-
-	// Получаем возраст
-	age, err := getAge(userData.Name)
-	if err != nil {
-		return models.EnrichedUser{}, fmt.Errorf("failed to get age: %w", err)
+// Import godoc
+// @Summary Bulk import users
+// @Description Upload a CSV (with header) or NDJSON file as multipart field "file" or as the raw body. Rows are validated immediately and enriched in the background; track progress via GET /imports/{id}. When ENRICHMENT_DAILY_QUOTA is set, every valid row is charged to the client's daily quota when the import is accepted (refunded if it is not started), including rows that later fail enrichment
+// @Tags imports
+// @Accept multipart/form-data
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param file formData file false "File to import"
+// @Param format query string false "csv or ndjson (default: from file extension or content type, otherwise csv)"
+// @Param nameColumn query string false "Column/key holding the name (default name)"
+// @Param surnameColumn query string false "Column/key holding the surname (default surname)"
+// @Param patronymicColumn query string false "Column/key holding the patronymic (default patronymic)"
+// @Success 202 {object} models.Import "Import job created"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 429 {object} map[string]interface{} "Rate limit or daily enrichment quota exceeded"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 503 {object} map[string]interface{} "Service is shutting down"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/import [post]
+func Import(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
 	}
-	enriched.Age = age
 
-	// Получаем пол
-	sex, err := getGender(userData.Name)
+	body, fileName, err := importBody(ctx)
 	if err != nil {
-		return models.EnrichedUser{}, fmt.Errorf("failed to get gender: %w", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "failed to read import file",
+			"details": err.Error(),
+		})
 	}
-	enriched.Sex = sex
 
-	// Получаем национальность
-	countries, err := getNationality(userData.Name)
+	format, err := importfile.ParseFormat(importFormat(ctx, fileName))
 	if err != nil {
-		return models.EnrichedUser{}, fmt.Errorf("failed to get nationality: %w", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
-	enriched.Country = countries
-
-	return enriched, nil
-}
 
-// Вспомогательные функции для запросов к API
+	mapping := importfile.DefaultMapping()
+	mapping.Name = ctx.Query("nameColumn", mapping.Name)
+	mapping.Surname = ctx.Query("surnameColumn", mapping.Surname)
+	mapping.Patronymic = ctx.Query("patronymicColumn", mapping.Patronymic)
 
-func getAge(name string) (int, error) {
-	resp, err := http.Get(fmt.Sprintf("https://api.agify.io/?name=%s", name))
+	rows, rejected, err := importfile.Parse(body, format, mapping)
 	if err != nil {
-		return 0, err
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "invalid import file",
+			"details": err.Error(),
+		})
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Age int `json:"age"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, err
+	valid := make([]models.ImportRow, 0, len(rows))
+	for _, row := range rows {
+		if err := validate.Names(row.Payload.Name, row.Payload.Surname, row.Payload.Patronymic); err != nil {
+			rejected = append(rejected, models.ImportRowError{Row: row.Row, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, row)
 	}
 
-	return result.Age, nil
-}
-
-func getGender(name string) (string, error) {
-	resp, err := http.Get(fmt.Sprintf("https://api.genderize.io/?name=%s", name))
-	if err != nil {
-		return "", err
+	// Квота списывается за весь файл сразу: импорт, не помещающийся в остаток, отклоняется целиком
+	refundQuota, handled, err := consumeEnrichmentQuota(ctx, len(valid))
+	if handled {
+		return err
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Gender string `json:"gender"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	imp, err := service.StartImport(ctx.UserContext(), string(format), valid, rejected)
+	if err != nil {
+		refundQuota()
+		if errors.Is(err, enricher.ErrShuttingDown) {
+			return ctx.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "service is shutting down, retry later",
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to start import",
+			"details": err.Error(),
+		})
 	}
 
-	return result.Gender, nil
+	return ctx.Status(fiber.StatusAccepted).JSON(imp)
 }
 
-func getNationality(name string) ([]models.Country, error) {
-	resp, err := http.Get(fmt.Sprintf("https://api.nationalize.io/?name=%s", name))
-	if err != nil {
-		return nil, err
+// importBody возвращает содержимое загруженного файла: поле "file" multipart-формы или тело запроса целиком
+func importBody(ctx *fiber.Ctx) (io.Reader, string, error) {
+	if !strings.HasPrefix(ctx.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		if len(ctx.Body()) == 0 {
+			return nil, "", errors.New("request body is empty")
+		}
+
+		return bytes.NewReader(ctx.Body()), "", nil
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Country []struct {
-			CountryID   string  `json:"country_id"`
-			Probability float64 `json:"probability"`
-		} `json:"country"`
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		return nil, "", err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, "", err
 	}
+	defer file.Close()
 
-	countries := make([]models.Country, len(result.Country))
-	for i, c := range result.Country {
-		countries[i] = models.Country{
-			CountryID:   c.CountryID,
-			Probability: c.Probability,
-		}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return countries, nil
+	return bytes.NewReader(data), fileHeader.Filename, nil
 }
 
-// validateNameField validates a single name field (first name, last name or patronymic)
-func validateNameField(fieldName, value string, required bool) error {
-	// Check if required field is empty
-	if required && strings.TrimSpace(value) == "" {
-		return fmt.Errorf("%s cannot be empty", fieldName)
+// importFormat определяет формат файла: явный параметр format, расширение файла или Content-Type
+func importFormat(ctx *fiber.Ctx, fileName string) string {
+	if format := ctx.Query("format"); format != "" {
+		return format
 	}
 
-	// Skip validation if field is not required and empty
-	if !required && strings.TrimSpace(value) == "" {
-		return nil
+	if ext := strings.TrimPrefix(filepath.Ext(fileName), "."); ext != "" {
+		return ext
 	}
 
-	// Check length
-	runes := []rune(value)
-	if len(runes) > 100 {
-		return fmt.Errorf("%s is too long (max 100 characters)", fieldName)
-	}
-
-	// Check each character
-	for i, r := range value {
-		switch {
-		case unicode.IsLetter(r):
-			continue
-		case r == ' ' || r == '-' || r == '\'':
-			// Check for leading/trailing special characters
-			if i == 0 || i == len(runes)-1 {
-				return fmt.Errorf("%s cannot start or end with special characters", fieldName)
-			}
-			// Check for consecutive special characters
-			if i > 0 && (r == rune(value[i-1])) {
-				return fmt.Errorf("%s cannot have consecutive special characters", fieldName)
-			}
-		default:
-			return fmt.Errorf("%s contains invalid characters - only letters, spaces, hyphens and apostrophes are allowed", fieldName)
-		}
+	if strings.Contains(ctx.Get(fiber.HeaderContentType), "ndjson") {
+		return string(importfile.FormatNDJSON)
 	}
 
-	return nil
+	return string(importfile.FormatCSV)
 }
 
-// ValidateAllNames validates all name fields at once
-func ValidateAllNames(firstName, lastName, patronymic string) error {
-	if err := validateNameField("first name", firstName, true); err != nil {
-		return err
+// GetImport godoc
+// @Summary Get import job
+// @Description Import progress and per-row error report
+// @Tags imports
+// @Produce json
+// @Param id path int true "Import ID"
+// @Success 200 {object} models.Import "Import job"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Import not found"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /imports/{id} [get]
+func GetImport(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("enricherService").(*enricher.Enricher)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
 	}
-	if err := validateNameField("last name", lastName, true); err != nil {
-		return err
+
+	id, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid import id",
+		})
 	}
-	if err := validateNameField("patronymic", patronymic, false); err != nil {
-		return err
+
+	imp, err := service.GetImport(ctx.UserContext(), id)
+	if err != nil {
+		if errors.Is(err, enricher.ErrImportNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "import not found",
+			})
+		}
+
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to get import",
+			"details": err.Error(),
+		})
 	}
-	return nil
+
+	return ctx.JSON(imp)
 }
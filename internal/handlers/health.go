@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/enricher/internal/services/health"
+	"time"
+)
+
+// readinessTimeout ограничивает проверки зависимостей, чтобы зависшая база не держала пробу
+const readinessTimeout = 2 * time.Second
+
+// Healthz godoc
+// @Summary Liveness probe
+// @Description Returns 200 while the process is able to serve HTTP requests; dependencies are not checked
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Alive"
+// @Router /healthz [get]
+func Healthz(ctx *fiber.Ctx) error {
+	return ctx.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// Readyz godoc
+// @Summary Readiness probe
+// @Description Checks that the database responds and its schema version matches the latest embedded migration
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.Readiness "Ready"
+// @Failure 503 {object} models.Readiness "Not ready"
+// @Router /readyz [get]
+func Readyz(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("healthService").(*health.Health)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx.UserContext(), readinessTimeout)
+	defer cancel()
+
+	readiness := service.Ready(checkCtx)
+	if !readiness.Ready {
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(readiness)
+	}
+
+	return ctx.JSON(readiness)
+}
+
+// Status godoc
+// @Summary Dependency status
+// @Description Readiness checks plus reachability and recent error rate of each enrichment source and the enrichment cache hit ratio. Always 200 once authorized. Requires the admin role
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.ServiceStatus "Status"
+// @Failure 401 {object} map[string]interface{} "Authentication required"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /status [get]
+func Status(ctx *fiber.Ctx) error {
+	service, ok := ctx.Locals("healthService").(*health.Health)
+	if !ok {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "service not available",
+		})
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx.UserContext(), readinessTimeout)
+	defer cancel()
+
+	return ctx.JSON(service.Status(checkCtx))
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/ratelimit"
+	"github.com/sol1corejz/enricher/internal/services/quota"
+	"strconv"
+	"time"
+)
+
+// consumeEnrichmentQuota списывает n обогащений с суточной квоты клиента и возвращает ее
+// состояние в заголовках X-Quota-*. Если квота исчерпана или ее не удалось проверить, ответ
+// уже записан: handled = true, и обработчик должен вернуть err. refund возвращает списанное,
+// если обогащение не состоялось. Без сервиса квот (квота не задана) ничего не делает
+func consumeEnrichmentQuota(ctx *fiber.Ctx, n int) (refund func(), handled bool, err error) {
+	refund = func() {}
+
+	service, _ := ctx.Locals("quotaService").(*quota.Quota)
+	if service == nil || n == 0 {
+		return refund, false, nil
+	}
+
+	client := ratelimit.Client(ctx)
+
+	usage, err := service.Consume(ctx.UserContext(), client, n)
+	if err != nil && !errors.Is(err, quota.ErrQuotaExceeded) {
+		return refund, true, ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to check enrichment quota",
+			"details": err.Error(),
+		})
+	}
+
+	setQuotaHeaders(ctx, usage)
+
+	if err != nil {
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(time.Until(usage.ResetsAt).Seconds())+1))
+		return refund, true, ctx.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":     "daily enrichment quota exceeded",
+			"requested": n,
+			"quota":     usage,
+		})
+	}
+
+	refund = func() {
+		// Ошибка возврата уже записана в лог сервисом: ответ из-за нее не меняется
+		if refunded, err := service.Refund(ctx.UserContext(), client, usage, n); err == nil {
+			setQuotaHeaders(ctx, refunded)
+		}
+	}
+
+	return refund, false, nil
+}
+
+func setQuotaHeaders(ctx *fiber.Ctx, usage models.QuotaUsage) {
+	ctx.Set("X-Quota-Limit", strconv.Itoa(usage.Limit))
+	ctx.Set("X-Quota-Remaining", strconv.Itoa(usage.Remaining))
+	ctx.Set("X-Quota-Reset", usage.ResetsAt.Format(time.RFC3339))
+}
@@ -0,0 +1,137 @@
+// Package journal ведет журнал изменяющих API-запросов в формате JSONL
+// (одна запись на строку) и читает его для воспроизведения (cmd/replay)
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry - запрос и ответ на него. Тела в формате JSON хранятся как есть (Body, Response),
+// остальные (например, загруженные CSV) - в base64 (BodyRaw, ResponseRaw)
+type Entry struct {
+	Time        time.Time       `json:"time"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Query       string          `json:"query,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	RequestID   string          `json:"request_id,omitempty"`
+	Actor       string          `json:"actor,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	BodyRaw     []byte          `json:"body_raw,omitempty"`
+	Status      int             `json:"status"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	ResponseRaw []byte          `json:"response_raw,omitempty"`
+	DurationMS  int64           `json:"duration_ms"`
+}
+
+// SetBody сохраняет тело запроса в подходящем поле
+func (e *Entry) SetBody(body []byte) {
+	e.Body, e.BodyRaw = split(body)
+}
+
+// SetResponse сохраняет тело ответа в подходящем поле
+func (e *Entry) SetResponse(body []byte) {
+	e.Response, e.ResponseRaw = split(body)
+}
+
+// RequestBody возвращает тело запроса независимо от того, в каком поле оно сохранено
+func (e *Entry) RequestBody() []byte {
+	if len(e.Body) > 0 {
+		return e.Body
+	}
+
+	return e.BodyRaw
+}
+
+func split(body []byte) (json.RawMessage, []byte) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	// Копируем: буферы fiber переиспользуются после завершения запроса
+	data := append([]byte(nil), body...)
+	if json.Valid(data) {
+		return data, nil
+	}
+
+	return nil, data
+}
+
+// Writer дописывает записи в конец файла; безопасен для конкурентного использования
+type Writer struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func Open(path string) (*Writer, error) {
+	const op = "journal.Open"
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Writer{file: file}, nil
+}
+
+func (w *Writer) Write(entry Entry) error {
+	const op = "journal.Write"
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Запись одной строки одним вызовом, чтобы строки не перемешивались
+	if _, err := w.file.Write(line); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
+
+// Read вызывает fn для каждой записи журнала по порядку. Пустые строки пропускаются
+func Read(r io.Reader, fn func(line int, entry Entry) error) error {
+	const op = "journal.Read"
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("%s: line %d: %w", op, line, err)
+		}
+
+		if err := fn(line, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package journal
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"log/slog"
+	"time"
+)
+
+// Middleware записывает в журнал все изменяющие запросы (POST, PUT, PATCH, DELETE)
+// вместе с ответом. Ошибка записи в журнал логируется и не влияет на ответ клиенту
+func Middleware(log *slog.Logger, w *Writer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !mutating(c.Method()) {
+			return c.Next()
+		}
+
+		start := time.Now()
+
+		err := c.Next()
+		if err != nil {
+			// Отдаем ошибку обработчику ошибок fiber сейчас, чтобы записать итоговый ответ
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+			err = nil
+		}
+
+		entry := Entry{
+			Time:        start.UTC(),
+			Method:      c.Method(),
+			Path:        c.Path(),
+			Query:       string(c.Request().URI().QueryString()),
+			ContentType: c.Get(fiber.HeaderContentType),
+			RequestID:   reqctx.RequestID(c.UserContext()),
+			Actor:       reqctx.Actor(c.UserContext()),
+			Status:      c.Response().StatusCode(),
+			DurationMS:  time.Since(start).Milliseconds(),
+		}
+		entry.SetBody(c.Body())
+		entry.SetResponse(c.Response().Body())
+
+		if writeErr := w.Write(entry); writeErr != nil {
+			log.Error("failed to write journal entry", slog.String("error", writeErr.Error()))
+		}
+
+		return err
+	}
+}
+
+func mutating(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
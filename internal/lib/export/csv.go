@@ -0,0 +1,57 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"io"
+)
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(user models.EnrichedUser) error {
+	if !c.headerWritten {
+		if err := c.w.Write(columns); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	return c.w.Write(record(user))
+}
+
+func (c *csvWriter) Close() error {
+	if !c.headerWritten {
+		if err := c.w.Write(columns); err != nil {
+			return err
+		}
+	}
+
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}
+}
+
+// Write пишет пользователя одной строкой JSON; Encoder сам добавляет перевод строки
+func (n *ndjsonWriter) Write(user models.EnrichedUser) error {
+	return n.enc.Encode(user)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,95 @@
+// Package export пишет пользователей в потоковом режиме в CSV, NDJSON и XLSX
+package export
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"io"
+	"strconv"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	FormatXLSX   Format = "xlsx"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format, must be one of: csv, ndjson, xlsx")
+
+// Writer записывает пользователей по одному. Close дописывает хвост формата
+// (для XLSX - завершает архив), но не закрывает нижележащий io.Writer
+type Writer interface {
+	Write(user models.EnrichedUser) error
+	Close() error
+}
+
+func ParseFormat(value string) (Format, error) {
+	switch Format(value) {
+	case FormatCSV, FormatNDJSON, FormatXLSX:
+		return Format(value), nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// columns - колонки табличных форматов (CSV, XLSX)
+var columns = []string{
+	"id",
+	"name",
+	"surname",
+	"patronymic",
+	"age",
+	"sex",
+	"primary_country",
+	"primary_country_name",
+	"primary_country_probability",
+}
+
+// record раскладывает пользователя по columns
+func record(user models.EnrichedUser) []string {
+	var country, countryName, probability string
+	if user.PrimaryCountry != nil {
+		country = user.PrimaryCountry.CountryID
+		countryName = user.PrimaryCountry.Name
+		probability = strconv.FormatFloat(user.PrimaryCountry.Probability, 'f', -1, 64)
+	}
+
+	return []string{
+		strconv.FormatInt(user.ID, 10),
+		user.Name,
+		user.Surname,
+		user.Patronymic,
+		strconv.Itoa(user.Age),
+		user.Sex,
+		country,
+		countryName,
+		probability,
+	}
+}
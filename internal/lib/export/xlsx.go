@@ -0,0 +1,153 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"io"
+	"strconv"
+)
+
+// xlsxMaxRows - предел строк листа Excel (включая строку заголовка)
+const xlsxMaxRows = 1048576
+
+var ErrTooManyRows = errors.New("xlsx: sheet row limit exceeded")
+
+// Минимальный набор частей SpreadsheetML, необходимый для открытия книги.
+// Лист пишется inline-строками, поэтому sharedStrings не нужен и весь файл
+// формируется за один проход без буферизации строк
+var xlsxStaticParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="users" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+const (
+	xlsxSheetHeader = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+// numericColumns - индексы колонок из columns, которые пишутся числами
+var numericColumns = map[int]bool{0: true, 4: true, 8: true}
+
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	rows  int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+
+	for _, part := range xlsxStaticParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// Лист - последняя запись архива, она остается открытой до Close
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, xlsxSheetHeader); err != nil {
+		return nil, err
+	}
+
+	x := &xlsxWriter{zip: zw, sheet: sheet}
+	if err := x.writeRow(columns, nil); err != nil {
+		return nil, err
+	}
+
+	return x, nil
+}
+
+func (x *xlsxWriter) Write(user models.EnrichedUser) error {
+	if x.rows >= xlsxMaxRows {
+		return ErrTooManyRows
+	}
+
+	return x.writeRow(record(user), numericColumns)
+}
+
+func (x *xlsxWriter) writeRow(values []string, numeric map[int]bool) error {
+	x.rows++
+
+	buf := make([]byte, 0, 512)
+	buf = append(buf, `<row r="`...)
+	buf = strconv.AppendInt(buf, int64(x.rows), 10)
+	buf = append(buf, `">`...)
+
+	for i, value := range values {
+		// Пустые ячейки пропускаются, поэтому у каждой ячейки явно указан адрес (A1, B1, ...)
+		if value == "" {
+			continue
+		}
+
+		buf = append(buf, `<c r="`...)
+		buf = append(buf, byte('A'+i))
+		buf = strconv.AppendInt(buf, int64(x.rows), 10)
+
+		if numeric[i] {
+			buf = append(buf, `"><v>`...)
+			buf = append(buf, value...)
+			buf = append(buf, `</v></c>`...)
+			continue
+		}
+
+		buf = append(buf, `" t="inlineStr"><is><t xml:space="preserve">`...)
+		buf = appendEscaped(buf, value)
+		buf = append(buf, `</t></is></c>`...)
+	}
+
+	buf = append(buf, `</row>`...)
+
+	_, err := x.sheet.Write(buf)
+
+	return err
+}
+
+func (x *xlsxWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, xlsxSheetFooter); err != nil {
+		return err
+	}
+
+	return x.zip.Close()
+}
+
+type byteAppender struct {
+	buf []byte
+}
+
+func (b *byteAppender) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func appendEscaped(buf []byte, value string) []byte {
+	a := &byteAppender{buf: buf}
+	// EscapeText заменяет недопустимые в XML символы на U+FFFD
+	_ = xml.EscapeText(a, []byte(value))
+
+	return a.buf
+}
@@ -0,0 +1,100 @@
+// Package filterexpr реализует язык булевых выражений для фильтрации записей, например:
+//
+//	(sex eq 'female' and age gt 30) or country in ('RU','KZ')
+//
+// Выражение разбирается в AST с проверкой полей и типов значений по схеме,
+// после чего компилируется в параметризованное SQL-условие (см. ToSQL)
+// или вычисляется над записью в памяти (см. Match).
+package filterexpr
+
+// Type - тип значения поля
+type Type int
+
+const (
+	String Type = iota
+	Int
+	// Int32 - целое в диапазоне 32-битной колонки (INTEGER в Postgres). Значения таких полей
+	// разбираются в Value с типом Int, но числа вне диапазона отклоняются при разборе
+	Int32
+)
+
+func (t Type) String() string {
+	if t == Int || t == Int32 {
+		return "integer"
+	}
+
+	return "string"
+}
+
+// Fields - схема допустимых в выражении полей и их типов
+type Fields map[string]Type
+
+// Op - оператор сравнения
+type Op string
+
+const (
+	OpEq       Op = "eq"
+	OpNe       Op = "ne"
+	OpGt       Op = "gt"
+	OpGe       Op = "ge"
+	OpLt       Op = "lt"
+	OpLe       Op = "le"
+	OpIn       Op = "in"
+	OpContains Op = "contains"
+)
+
+var operators = map[string]Op{
+	"eq":       OpEq,
+	"ne":       OpNe,
+	"gt":       OpGt,
+	"ge":       OpGe,
+	"lt":       OpLt,
+	"le":       OpLe,
+	"in":       OpIn,
+	"contains": OpContains,
+}
+
+// Node - узел разобранного выражения: *And, *Or, *Not или *Comparison
+type Node interface {
+	node()
+}
+
+type And struct {
+	Left, Right Node
+}
+
+type Or struct {
+	Left, Right Node
+}
+
+type Not struct {
+	Expr Node
+}
+
+// Comparison - сравнение поля с одним значением или, для оператора in, со списком значений
+type Comparison struct {
+	Field  string
+	Op     Op
+	Values []Value
+}
+
+// Value - литерал выражения. Для Type == Int заполнено Int, для String - Str
+type Value struct {
+	Type Type
+	Str  string
+	Int  int64
+}
+
+// Any возвращает значение литерала в виде string или int64
+func (v Value) Any() any {
+	if v.Type == Int {
+		return v.Int
+	}
+
+	return v.Str
+}
+
+func (*And) node()        {}
+func (*Or) node()         {}
+func (*Not) node()        {}
+func (*Comparison) node() {}
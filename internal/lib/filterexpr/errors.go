@@ -0,0 +1,20 @@
+package filterexpr
+
+import "fmt"
+
+// Error описывает ошибку разбора выражения с указанием проблемного токена
+type Error struct {
+	// Позиция токена в выражении (в символах, начиная с 1)
+	Pos int
+	// Текст токена или "end of input"
+	Token string
+	Msg   string
+}
+
+func newError(pos int, token string, msg string) *Error {
+	return &Error{Pos: pos, Token: token, Msg: msg}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d near %q", e.Msg, e.Pos, e.Token)
+}
@@ -0,0 +1,152 @@
+package filterexpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Record возвращает значение поля записи. ok == false означает NULL
+type Record func(field string) (value Value, ok bool)
+
+// Match вычисляет выражение над записью в памяти с той же семантикой, что и ToSQL:
+// трехзначная логика для NULL (запись подходит, только если результат true),
+// contains - регистронезависимый поиск подстроки, строки сравниваются побайтно
+// (как при сортировке "C")
+func Match(node Node, record Record) (bool, error) {
+	result, err := eval(node, record)
+	if err != nil {
+		return false, err
+	}
+
+	return result == truthTrue, nil
+}
+
+// truth - значение трехзначной логики SQL
+type truth int8
+
+const (
+	truthFalse truth = iota
+	truthTrue
+	truthUnknown
+)
+
+func eval(node Node, record Record) (truth, error) {
+	switch n := node.(type) {
+	case *And:
+		l, err := eval(n.Left, record)
+		if err != nil {
+			return truthFalse, err
+		}
+		r, err := eval(n.Right, record)
+		if err != nil {
+			return truthFalse, err
+		}
+
+		switch {
+		case l == truthFalse || r == truthFalse:
+			return truthFalse, nil
+		case l == truthUnknown || r == truthUnknown:
+			return truthUnknown, nil
+		default:
+			return truthTrue, nil
+		}
+	case *Or:
+		l, err := eval(n.Left, record)
+		if err != nil {
+			return truthFalse, err
+		}
+		r, err := eval(n.Right, record)
+		if err != nil {
+			return truthFalse, err
+		}
+
+		switch {
+		case l == truthTrue || r == truthTrue:
+			return truthTrue, nil
+		case l == truthUnknown || r == truthUnknown:
+			return truthUnknown, nil
+		default:
+			return truthFalse, nil
+		}
+	case *Not:
+		t, err := eval(n.Expr, record)
+		if err != nil {
+			return truthFalse, err
+		}
+
+		switch t {
+		case truthTrue:
+			return truthFalse, nil
+		case truthFalse:
+			return truthTrue, nil
+		default:
+			return truthUnknown, nil
+		}
+	case *Comparison:
+		return compare(n, record)
+	default:
+		return truthFalse, fmt.Errorf("filterexpr: unsupported node %T", node)
+	}
+}
+
+func compare(n *Comparison, record Record) (truth, error) {
+	value, ok := record(n.Field)
+	if !ok {
+		return truthUnknown, nil
+	}
+
+	switch n.Op {
+	case OpIn:
+		for _, v := range n.Values {
+			if cmp(value, v) == 0 {
+				return truthTrue, nil
+			}
+		}
+
+		return truthFalse, nil
+	case OpContains:
+		return toTruth(strings.Contains(strings.ToLower(value.Str), strings.ToLower(n.Values[0].Str))), nil
+	}
+
+	c := cmp(value, n.Values[0])
+
+	switch n.Op {
+	case OpEq:
+		return toTruth(c == 0), nil
+	case OpNe:
+		return toTruth(c != 0), nil
+	case OpGt:
+		return toTruth(c > 0), nil
+	case OpGe:
+		return toTruth(c >= 0), nil
+	case OpLt:
+		return toTruth(c < 0), nil
+	case OpLe:
+		return toTruth(c <= 0), nil
+	default:
+		return truthFalse, fmt.Errorf("filterexpr: unsupported operator %q", n.Op)
+	}
+}
+
+func cmp(a, b Value) int {
+	if a.Type == Int {
+		switch {
+		case a.Int < b.Int:
+			return -1
+		case a.Int > b.Int:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(a.Str, b.Str)
+}
+
+func toTruth(b bool) truth {
+	if b {
+		return truthTrue
+	}
+
+	return truthFalse
+}
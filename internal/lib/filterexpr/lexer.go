@@ -0,0 +1,113 @@
+package filterexpr
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// значение строкового литерала без кавычек
+	value string
+	// позиция первого символа токена (в символах, начиная с 1)
+	pos int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of input"
+	}
+
+	return t.text
+}
+
+// keyword возвращает идентификатор в нижнем регистре, так как ключевые слова регистронезависимы
+func (t token) keyword() string {
+	if t.kind != tokenIdent {
+		return ""
+	}
+
+	return strings.ToLower(t.text)
+}
+
+// isDigit принимает только цифры ASCII: unicode.IsDigit пропустил бы, например, арабские
+// цифры, которые затем не разобрал бы strconv
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+func tokenize(input string) ([]token, error) {
+	runes := []rune(input)
+	tokens := make([]token, 0, len(runes)/2)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: start + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: start + 1})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: start + 1})
+			i++
+		case r == '\'':
+			var value strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, newError(start+1, string(runes[start:]), "unterminated string literal")
+				}
+				if runes[i] == '\'' {
+					// '' внутри литерала - экранированная кавычка
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						value.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				value.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[start:i]), value: value.String(), pos: start + 1})
+		case isDigit(r) || (r == '-' && i+1 < len(runes) && isDigit(runes[i+1])):
+			i++
+			for i < len(runes) && isDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), pos: start + 1})
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || isDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), pos: start + 1})
+		default:
+			return nil, newError(start+1, string(r), "unexpected character")
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes) + 1})
+
+	return tokens, nil
+}
@@ -0,0 +1,76 @@
+package filterexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []token
+	}{
+		{
+			name:  "comparison",
+			input: "age ge 18",
+			want: []token{
+				{kind: tokenIdent, text: "age", pos: 1},
+				{kind: tokenIdent, text: "ge", pos: 5},
+				{kind: tokenNumber, text: "18", pos: 8},
+				{kind: tokenEOF, pos: 10},
+			},
+		},
+		{
+			name:  "list with negative number",
+			input: "id in(-1,2)",
+			want: []token{
+				{kind: tokenIdent, text: "id", pos: 1},
+				{kind: tokenIdent, text: "in", pos: 4},
+				{kind: tokenLParen, text: "(", pos: 6},
+				{kind: tokenNumber, text: "-1", pos: 7},
+				{kind: tokenComma, text: ",", pos: 9},
+				{kind: tokenNumber, text: "2", pos: 10},
+				{kind: tokenRParen, text: ")", pos: 11},
+				{kind: tokenEOF, pos: 12},
+			},
+		},
+		{
+			name:  "escaped quote",
+			input: "name eq 'O''Brien'",
+			want: []token{
+				{kind: tokenIdent, text: "name", pos: 1},
+				{kind: tokenIdent, text: "eq", pos: 6},
+				{kind: tokenString, text: "'O''Brien'", value: "O'Brien", pos: 9},
+				{kind: tokenEOF, pos: 19},
+			},
+		},
+		{
+			// Позиции считаются в символах, а не в байтах
+			name:  "unicode",
+			input: "'Пётр' x",
+			want: []token{
+				{kind: tokenString, text: "'Пётр'", value: "Пётр", pos: 1},
+				{kind: tokenIdent, text: "x", pos: 8},
+				{kind: tokenEOF, pos: 9},
+			},
+		},
+		{
+			name:  "empty",
+			input: "  ",
+			want:  []token{{kind: tokenEOF, pos: 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tokenize(tt.input)
+			if err != nil {
+				t.Fatalf("tokenize(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("tokenize(%q):\ngot  %+v\nwant %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
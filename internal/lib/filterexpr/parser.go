@@ -0,0 +1,258 @@
+package filterexpr
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	// MaxLength - максимальная длина выражения в символах
+	MaxLength = 2000
+	// MaxDepth - максимальная вложенность скобок и операторов not
+	MaxDepth = 32
+	// MaxInValues - максимальное количество значений в списке оператора in
+	MaxInValues = 100
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+	fields Fields
+	depth  int
+}
+
+// Parse разбирает выражение и проверяет его по схеме полей.
+// Ошибки разбора возвращаются как *Error
+func Parse(input string, fields Fields) (Node, error) {
+	if n := utf8.RuneCountInString(input); n > MaxLength {
+		return nil, newError(MaxLength+1, "", fmt.Sprintf("expression is too long (max %d characters)", MaxLength))
+	}
+
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, fields: fields}
+
+	if p.peek().kind == tokenEOF {
+		return nil, p.errorf(p.peek(), "empty expression")
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "expected 'and', 'or' or end of expression")
+	}
+
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) *Error {
+	return newError(tok.pos, tok.String(), fmt.Sprintf(format, args...))
+}
+
+func (p *parser) enter(tok token) error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return p.errorf(tok, "expression is nested too deeply (max %d levels)", MaxDepth)
+	}
+
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+// parseOr: and_expr ('or' and_expr)*
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().keyword() == "or" {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &Or{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+// parseAnd: unary ('and' unary)*
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().keyword() == "and" {
+		p.next()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &And{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+// parseUnary: 'not' unary | '(' or_expr ')' | comparison
+func (p *parser) parseUnary() (Node, error) {
+	tok := p.peek()
+
+	switch {
+	case tok.keyword() == "not":
+		p.next()
+		if err := p.enter(tok); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &Not{Expr: expr}, nil
+	case tok.kind == tokenLParen:
+		p.next()
+		if err := p.enter(tok); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "expected ')'")
+		}
+
+		return expr, nil
+	default:
+		return p.parseComparison()
+	}
+}
+
+// parseComparison: field op value | field 'in' '(' value (',' value)* ')'
+func (p *parser) parseComparison() (Node, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokenIdent {
+		return nil, p.errorf(fieldTok, "expected field name")
+	}
+
+	fieldType, ok := p.fields[fieldTok.keyword()]
+	if !ok {
+		return nil, p.errorf(fieldTok, "unknown field")
+	}
+
+	opTok := p.next()
+	op, ok := operators[opTok.keyword()]
+	if !ok {
+		return nil, p.errorf(opTok, "expected operator (eq, ne, gt, ge, lt, le, in, contains)")
+	}
+
+	if op == OpContains && fieldType != String {
+		return nil, p.errorf(opTok, "operator 'contains' is only supported for string fields")
+	}
+
+	cmp := &Comparison{Field: fieldTok.keyword(), Op: op}
+
+	if op != OpIn {
+		value, err := p.parseValue(fieldType)
+		if err != nil {
+			return nil, err
+		}
+
+		cmp.Values = []Value{value}
+
+		return cmp, nil
+	}
+
+	if open := p.next(); open.kind != tokenLParen {
+		return nil, p.errorf(open, "expected '(' after 'in'")
+	}
+
+	for {
+		valueTok := p.peek()
+
+		value, err := p.parseValue(fieldType)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(cmp.Values) == MaxInValues {
+			return nil, p.errorf(valueTok, "too many values in list (max %d)", MaxInValues)
+		}
+		cmp.Values = append(cmp.Values, value)
+
+		sep := p.next()
+		if sep.kind == tokenRParen {
+			break
+		}
+		if sep.kind != tokenComma {
+			return nil, p.errorf(sep, "expected ',' or ')'")
+		}
+	}
+
+	return cmp, nil
+}
+
+func (p *parser) parseValue(fieldType Type) (Value, error) {
+	tok := p.next()
+
+	switch fieldType {
+	case Int, Int32:
+		if tok.kind != tokenNumber {
+			return Value{}, p.errorf(tok, "expected integer value")
+		}
+
+		bitSize := 64
+		if fieldType == Int32 {
+			bitSize = 32
+		}
+
+		n, err := strconv.ParseInt(tok.text, 10, bitSize)
+		if err != nil {
+			return Value{}, p.errorf(tok, "integer value out of range")
+		}
+
+		return Value{Type: Int, Int: n}, nil
+	default:
+		if tok.kind != tokenString {
+			return Value{}, p.errorf(tok, "expected quoted string value")
+		}
+
+		return Value{Type: String, Str: tok.value}, nil
+	}
+}
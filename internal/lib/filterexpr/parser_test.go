@@ -0,0 +1,113 @@
+package filterexpr
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testFields = Fields{
+	"id":      Int,
+	"age":     Int32,
+	"name":    String,
+	"sex":     String,
+	"country": String,
+}
+
+func TestParse(t *testing.T) {
+	age := func(op Op, values ...int64) *Comparison {
+		cmp := &Comparison{Field: "age", Op: op}
+		for _, v := range values {
+			cmp.Values = append(cmp.Values, Value{Type: Int, Int: v})
+		}
+		return cmp
+	}
+	name := func(op Op, value string) *Comparison {
+		return &Comparison{Field: "name", Op: op, Values: []Value{{Type: String, Str: value}}}
+	}
+
+	tests := []struct {
+		input string
+		want  Node
+	}{
+		{"age gt 30", age(OpGt, 30)},
+		{"AGE Le -5", age(OpLe, -5)},
+		{"age in (1, 2,3)", age(OpIn, 1, 2, 3)},
+		{"age eq 2147483647", age(OpEq, 2147483647)},
+		{"age eq -2147483648", age(OpEq, -2147483648)},
+		{"id eq 9223372036854775807", &Comparison{Field: "id", Op: OpEq, Values: []Value{{Type: Int, Int: 9223372036854775807}}}},
+		{"name contains 'O''Brien'", name(OpContains, "O'Brien")},
+		// and связывает сильнее or
+		{"name eq 'a' or name eq 'b' and age eq 1", &Or{
+			Left:  name(OpEq, "a"),
+			Right: &And{Left: name(OpEq, "b"), Right: age(OpEq, 1)},
+		}},
+		{"(name eq 'a' or name eq 'b') and age eq 1", &And{
+			Left:  &Or{Left: name(OpEq, "a"), Right: name(OpEq, "b")},
+			Right: age(OpEq, 1),
+		}},
+		{"not not age eq 1", &Not{Expr: &Not{Expr: age(OpEq, 1)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input, testFields)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse(%q): got %#v, want %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tooManyValues := "age in (" + strings.Repeat("1, ", MaxInValues) + "1)"
+	tooDeep := strings.Repeat("not ", MaxDepth+1) + "age eq 1"
+
+	tests := []struct {
+		name  string
+		input string
+		want  Error
+	}{
+		{"too long", strings.Repeat(" ", MaxLength+1), Error{Pos: MaxLength + 1, Token: "", Msg: "expression is too long (max 2000 characters)"}},
+		{"empty", "  ", Error{Pos: 3, Token: "end of input", Msg: "empty expression"}},
+		{"unexpected character", "age > 3", Error{Pos: 5, Token: ">", Msg: "unexpected character"}},
+		{"non-ASCII digit", "age eq ٣", Error{Pos: 8, Token: "٣", Msg: "unexpected character"}},
+		{"unterminated string", "name eq 'abc", Error{Pos: 9, Token: "'abc", Msg: "unterminated string literal"}},
+		{"trailing token", "age eq 1 age", Error{Pos: 10, Token: "age", Msg: "expected 'and', 'or' or end of expression"}},
+		{"too deep", tooDeep, Error{Pos: MaxDepth*4 + 1, Token: "not", Msg: "expression is nested too deeply (max 32 levels)"}},
+		{"unclosed paren", "(age eq 1", Error{Pos: 10, Token: "end of input", Msg: "expected ')'"}},
+		{"no field", "1 eq 1", Error{Pos: 1, Token: "1", Msg: "expected field name"}},
+		{"unknown field", "age eq 1 or height gt 1", Error{Pos: 13, Token: "height", Msg: "unknown field"}},
+		{"unknown operator", "age is 1", Error{Pos: 5, Token: "is", Msg: "expected operator (eq, ne, gt, ge, lt, le, in, contains)"}},
+		{"missing operator", "age", Error{Pos: 4, Token: "end of input", Msg: "expected operator (eq, ne, gt, ge, lt, le, in, contains)"}},
+		{"contains on integer", "age contains 1", Error{Pos: 5, Token: "contains", Msg: "operator 'contains' is only supported for string fields"}},
+		{"string for integer", "age eq '1'", Error{Pos: 8, Token: "'1'", Msg: "expected integer value"}},
+		{"int32 overflow", "age gt 3000000000", Error{Pos: 8, Token: "3000000000", Msg: "integer value out of range"}},
+		{"int32 underflow", "age gt -2147483649", Error{Pos: 8, Token: "-2147483649", Msg: "integer value out of range"}},
+		{"int64 overflow", "id eq 9223372036854775808", Error{Pos: 7, Token: "9223372036854775808", Msg: "integer value out of range"}},
+		{"number for string", "name eq 1", Error{Pos: 9, Token: "1", Msg: "expected quoted string value"}},
+		{"in without list", "country in 'RU'", Error{Pos: 12, Token: "'RU'", Msg: "expected '(' after 'in'"}},
+		{"in missing comma", "country in ('RU' 'KZ')", Error{Pos: 18, Token: "'KZ'", Msg: "expected ',' or ')'"}},
+		{"in unclosed", "country in ('RU'", Error{Pos: 17, Token: "end of input", Msg: "expected ',' or ')'"}},
+		{"too many values", tooManyValues, Error{Pos: 9 + MaxInValues*3, Token: "1", Msg: "too many values in list (max 100)"}},
+		{"unicode position", "name eq 'Пётр' and x eq 1", Error{Pos: 20, Token: "x", Msg: "unknown field"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input, testFields)
+
+			var parseErr *Error
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse(%q): got error %v, want *Error", tt.input, err)
+			}
+			if *parseErr != tt.want {
+				t.Fatalf("Parse(%q): got %+v, want %+v", tt.input, *parseErr, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package filterexpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect описывает конструкции, которые различаются в диалектах SQL
+type Dialect struct {
+	// Contains возвращает условие "column содержит подстроку" без учета регистра.
+	// pattern - плейсхолдер шаблона LIKE, спецсимволы в котором экранированы обратной косой чертой
+	Contains func(column, pattern string) string
+}
+
+// Postgres - диалект по умолчанию для ToSQL
+var Postgres = Dialect{
+	Contains: func(column, pattern string) string {
+		return fmt.Sprintf("(%s ILIKE %s)", column, pattern)
+	},
+}
+
+// ToSQL компилирует выражение в SQL-условие Postgres с плейсхолдерами $argPos, $argPos+1, ...
+// columns сопоставляет полям выражения колонки таблицы; значения передаются только
+// через аргументы, поэтому в текст запроса попадают лишь имена колонок из columns
+func ToSQL(node Node, columns map[string]string, argPos int) (string, []any, error) {
+	return ToDialectSQL(node, columns, argPos, Postgres)
+}
+
+// ToDialectSQL - ToSQL для другого диалекта с такими же плейсхолдерами $N
+func ToDialectSQL(node Node, columns map[string]string, argPos int, dialect Dialect) (string, []any, error) {
+	c := &sqlCompiler{columns: columns, argPos: argPos, dialect: dialect}
+
+	query, err := c.compile(node)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return query, c.args, nil
+}
+
+type sqlCompiler struct {
+	columns map[string]string
+	argPos  int
+	args    []any
+	dialect Dialect
+}
+
+var sqlOperators = map[Op]string{
+	OpEq: "=",
+	OpNe: "<>",
+	OpGt: ">",
+	OpGe: ">=",
+	OpLt: "<",
+	OpLe: "<=",
+}
+
+func (c *sqlCompiler) compile(node Node) (string, error) {
+	switch n := node.(type) {
+	case *And:
+		return c.binary(n.Left, n.Right, "AND")
+	case *Or:
+		return c.binary(n.Left, n.Right, "OR")
+	case *Not:
+		expr, err := c.compile(n.Expr)
+		if err != nil {
+			return "", err
+		}
+
+		return "NOT " + expr, nil
+	case *Comparison:
+		return c.comparison(n)
+	default:
+		return "", fmt.Errorf("filterexpr: unsupported node %T", node)
+	}
+}
+
+func (c *sqlCompiler) binary(left, right Node, op string) (string, error) {
+	l, err := c.compile(left)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := c.compile(right)
+	if err != nil {
+		return "", err
+	}
+
+	return "(" + l + " " + op + " " + r + ")", nil
+}
+
+func (c *sqlCompiler) comparison(n *Comparison) (string, error) {
+	column, ok := c.columns[n.Field]
+	if !ok {
+		return "", fmt.Errorf("filterexpr: no column for field %q", n.Field)
+	}
+
+	switch n.Op {
+	case OpIn:
+		placeholders := make([]string, len(n.Values))
+		for i, v := range n.Values {
+			placeholders[i] = c.arg(v)
+		}
+
+		return fmt.Sprintf("(%s IN (%s))", column, strings.Join(placeholders, ", ")), nil
+	case OpContains:
+		pattern := "%" + escapeLike(n.Values[0].Str) + "%"
+
+		return c.dialect.Contains(column, c.arg(Value{Type: String, Str: pattern})), nil
+	default:
+		sqlOp, ok := sqlOperators[n.Op]
+		if !ok {
+			return "", fmt.Errorf("filterexpr: unsupported operator %q", n.Op)
+		}
+
+		return fmt.Sprintf("(%s %s %s)", column, sqlOp, c.arg(n.Values[0])), nil
+	}
+}
+
+func (c *sqlCompiler) arg(v Value) string {
+	c.args = append(c.args, v.Any())
+
+	placeholder := fmt.Sprintf("$%d", c.argPos)
+	c.argPos++
+
+	return placeholder
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,115 @@
+package filterexpr
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var testColumns = map[string]string{
+	"id":      "u.id",
+	"age":     "u.age",
+	"name":    "u.name",
+	"sex":     "u.sex",
+	"country": "u.primary_country",
+}
+
+func TestToSQL(t *testing.T) {
+	tests := []struct {
+		input  string
+		argPos int
+		want   string
+		args   []any
+	}{
+		{
+			input:  "age gt 30",
+			argPos: 1,
+			want:   "(u.age > $1)",
+			args:   []any{int64(30)},
+		},
+		{
+			input:  "(sex eq 'female' and age ge 30) or country in ('RU','KZ')",
+			argPos: 1,
+			want:   "(((u.sex = $1) AND (u.age >= $2)) OR (u.primary_country IN ($3, $4)))",
+			args:   []any{"female", int64(30), "RU", "KZ"},
+		},
+		{
+			// Нумерация продолжается после аргументов, уже занятых запросом
+			input:  "not (id ne 1 or age lt 2) and name le 'b'",
+			argPos: 4,
+			want:   "(NOT ((u.id <> $4) OR (u.age < $5)) AND (u.name <= $6))",
+			args:   []any{int64(1), int64(2), "b"},
+		},
+		{
+			// Спецсимволы LIKE в значении ищутся буквально
+			input:  `name contains '50%_a\b'`,
+			argPos: 1,
+			want:   "(u.name ILIKE $1)",
+			args:   []any{`%50\%\_a\\b%`},
+		},
+		{
+			// Значения не попадают в текст запроса
+			input:  "name eq 'x'') or true --'",
+			argPos: 1,
+			want:   "(u.name = $1)",
+			args:   []any{"x') or true --"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input, testFields)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+
+			got, args, err := ToSQL(node, testColumns, tt.argPos)
+			if err != nil {
+				t.Fatalf("ToSQL(%q): %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Fatalf("ToSQL(%q): got %q, want %q", tt.input, got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Fatalf("ToSQL(%q): got args %#v, want %#v", tt.input, args, tt.args)
+			}
+		})
+	}
+}
+
+func TestToDialectSQL(t *testing.T) {
+	dialect := Dialect{
+		Contains: func(column, pattern string) string {
+			return fmt.Sprintf(`(lower(%s) LIKE lower(%s) ESCAPE '\')`, column, pattern)
+		},
+	}
+
+	node, err := Parse("age eq 1 and name contains 'A_'", testFields)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	got, args, err := ToDialectSQL(node, testColumns, 2, dialect)
+	if err != nil {
+		t.Fatalf("ToDialectSQL: %v", err)
+	}
+
+	want := `((u.age = $2) AND (lower(u.name) LIKE lower($3) ESCAPE '\'))`
+	if got != want {
+		t.Fatalf("ToDialectSQL: got %q, want %q", got, want)
+	}
+	if wantArgs := []any{int64(1), `%A\_%`}; !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("ToDialectSQL: got args %#v, want %#v", args, wantArgs)
+	}
+}
+
+func TestToSQLUnknownColumn(t *testing.T) {
+	node, err := Parse("sex eq 'male'", testFields)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if _, _, err := ToSQL(node, map[string]string{"age": "u.age"}, 1); err == nil {
+		t.Fatal("ToSQL: expected error for field without column")
+	}
+}
@@ -0,0 +1,219 @@
+// Package importfile разбирает файлы массового импорта пользователей (CSV и NDJSON)
+// с настраиваемым сопоставлением колонок полям ФИО
+package importfile
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"io"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+// MaxRows - максимальное количество строк данных в одном файле
+const MaxRows = 100000
+
+var (
+	ErrUnknownFormat = errors.New("unknown import format, must be csv or ndjson")
+	ErrTooManyRows   = fmt.Errorf("file contains more than %d rows", MaxRows)
+)
+
+// Mapping - имена колонок CSV (или ключей NDJSON), из которых берутся поля ФИО
+type Mapping struct {
+	Name       string
+	Surname    string
+	Patronymic string
+}
+
+func DefaultMapping() Mapping {
+	return Mapping{
+		Name:       "name",
+		Surname:    "surname",
+		Patronymic: "patronymic",
+	}
+}
+
+func ParseFormat(value string) (Format, error) {
+	switch Format(strings.ToLower(value)) {
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatNDJSON, "jsonl":
+		return FormatNDJSON, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// Parse читает файл целиком. Строки, которые не удалось разобрать, возвращаются
+// как ошибки строк и не прерывают разбор; ошибка возвращается только если файл
+// нельзя обработать в принципе (нет нужных колонок, слишком много строк и т.п.)
+func Parse(r io.Reader, format Format, mapping Mapping) ([]models.ImportRow, []models.ImportRowError, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r, mapping)
+	case FormatNDJSON:
+		return parseNDJSON(r, mapping)
+	default:
+		return nil, nil, ErrUnknownFormat
+	}
+}
+
+func parseCSV(r io.Reader, mapping Mapping) ([]models.ImportRow, []models.ImportRowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errors.New("file is empty")
+		}
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		index[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	nameIdx, ok := index[strings.ToLower(mapping.Name)]
+	if !ok {
+		return nil, nil, fmt.Errorf("column %q not found in header", mapping.Name)
+	}
+	surnameIdx, ok := index[strings.ToLower(mapping.Surname)]
+	if !ok {
+		return nil, nil, fmt.Errorf("column %q not found in header", mapping.Surname)
+	}
+	patronymicIdx, hasPatronymic := index[strings.ToLower(mapping.Patronymic)]
+
+	var rows []models.ImportRow
+	var rowErrors []models.ImportRowError
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if len(rows)+len(rowErrors) >= MaxRows {
+			return nil, nil, ErrTooManyRows
+		}
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, nil, err
+			}
+			rowErrors = append(rowErrors, models.ImportRowError{Row: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		if nameIdx >= len(record) || surnameIdx >= len(record) {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: line, Error: "not enough columns"})
+			continue
+		}
+
+		payload := models.SaveUserPayload{
+			Name:    strings.TrimSpace(record[nameIdx]),
+			Surname: strings.TrimSpace(record[surnameIdx]),
+		}
+		if hasPatronymic && patronymicIdx < len(record) {
+			payload.Patronymic = strings.TrimSpace(record[patronymicIdx])
+		}
+
+		rows = append(rows, models.ImportRow{Row: line, Payload: payload})
+	}
+
+	return rows, rowErrors, nil
+}
+
+func parseNDJSON(r io.Reader, mapping Mapping) ([]models.ImportRow, []models.ImportRowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []models.ImportRow
+	var rowErrors []models.ImportRowError
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if len(rows)+len(rowErrors) >= MaxRows {
+			return nil, nil, ErrTooManyRows
+		}
+
+		var object map[string]any
+		if err := json.Unmarshal([]byte(text), &object); err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: line, Error: "invalid JSON object"})
+			continue
+		}
+
+		payload, err := objectPayload(object, mapping)
+		if err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: line, Error: err.Error()})
+			continue
+		}
+
+		rows = append(rows, models.ImportRow{Row: line, Payload: payload})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if len(rows)+len(rowErrors) == 0 {
+		return nil, nil, errors.New("file is empty")
+	}
+
+	return rows, rowErrors, nil
+}
+
+func objectPayload(object map[string]any, mapping Mapping) (models.SaveUserPayload, error) {
+	var payload models.SaveUserPayload
+
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{
+		{mapping.Name, &payload.Name},
+		{mapping.Surname, &payload.Surname},
+		{mapping.Patronymic, &payload.Patronymic},
+	} {
+		value, err := stringField(object, field.key)
+		if err != nil {
+			return models.SaveUserPayload{}, err
+		}
+		*field.value = strings.TrimSpace(value)
+	}
+
+	return payload, nil
+}
+
+// stringField достает строковое значение ключа; отсутствующий ключ или null дают пустую строку
+func stringField(object map[string]any, key string) (string, error) {
+	value, ok := object[key]
+	if !ok || value == nil {
+		return "", nil
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q must be a string", key)
+	}
+
+	return str, nil
+}
@@ -0,0 +1,65 @@
+// Package reqctx хранит в context.Context сведения о запросе, которые нужны
+// слоям ниже HTTP: кто выполняет действие, идентификатор запроса, пользователь из пути
+// запроса и логгер запроса
+package reqctx
+
+import (
+	"context"
+	"log/slog"
+)
+
+type ctxKey int
+
+const (
+	actorKey ctxKey = iota
+	requestIDKey
+	loggerKey
+	userIDKey
+)
+
+// WithActor запоминает инициатора действия (пользователь API, ключ, CLI)
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor возвращает инициатора действия или пустую строку, если он неизвестен
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID возвращает идентификатор запроса или пустую строку
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithUserID запоминает идентификатор пользователя из пути запроса (/users/:id), который
+// уже добавлен в логгер запроса
+func WithUserID(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+// UserID возвращает идентификатор пользователя из пути запроса, если он есть
+func UserID(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(userIDKey).(int64)
+	return id, ok
+}
+
+// WithLogger запоминает логгер запроса, уже дополненный его атрибутами
+func WithLogger(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, log)
+}
+
+// Logger возвращает логгер запроса или fallback, если ctx создан не в запросе
+func Logger(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if log, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return log
+	}
+
+	return fallback
+}
@@ -0,0 +1,73 @@
+// Package textsearch - поиск по ФИО для хранилищ без полнотекстового поиска Postgres.
+// Разбиение на слова совпадает с to_tsvector('simple'), похожесть - с similarity() из pg_trgm
+package textsearch
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Words разбивает строку на слова в нижнем регистре; все символы, кроме букв и цифр, - разделители
+func Words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// PrefixRank - число слов text, начинающихся с одного из слов запроса, или 0, если хотя бы
+// одно слово запроса не нашлось (tsquery "w1:* & w2:*" не выполняется). Это приближение
+// ts_rank: порядок совпадает для простых случаев, но не по абсолютным значениям
+func PrefixRank(text string, query []string) int {
+	if len(query) == 0 {
+		return 0
+	}
+
+	tokens := Words(text)
+
+	rank := 0
+	for _, word := range query {
+		matched := 0
+		for _, token := range tokens {
+			if strings.HasPrefix(token, word) {
+				matched++
+			}
+		}
+		if matched == 0 {
+			return 0
+		}
+		rank += matched
+	}
+
+	return rank
+}
+
+// Similarity вычисляет similarity() из pg_trgm: доля общих триграмм слов,
+// дополненных двумя пробелами в начале и одним в конце
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigrams(s string) map[string]struct{} {
+	set := map[string]struct{}{}
+
+	for _, word := range Words(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+
+	return set
+}
@@ -0,0 +1,62 @@
+// Package validate - проверка ФИО, общая для HTTP-обработчиков и enricherctl
+package validate
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// nameField validates a single name field (first name, last name or patronymic)
+func nameField(fieldName, value string, required bool) error {
+	// Check if required field is empty
+	if required && strings.TrimSpace(value) == "" {
+		return fmt.Errorf("%s cannot be empty", fieldName)
+	}
+
+	// Skip validation if field is not required and empty
+	if !required && strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	// Check length
+	runes := []rune(value)
+	if len(runes) > 100 {
+		return fmt.Errorf("%s is too long (max 100 characters)", fieldName)
+	}
+
+	// Check each character
+	for i, r := range value {
+		switch {
+		case unicode.IsLetter(r):
+			continue
+		case r == ' ' || r == '-' || r == '\'':
+			// Check for leading/trailing special characters
+			if i == 0 || i == len(runes)-1 {
+				return fmt.Errorf("%s cannot start or end with special characters", fieldName)
+			}
+			// Check for consecutive special characters
+			if i > 0 && (r == rune(value[i-1])) {
+				return fmt.Errorf("%s cannot have consecutive special characters", fieldName)
+			}
+		default:
+			return fmt.Errorf("%s contains invalid characters - only letters, spaces, hyphens and apostrophes are allowed", fieldName)
+		}
+	}
+
+	return nil
+}
+
+// Names validates all name fields at once
+func Names(firstName, lastName, patronymic string) error {
+	if err := nameField("first name", firstName, true); err != nil {
+		return err
+	}
+	if err := nameField("last name", lastName, true); err != nil {
+		return err
+	}
+	if err := nameField("patronymic", patronymic, false); err != nil {
+		return err
+	}
+	return nil
+}
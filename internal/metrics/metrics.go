@@ -0,0 +1,219 @@
+// Package metrics - метрики Prometheus сервиса: HTTP-запросы и отказы по лимитам, операции
+// хранилища и пул соединений с Postgres, запросы к API обогащения, кэш обогащения и очередь
+// фоновых импортов
+package metrics
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"time"
+)
+
+const namespace = "enricher"
+
+// Результаты операций в метке result
+const (
+	ResultOK       = "ok"
+	ResultNotFound = "not_found"
+	ResultError    = "error"
+	// Ожидаемый отказ хранилища: квота исчерпана, ключ API с таким именем уже есть
+	ResultRejected = "rejected"
+)
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	storageDuration *prometheus.HistogramVec
+	enrichDuration  *prometheus.HistogramVec
+	enrichErrors    *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+}
+
+// New создает метрики в собственном реестре (вместе со стандартными метриками Go и процесса)
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by method, route pattern and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "operation_duration_seconds",
+			Help:      "Storage operation latency by operation (storage.<backend>.<Method>) and result.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"op", "result"}),
+
+		enrichDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "enrichment",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of upstream enrichment API calls by source and result.",
+			Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"source", "result"}),
+
+		enrichErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "enrichment",
+			Name:      "errors_total",
+			Help:      "Failed upstream enrichment API calls by source.",
+		}, []string{"source"}),
+
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "rate_limited_total",
+			Help:      "Requests rejected with 429 by reason: general or enrich rate limit, daily enrichment quota.",
+		}, []string{"reason"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.storageDuration,
+		m.enrichDuration,
+		m.enrichErrors,
+		m.rateLimited,
+	)
+
+	return m
+}
+
+// Handler отдает метрики в текстовом формате Prometheus
+func (m *Metrics) Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// ObserveStorage учитывает операцию хранилища. op - константа op метода хранилища
+func (m *Metrics) ObserveStorage(op, result string, duration time.Duration) {
+	m.storageDuration.WithLabelValues(op, result).Observe(duration.Seconds())
+}
+
+// ObserveEnrichment учитывает запрос к API обогащения source
+func (m *Metrics) ObserveEnrichment(source string, duration time.Duration, err error) {
+	result := ResultOK
+	if err != nil {
+		result = ResultError
+		m.enrichErrors.WithLabelValues(source).Inc()
+	}
+
+	m.enrichDuration.WithLabelValues(source, result).Observe(duration.Seconds())
+}
+
+// ObserveRateLimited учитывает запрос, отклоненный лимитом частоты или квотой
+func (m *Metrics) ObserveRateLimited(reason string) {
+	m.rateLimited.WithLabelValues(reason).Inc()
+}
+
+// RegisterCache публикует счетчики кэша обогащения. stats вызывается при каждом сборе метрик
+func (m *Metrics) RegisterCache(stats func() models.CacheStatus) {
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "enrichment_cache",
+			Name:      "hits_total",
+			Help:      "Enrichment cache hits.",
+		}, func() float64 { return float64(stats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "enrichment_cache",
+			Name:      "misses_total",
+			Help:      "Enrichment cache misses.",
+		}, func() float64 { return float64(stats().Misses) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "enrichment_cache",
+			Name:      "entries",
+			Help:      "Entries currently held in the enrichment cache.",
+		}, func() float64 { return float64(stats().Entries) }),
+	)
+}
+
+// RegisterImportQueue публикует глубину очереди импорта: сколько задач выполняется
+// и сколько строк в них еще не обработано
+func (m *Metrics) RegisterImportQueue(queue func() (imports, rows int64)) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "imports",
+			Name:      "running",
+			Help:      "Import jobs currently being processed.",
+		}, func() float64 {
+			imports, _ := queue()
+			return float64(imports)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "imports",
+			Name:      "pending_rows",
+			Help:      "Rows of running import jobs that are not processed yet.",
+		}, func() float64 {
+			_, rows := queue()
+			return float64(rows)
+		}),
+	)
+}
+
+// RegisterDBPool публикует состояние пула соединений с Postgres. stats вызывается при каждом сборе метрик
+func (m *Metrics) RegisterDBPool(stats func() models.PoolStats) {
+	gauge := func(name, help string, value func(models.PoolStats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "db_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(stats()) })
+	}
+	counter := func(name, help string, value func(models.PoolStats) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(stats()) })
+	}
+
+	m.registry.MustRegister(
+		gauge("acquired_connections", "Connections currently in use.",
+			func(s models.PoolStats) float64 { return float64(s.AcquiredConns) }),
+		gauge("idle_connections", "Idle connections in the pool.",
+			func(s models.PoolStats) float64 { return float64(s.IdleConns) }),
+		gauge("constructing_connections", "Connections currently being established.",
+			func(s models.PoolStats) float64 { return float64(s.ConstructingConns) }),
+		gauge("total_connections", "All open connections: acquired, idle and constructing.",
+			func(s models.PoolStats) float64 { return float64(s.TotalConns) }),
+		gauge("max_connections", "Maximum size of the pool (DB_MAX_CONNS).",
+			func(s models.PoolStats) float64 { return float64(s.MaxConns) }),
+		counter("acquires_total", "Connections acquired from the pool.",
+			func(s models.PoolStats) float64 { return float64(s.AcquireCount) }),
+		counter("empty_acquires_total", "Acquires that had to wait for a connection because none was idle.",
+			func(s models.PoolStats) float64 { return float64(s.EmptyAcquireCount) }),
+		counter("canceled_acquires_total", "Acquires canceled by the context while waiting.",
+			func(s models.PoolStats) float64 { return float64(s.CanceledAcquireCount) }),
+		counter("acquire_duration_seconds_total", "Total time spent acquiring connections.",
+			func(s models.PoolStats) float64 { return s.AcquireDuration.Seconds() }),
+		counter("new_connections_total", "Connections opened by the pool.",
+			func(s models.PoolStats) float64 { return float64(s.NewConnsCount) }),
+	)
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unmatchedRoute - метка route для запросов, не попавших ни в один маршрут, чтобы
+// произвольные пути не порождали новые ряды
+const unmatchedRoute = "unmatched"
+
+// Middleware считает запросы и их длительность по шаблону маршрута (например /users/:id)
+// и итоговому коду ответа
+func (m *Metrics) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		err := c.Next()
+
+		route := c.Route().Path
+		if err != nil {
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusNotFound &&
+				strings.HasPrefix(fiberErr.Message, "Cannot ") {
+				route = unmatchedRoute
+			}
+
+			// Отдаем ошибку обработчику ошибок fiber сейчас, чтобы учесть итоговый код ответа
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+			err = nil
+		}
+
+		// Строки fiber ссылаются на переиспользуемые буферы запроса, а метки живут дольше него
+		method := utils.CopyString(c.Method())
+		route = utils.CopyString(route)
+		status := strconv.Itoa(c.Response().StatusCode())
+
+		m.httpRequests.WithLabelValues(method, route, status).Inc()
+		m.httpDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
@@ -0,0 +1,172 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/sol1corejz/enricher/migrations"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+var ErrNoMigrations = errors.New("no migrations")
+
+// Migrator применяет встроенные в бинарник миграции: migrations.FS для Postgres
+// или migrations.SQLite для адресов вида sqlite://path
+type Migrator struct {
+	m      *migrate.Migrate
+	latest uint
+}
+
+func New(dbURL string) (*Migrator, error) {
+	const op = "migrator.New"
+
+	src, err := iofs.New(migrationsFor(dbURL))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	latest, err := latestVersion(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", src, dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Migrator{m: m, latest: latest}, nil
+}
+
+// LatestVersion возвращает последнюю версию среди встроенных миграций для базы dbURL,
+// не подключаясь к ней
+func LatestVersion(dbURL string) (uint, error) {
+	const op = "migrator.LatestVersion"
+
+	src, err := iofs.New(migrationsFor(dbURL))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer src.Close()
+
+	latest, err := latestVersion(src)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return latest, nil
+}
+
+// Up применяет все непримененные миграции. Отсутствие изменений ошибкой не считается
+func (m *Migrator) Up() error {
+	const op = "migrator.Up"
+
+	return m.wrap(op, m.m.Up())
+}
+
+// Down откатывает все миграции
+func (m *Migrator) Down() error {
+	const op = "migrator.Down"
+
+	return m.wrap(op, m.m.Down())
+}
+
+// Steps применяет n миграций вперед (n > 0) или откатывает -n миграций (n < 0)
+func (m *Migrator) Steps(n int) error {
+	const op = "migrator.Steps"
+
+	return m.wrap(op, m.m.Steps(n))
+}
+
+// Goto мигрирует вверх или вниз до указанной версии
+func (m *Migrator) Goto(version uint) error {
+	const op = "migrator.Goto"
+
+	return m.wrap(op, m.m.Migrate(version))
+}
+
+// Force записывает версию без применения миграций, чтобы снять флаг dirty после
+// ручного исправления схемы. -1 означает, что ни одна миграция не применена
+func (m *Migrator) Force(version int) error {
+	const op = "migrator.Force"
+
+	return m.wrap(op, m.m.Force(version))
+}
+
+// Version возвращает текущую версию схемы. Если миграции еще не применялись,
+// возвращается 0 без ошибки
+func (m *Migrator) Version() (uint, bool, error) {
+	const op = "migrator.Version"
+
+	version, dirty, err := m.m.Version()
+	if err != nil {
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return 0, false, nil
+		}
+
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, dirty, nil
+}
+
+// Latest возвращает последнюю версию среди встроенных миграций
+func (m *Migrator) Latest() uint {
+	return m.latest
+}
+
+func (m *Migrator) Close() error {
+	const op = "migrator.Close"
+
+	srcErr, dbErr := m.m.Close()
+	if err := errors.Join(srcErr, dbErr); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// migrationsFor выбирает набор миграций по схеме адреса базы
+func migrationsFor(dbURL string) (fs.FS, string) {
+	if strings.HasPrefix(dbURL, "sqlite://") {
+		return migrations.SQLite, "sqlite"
+	}
+
+	return migrations.FS, "."
+}
+
+func (m *Migrator) wrap(op string, err error) error {
+	if err == nil || errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+func latestVersion(src source.Driver) (uint, error) {
+	version, err := src.First()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, ErrNoMigrations
+		}
+
+		return 0, err
+	}
+
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
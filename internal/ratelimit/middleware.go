@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Классы запросов - метка reason для Observer
+const (
+	// ClassGeneral - запросы, не запускающие обогащение: чтение, правка, удаление
+	ClassGeneral = "general"
+	// ClassEnrich - запросы, запускающие обогащение через внешние API: /add и /users/import
+	ClassEnrich = "enrich"
+)
+
+// Observer получает отклоненные запросы (например, для метрик)
+type Observer interface {
+	ObserveRateLimited(reason string)
+}
+
+// Middleware ограничивает запросы клиента к маршруту лимитом limiter; class - класс запросов
+// маршрута для логов и observer. Маршруты одного класса делят одну корзину клиента. nil -
+// без ограничения. Ответ содержит заголовки RateLimit-*, отклоненный запрос получает 429
+// с Retry-After. Должен стоять после аутентификации, чтобы клиентом был ее результат
+func Middleware(limiter *Limiter, class string, observer Observer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if limiter == nil {
+			return c.Next()
+		}
+
+		decision := limiter.Allow(Client(c))
+
+		c.Set("RateLimit-Policy", strconv.Itoa(decision.Limit)+";w="+strconv.Itoa(seconds(limiter.window())))
+		c.Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(seconds(decision.Reset)))
+
+		if !decision.Allowed {
+			if observer != nil {
+				observer.ObserveRateLimited(class)
+			}
+			reqctx.Logger(c.UserContext(), slog.Default()).Info("rate limit exceeded",
+				slog.String("class", class),
+			)
+
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(seconds(decision.RetryAfter), 1)))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "rate limit exceeded, retry later",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// Client возвращает идентификатор клиента для лимитов и квот: инициатора, установленного
+// аутентификацией (api_key:<имя>, jwt:<sub>), а без нее - IP-адрес
+func Client(c *fiber.Ctx) string {
+	if actor := reqctx.Actor(c.UserContext()); actor != "" {
+		return actor
+	}
+
+	return "ip:" + c.IP()
+}
+
+// window - за сколько пополняется пустая корзина
+func (l *Limiter) window() time.Duration {
+	return l.duration(float64(l.burst))
+}
+
+// seconds округляет вверх до целых секунд, как принято в заголовках
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
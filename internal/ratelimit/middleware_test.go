@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type observer struct {
+	reasons []string
+}
+
+func (o *observer) ObserveRateLimited(reason string) {
+	o.reasons = append(o.reasons, reason)
+}
+
+func newTestApp(limiter *Limiter, obs Observer) *fiber.App {
+	app := fiber.New()
+
+	// Инициатор запроса - как после аутентификации
+	app.Use(func(c *fiber.Ctx) error {
+		if actor := c.Get("X-Actor"); actor != "" {
+			c.SetUserContext(reqctx.WithActor(c.UserContext(), actor))
+		}
+		return c.Next()
+	})
+	app.Get("/", Middleware(limiter, ClassGeneral, obs), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	return app
+}
+
+func TestMiddleware(t *testing.T) {
+	// Два запроса в минуту: токен в 30 секунд
+	limiter, c := newTestLimiter(2, 0)
+	obs := &observer{}
+	app := newTestApp(limiter, obs)
+
+	steps := []struct {
+		actor      string
+		advance    time.Duration
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{"api_key:a", 0, fiber.StatusOK, "1", "30", ""},
+		{"api_key:a", 0, fiber.StatusOK, "0", "60", ""},
+		{"api_key:a", 0, fiber.StatusTooManyRequests, "0", "60", "30"},
+		// Retry-After округляется вверх и не бывает меньше секунды
+		{"api_key:a", 29500 * time.Millisecond, fiber.StatusTooManyRequests, "0", "31", "1"},
+		{"api_key:a", 500 * time.Millisecond, fiber.StatusOK, "0", "60", ""},
+		// У другого клиента своя корзина
+		{"api_key:b", 0, fiber.StatusOK, "1", "30", ""},
+		// Без аутентификации клиент - IP-адрес
+		{"", 0, fiber.StatusOK, "1", "30", ""},
+	}
+
+	for i, step := range steps {
+		c.Advance(step.advance)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		if step.actor != "" {
+			req.Header.Set("X-Actor", step.actor)
+		}
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+
+		got := []string{
+			resp.Header.Get("RateLimit-Policy"),
+			resp.Header.Get("RateLimit-Limit"),
+			resp.Header.Get("RateLimit-Remaining"),
+			resp.Header.Get("RateLimit-Reset"),
+			resp.Header.Get(fiber.HeaderRetryAfter),
+		}
+		want := []string{"2;w=60", "2", step.remaining, step.reset, step.retryAfter}
+
+		if resp.StatusCode != step.status {
+			t.Fatalf("step %d: got status %d, want %d", i, resp.StatusCode, step.status)
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("step %d: got headers %q, want %q", i, got, want)
+			}
+		}
+	}
+
+	if len(obs.reasons) != 2 || obs.reasons[0] != ClassGeneral {
+		t.Fatalf("observer: got %q, want two %q", obs.reasons, ClassGeneral)
+	}
+}
+
+func TestMiddlewareWithoutLimit(t *testing.T) {
+	app := newTestApp(nil, nil)
+
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusOK || resp.Header.Get("RateLimit-Limit") != "" {
+			t.Fatalf("request %d: got status %d, headers %v", i+1, resp.StatusCode, resp.Header)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package ratelimit ограничивает частоту запросов каждого клиента алгоритмом token bucket:
+// у клиента есть корзина на burst запросов, которая пополняется равномерно со скоростью
+// perMinute запросов в минуту. Корзины хранятся в памяти процесса
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval - как часто удалять корзины клиентов, которые успели полностью пополниться:
+// они ничем не отличаются от новых
+const sweepInterval = time.Minute
+
+type Limiter struct {
+	// rate - токенов в секунду
+	rate  float64
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Decision - результат проверки: разрешен ли запрос и состояние корзины после него
+type Decision struct {
+	Allowed bool
+
+	// Limit - размер корзины, Remaining - сколько запросов еще можно сделать сразу
+	Limit     int
+	Remaining int
+
+	// Reset - через сколько корзина пополнится полностью
+	Reset time.Duration
+
+	// RetryAfter - через сколько появится следующий токен, если запрос отклонен
+	RetryAfter time.Duration
+}
+
+// New создает лимитер на perMinute запросов в минуту на клиента с всплесками до burst
+// запросов; burst <= 0 означает perMinute. perMinute должен быть положительным
+func New(perMinute, burst int) *Limiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+
+	return &Limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   burst,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow расходует токен клиента client, если он есть
+func (l *Limiter) Allow(client string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), updated: now}
+		l.buckets[client] = b
+	}
+	b.refill(now, l.rate, l.burst)
+
+	decision := Decision{Limit: l.burst}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = l.duration(1 - b.tokens)
+	}
+
+	decision.Remaining = int(math.Floor(b.tokens))
+	decision.Reset = l.duration(float64(l.burst) - b.tokens)
+
+	return decision
+}
+
+func (b *bucket) refill(now time.Time, rate float64, burst int) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+		b.updated = now
+	}
+}
+
+// duration - за сколько накопится tokens токенов
+func (l *Limiter) duration(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for client, b := range l.buckets {
+		b.refill(now, l.rate, l.burst)
+		if b.tokens >= float64(l.burst) {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// clock - управляемое время для Limiter.now
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(perMinute, burst int) (*Limiter, *clock) {
+	c := &clock{now: time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)}
+
+	l := New(perMinute, burst)
+	l.now = c.Now
+
+	return l, c
+}
+
+func TestLimiterAllow(t *testing.T) {
+	// Токен в секунду, до трех подряд
+	l, c := newTestLimiter(60, 3)
+
+	steps := []struct {
+		advance time.Duration
+		want    Decision
+	}{
+		{0, Decision{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{0, Decision{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+		{0, Decision{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{0, Decision{Allowed: false, Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		// Отклоненный запрос токен не расходует: через полсекунды ждать осталось полсекунды
+		{500 * time.Millisecond, Decision{Allowed: false, Limit: 3, Remaining: 0, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{500 * time.Millisecond, Decision{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		// Корзина пополняется не больше чем до burst
+		{time.Hour, Decision{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+	}
+
+	for i, step := range steps {
+		c.Advance(step.advance)
+
+		if got := l.Allow("api_key:a"); got != step.want {
+			t.Fatalf("step %d: got %+v, want %+v", i, got, step.want)
+		}
+	}
+}
+
+func TestLimiterClients(t *testing.T) {
+	l, _ := newTestLimiter(60, 1)
+
+	if !l.Allow("api_key:a").Allowed {
+		t.Fatal("first request of a must be allowed")
+	}
+	if l.Allow("api_key:a").Allowed {
+		t.Fatal("second request of a must be rejected")
+	}
+	if !l.Allow("api_key:b").Allowed {
+		t.Fatal("b must have its own bucket")
+	}
+}
+
+func TestLimiterDefaultBurst(t *testing.T) {
+	l, _ := newTestLimiter(5, 0)
+
+	for i := 0; i < 5; i++ {
+		if !l.Allow("ip:127.0.0.1").Allowed {
+			t.Fatalf("request %d must be allowed", i+1)
+		}
+	}
+
+	got := l.Allow("ip:127.0.0.1")
+	// Токен в 12 секунд
+	if got.Allowed || got.Limit != 5 || got.RetryAfter != 12*time.Second {
+		t.Fatalf("sixth request: got %+v", got)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l, c := newTestLimiter(60, 2)
+
+	l.Allow("api_key:a")
+	l.Allow("api_key:b")
+
+	// Через минуту обе корзины полны и удаляются при следующем запросе, кроме корзины
+	// самого запрашивающего
+	c.Advance(sweepInterval)
+	l.Allow("api_key:a")
+
+	if _, ok := l.buckets["api_key:b"]; ok {
+		t.Fatal("full bucket of b must be swept")
+	}
+	if got := len(l.buckets); got != 1 {
+		t.Fatalf("got %d buckets, want 1", got)
+	}
+}
@@ -0,0 +1,120 @@
+// Package requestlog присваивает каждому запросу идентификатор и логгер с атрибутами
+// запроса, которые дальше берутся из context.Context сервисом и хранилищем
+package requestlog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRequestIDLength ограничивает принятый от клиента X-Request-ID, чтобы он не раздувал логи и аудит
+const maxRequestIDLength = 128
+
+// routedKey - ключ ctx.Locals: Route уже добавил маршрут в логгер запроса
+type routedKey struct{}
+
+// Middleware берет идентификатор запроса из X-Request-ID или создает новый, возвращает
+// его в ответе и кладет в UserContext вместе с логгером (request_id, method, path; маршрут
+// добавляет Route). По завершении запроса пишет строку с маршрутом, кодом ответа и длительностью
+func Middleware(log *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		requestID := c.Get(fiber.HeaderXRequestID)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		} else {
+			requestID = utils.CopyString(requestID)
+		}
+		c.Set(fiber.HeaderXRequestID, requestID)
+
+		method := utils.CopyString(c.Method())
+
+		reqLog := log.With(
+			slog.String("request_id", requestID),
+			slog.String("method", method),
+			slog.String("path", utils.CopyString(c.Path())),
+		)
+
+		ctx := reqctx.WithRequestID(c.UserContext(), requestID)
+		c.SetUserContext(reqctx.WithLogger(ctx, reqLog))
+
+		err := c.Next()
+		if err != nil {
+			// Отдаем ошибку обработчику ошибок fiber сейчас, чтобы записать итоговый код ответа
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+			err = nil
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+		}
+		// Для запросов, не дошедших до маршрута (например, 404), маршрут добавляется здесь
+		if c.Locals(routedKey{}) == nil {
+			attrs = append([]slog.Attr{slog.String("route", utils.CopyString(c.Route().Path))}, attrs...)
+		}
+
+		// Логгер берется из контекста: обработчики ниже могли дополнить его (например, инициатором)
+		reqctx.Logger(c.UserContext(), reqLog).LogAttrs(c.UserContext(), level, "request completed", attrs...)
+
+		return err
+	}
+}
+
+// Route дополняет логгер запроса шаблоном маршрута (route) и, для маршрутов /users/:id...,
+// идентификатором пользователя (user_id). Шаблон известен только обработчикам маршрута,
+// поэтому Route ставится первым обработчиком каждого маршрута, а не через Use
+func Route(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	route := utils.CopyString(c.Route().Path)
+
+	attrs := []any{slog.String("route", route)}
+	if strings.HasPrefix(route, "/users/:id") {
+		if id, err := strconv.ParseInt(c.Params("id"), 10, 64); err == nil {
+			attrs = append(attrs, slog.Int64("user_id", id))
+			ctx = reqctx.WithUserID(ctx, id)
+		}
+	}
+
+	c.SetUserContext(reqctx.WithLogger(ctx, reqctx.Logger(ctx, slog.Default()).With(attrs...)))
+	c.Locals(routedKey{}, true)
+
+	return c.Next()
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+
+	return hex.EncodeToString(b[:])
+}
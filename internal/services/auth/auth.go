@@ -0,0 +1,228 @@
+// Package auth - аутентификация вызывающих API: статические ключи API, которые хранятся
+// в базе в виде хэшей и выдаются через enricherctl, и JWT, проверяемые общим секретом
+// (HS256/384/512) или открытыми ключами из файла JWKS
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// touchInterval - как часто обновлять время последнего использования ключа, чтобы
+// не писать в базу на каждый запрос
+const touchInterval = time.Minute
+
+// logHashLength - сколько символов SHA-256 предъявленного ключа пишется в лог вместо него
+const logHashLength = 12
+
+var (
+	// ErrUnauthenticated - учетные данные не подошли: неизвестный или отозванный ключ,
+	// неверная подпись, истекший токен. Причина только логируется, клиенту она не сообщается
+	ErrUnauthenticated = errors.New("invalid credentials")
+	ErrInvalidKeyName  = errors.New("api key name must be 1 to 255 characters")
+	ErrInvalidRole     = errors.New("role must be reader, editor or admin")
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrAPIKeyExists    = errors.New("active api key with this name already exists")
+)
+
+// KeyStore - хранилище ключей API
+type KeyStore interface {
+	CreateAPIKey(ctx context.Context, key models.APIKey) (int64, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64) error
+	TouchAPIKey(ctx context.Context, id int64, at time.Time) error
+}
+
+// Config - проверка JWT. Без HMACSecret и JWKSPath принимаются только ключи API
+type Config struct {
+	// Общий секрет для токенов HS256/384/512
+	HMACSecret string
+
+	// Файл JWKS с открытыми ключами RSA и EC для токенов RS*, PS* и ES*
+	JWKSPath string
+
+	// Ожидаемые iss и aud. Пустые - не проверяются
+	Issuer   string
+	Audience string
+
+	// Claim с ролью вызывающего: строка или массив строк (берется старшая из известных ролей).
+	// Пустой - role
+	RoleClaim string
+}
+
+type Auth struct {
+	log  *slog.Logger
+	keys KeyStore
+
+	// jwtParser и jwtKeys равны nil, если JWT не настроены
+	jwtParser *jwt.Parser
+	jwtKeys   *keySet
+	roleClaim string
+
+	touchMu sync.Mutex
+	touched map[int64]time.Time
+}
+
+// New создает сервис аутентификации. Файл JWKS, если задан, читается один раз здесь
+func New(log *slog.Logger, keys KeyStore, cfg Config) (*Auth, error) {
+	const op = "auth.New"
+
+	a := &Auth{
+		log:     log,
+		keys:    keys,
+		touched: map[int64]time.Time{},
+	}
+
+	if cfg.HMACSecret == "" && cfg.JWKSPath == "" {
+		return a, nil
+	}
+
+	a.roleClaim = cfg.RoleClaim
+	if a.roleClaim == "" {
+		a.roleClaim = "role"
+	}
+
+	a.jwtKeys = &keySet{hmac: []byte(cfg.HMACSecret)}
+	if cfg.JWKSPath != "" {
+		public, err := loadJWKS(cfg.JWKSPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		a.jwtKeys.public = public
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(a.jwtKeys.methods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	a.jwtParser = jwt.NewParser(options...)
+
+	return a, nil
+}
+
+// Authenticate проверяет ключ API (начинается с enr_) или JWT и возвращает вызывающего.
+// Неподходящие учетные данные - ErrUnauthenticated, остальные ошибки - сбой хранилища
+func (a *Auth) Authenticate(ctx context.Context, credential string) (models.Identity, error) {
+	if strings.HasPrefix(credential, apiKeyPrefix) {
+		return a.authenticateKey(ctx, credential)
+	}
+
+	return a.authenticateJWT(ctx, credential)
+}
+
+func (a *Auth) authenticateKey(ctx context.Context, key string) (models.Identity, error) {
+	const op = "auth.authenticateKey"
+
+	stored, err := a.keys.GetAPIKeyByHash(ctx, hashKey(key))
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			// Сам ключ, даже его начало, в лог не попадает: это мог быть действующий ключ
+			// с опечаткой. Начало хэша позволяет связать повторные попытки с одним ключом
+			reqctx.Logger(ctx, a.log).Info("unknown or revoked api key",
+				slog.String("op", op),
+				slog.String("key_hash", hashKey(key)[:logHashLength]),
+			)
+			return models.Identity{}, ErrUnauthenticated
+		}
+		return models.Identity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.touch(ctx, stored.ID)
+
+	return models.Identity{Method: MethodAPIKey, Subject: stored.Name, Role: stored.Role}, nil
+}
+
+// touch отмечает использование ключа не чаще раза в touchInterval. Ошибка
+// только логируется: запрос из-за нее не отклоняется
+func (a *Auth) touch(ctx context.Context, id int64) {
+	const op = "auth.touch"
+
+	now := time.Now()
+
+	a.touchMu.Lock()
+	if now.Sub(a.touched[id]) < touchInterval {
+		a.touchMu.Unlock()
+		return
+	}
+	a.touched[id] = now
+	a.touchMu.Unlock()
+
+	if err := a.keys.TouchAPIKey(ctx, id, now); err != nil {
+		reqctx.Logger(ctx, a.log).Warn("failed to update api key last use",
+			slog.String("op", op),
+			slog.Int64("key_id", id),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+func (a *Auth) authenticateJWT(ctx context.Context, token string) (models.Identity, error) {
+	const op = "auth.authenticateJWT"
+
+	log := reqctx.Logger(ctx, a.log).With(
+		slog.String("op", op),
+	)
+
+	if a.jwtParser == nil {
+		log.Info("jwt presented but jwt authentication is not configured")
+		return models.Identity{}, ErrUnauthenticated
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.jwtParser.ParseWithClaims(token, claims, a.jwtKeys.keyFunc); err != nil {
+		log.Info("invalid jwt", slog.String("error", err.Error()))
+		return models.Identity{}, ErrUnauthenticated
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		log.Info("jwt without subject")
+		return models.Identity{}, ErrUnauthenticated
+	}
+
+	return models.Identity{Method: MethodJWT, Subject: subject, Role: roleFromClaim(claims[a.roleClaim])}, nil
+}
+
+// roleFromClaim возвращает роль из строки или старшую известную роль из массива строк.
+// Неизвестные значения пропускаются, без известных роль пустая
+func roleFromClaim(claim any) models.Role {
+	var values []any
+	switch v := claim.(type) {
+	case string:
+		values = []any{v}
+	case []any:
+		values = v
+	}
+
+	var role models.Role
+	for _, value := range values {
+		candidate, _ := value.(string)
+		if r := models.Role(candidate); r.Valid() && r.Allows(role) {
+			role = r
+		}
+	}
+
+	return role
+}
@@ -0,0 +1,586 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage/memory"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jwk {
+	return jwk{Kty: "RSA", Kid: kid, N: encodeInt(key.N), E: encodeInt(big.NewInt(int64(key.E)))}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) jwk {
+	return jwk{Kty: "EC", Kid: kid, Crv: key.Curve.Params().Name, X: encodeInt(key.X), Y: encodeInt(key.Y)}
+}
+
+// writeJWKS записывает ключи во временный файл JWKS и возвращает путь к нему
+func writeJWKS(t *testing.T, keys ...jwk) string {
+	t.Helper()
+
+	data, err := json.Marshal(map[string][]jwk{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writeFile(t, string(data))
+}
+
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestMethods(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	ecKey := newECKey(t)
+
+	hmac := []string{"HS256", "HS384", "HS512"}
+	rsaMethods := []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+	ecMethods := []string{"ES256", "ES384", "ES512"}
+
+	tests := []struct {
+		name string
+		keys keySet
+		want []string
+	}{
+		{"nothing", keySet{}, nil},
+		{"hmac", keySet{hmac: []byte(testSecret)}, hmac},
+		{"rsa", keySet{public: map[string]crypto.PublicKey{"r": &rsaKey.PublicKey}}, rsaMethods},
+		{"ec", keySet{public: map[string]crypto.PublicKey{"e": &ecKey.PublicKey}}, ecMethods},
+		{
+			"all",
+			keySet{hmac: []byte(testSecret), public: map[string]crypto.PublicKey{"r": &rsaKey.PublicKey, "e": &ecKey.PublicKey}},
+			slices.Concat(hmac, rsaMethods, ecMethods),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.keys.methods()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("methods() = %v, want %v", got, tt.want)
+			}
+			// none не разрешается никогда
+			if slices.Contains(got, "none") {
+				t.Errorf("methods() allows none")
+			}
+		})
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	first := &newRSAKey(t).PublicKey
+	second := &newECKey(t).PublicKey
+
+	hmacOnly := &keySet{hmac: []byte(testSecret)}
+	single := &keySet{public: map[string]crypto.PublicKey{"first": first}}
+	both := &keySet{public: map[string]crypto.PublicKey{"first": first, "second": second}}
+
+	tests := []struct {
+		name    string
+		keys    *keySet
+		method  jwt.SigningMethod
+		kid     string
+		want    any
+		wantErr bool
+	}{
+		{"hmac", hmacOnly, jwt.SigningMethodHS256, "", []byte(testSecret), false},
+		{"hmac not configured", single, jwt.SigningMethodHS256, "", nil, true},
+		{"kid", both, jwt.SigningMethodES256, "second", second, false},
+		{"no kid, single key", single, jwt.SigningMethodRS256, "", first, false},
+		{"no kid, several keys", both, jwt.SigningMethodRS256, "", nil, true},
+		{"unknown kid", single, jwt.SigningMethodRS256, "other", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.New(tt.method)
+			if tt.kid != "" {
+				token.Header["kid"] = tt.kid
+			}
+
+			got, err := tt.keys.keyFunc(token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("keyFunc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if b, ok := tt.want.([]byte); ok {
+				if string(got.([]byte)) != string(b) {
+					t.Errorf("keyFunc() = %v, want hmac secret", got)
+				}
+			} else if got != tt.want {
+				t.Errorf("keyFunc() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadJWKS(t *testing.T) {
+	rsaKey := &newRSAKey(t).PublicKey
+	ecKey := &newECKey(t).PublicKey
+
+	short, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offCurve := ecJWK("bad", ecKey)
+	offCurve.Y = encodeInt(new(big.Int).Add(ecKey.Y, big.NewInt(1)))
+
+	enc := rsaJWK("enc", rsaKey)
+	enc.Use = "enc"
+
+	tests := []struct {
+		name     string
+		path     string
+		wantKids []string
+		wantErr  string
+	}{
+		{
+			name:     "rsa and ec",
+			path:     writeJWKS(t, rsaJWK("r", rsaKey), ecJWK("e", ecKey)),
+			wantKids: []string{"e", "r"},
+		},
+		{
+			name:     "encryption and unsupported keys are skipped",
+			path:     writeJWKS(t, enc, jwk{Kty: "oct", Kid: "o"}, rsaJWK("r", rsaKey)),
+			wantKids: []string{"r"},
+		},
+		{
+			name:    "only skipped keys",
+			path:    writeJWKS(t, enc, jwk{Kty: "OKP", Kid: "ed"}),
+			wantErr: "no usable RSA or EC signing keys",
+		},
+		{
+			name:    "duplicate kid",
+			path:    writeJWKS(t, rsaJWK("k", rsaKey), ecJWK("k", ecKey)),
+			wantErr: `duplicate kid "k"`,
+		},
+		{
+			name:    "short rsa key",
+			path:    writeJWKS(t, rsaJWK("short", &short.PublicKey)),
+			wantErr: "at least 2048 required",
+		},
+		{
+			name:    "missing exponent",
+			path:    writeJWKS(t, jwk{Kty: "RSA", Kid: "r", N: encodeInt(rsaKey.N)}),
+			wantErr: "e: missing value",
+		},
+		{
+			name:    "unsupported curve",
+			path:    writeJWKS(t, jwk{Kty: "EC", Kid: "e", Crv: "P-192", X: "AQ", Y: "AQ"}),
+			wantErr: `unsupported curve "P-192"`,
+		},
+		{
+			name:    "point not on curve",
+			path:    writeJWKS(t, offCurve),
+			wantErr: "point is not on the curve",
+		},
+		{
+			name:    "invalid base64",
+			path:    writeJWKS(t, jwk{Kty: "RSA", Kid: "r", N: "!!!", E: "AQAB"}),
+			wantErr: "n: illegal base64",
+		},
+		{
+			name:    "invalid json",
+			path:    writeFile(t, `{"keys": [`),
+			wantErr: "failed to parse jwks",
+		},
+		{
+			name:    "missing file",
+			path:    filepath.Join(t.TempDir(), "missing.json"),
+			wantErr: "failed to read jwks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := loadJWKS(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadJWKS() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadJWKS() error = %v", err)
+			}
+
+			kids := make([]string, 0, len(keys))
+			for kid := range keys {
+				kids = append(kids, kid)
+			}
+			slices.Sort(kids)
+
+			if !slices.Equal(kids, tt.wantKids) {
+				t.Errorf("loadJWKS() kids = %v, want %v", kids, tt.wantKids)
+			}
+		})
+	}
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	otherRSAKey := newRSAKey(t)
+	ecKey := newECKey(t)
+
+	jwksPath := writeJWKS(t, rsaJWK("rsa", &rsaKey.PublicKey), ecJWK("ec", &ecKey.PublicKey))
+
+	// Открытый ключ в том виде, в каком его может знать атакующий
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	hmacOnly := Config{HMACSecret: testSecret}
+	jwksOnly := Config{JWKSPath: jwksPath}
+	strict := Config{HMACSecret: testSecret, JWKSPath: jwksPath, Issuer: "https://issuer.example", Audience: "enricher"}
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":  "alice",
+			"role": "editor",
+			"iss":  "https://issuer.example",
+			"aud":  "enricher",
+			"exp":  now.Add(time.Hour).Unix(),
+		}
+	}
+	with := func(key string, value any) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	noneToken := sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", valid())
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		token  string
+		wantOK bool
+	}{
+		{"HS256", hmacOnly, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", valid()), true},
+		{"HS512", strict, sign(t, jwt.SigningMethodHS512, []byte(testSecret), "", valid()), true},
+		{"RS256", jwksOnly, sign(t, jwt.SigningMethodRS256, rsaKey, "rsa", valid()), true},
+		{"PS256", strict, sign(t, jwt.SigningMethodPS256, rsaKey, "rsa", valid()), true},
+		{"ES256", strict, sign(t, jwt.SigningMethodES256, ecKey, "ec", valid()), true},
+
+		{"alg none with hmac", hmacOnly, noneToken, false},
+		{"alg none with jwks", jwksOnly, noneToken, false},
+		// Подмена алгоритма: HS256, подписанный открытым ключом RSA как секретом
+		{"HS256 signed with rsa public key", jwksOnly, sign(t, jwt.SigningMethodHS256, publicPEM, "rsa", valid()), false},
+		{"HS256 signed with rsa public key and hmac configured", strict, sign(t, jwt.SigningMethodHS256, publicPEM, "rsa", valid()), false},
+		{"RS256 without jwks", hmacOnly, sign(t, jwt.SigningMethodRS256, rsaKey, "rsa", valid()), false},
+		{"RS256 with kid of ec key", strict, sign(t, jwt.SigningMethodRS256, rsaKey, "ec", valid()), false},
+		{"ES256 with kid of rsa key", strict, sign(t, jwt.SigningMethodES256, ecKey, "rsa", valid()), false},
+		{"RS256 signed with other key", jwksOnly, sign(t, jwt.SigningMethodRS256, otherRSAKey, "rsa", valid()), false},
+		{"RS256 with unknown kid", jwksOnly, sign(t, jwt.SigningMethodRS256, rsaKey, "other", valid()), false},
+		{"HS256 wrong secret", hmacOnly, sign(t, jwt.SigningMethodHS256, []byte("another secret of enough length!"), "", valid()), false},
+		{"malformed", hmacOnly, "not.a.jwt", false},
+
+		{"expired", hmacOnly, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("exp", now.Add(-time.Hour).Unix())), false},
+		// Истекший в пределах допуска на расхождение часов
+		{"expired within leeway", hmacOnly, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("exp", now.Add(-10*time.Second).Unix())), true},
+		{"without exp", hmacOnly, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("exp", nil)), false},
+		{"not yet valid", hmacOnly, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("nbf", now.Add(time.Hour).Unix())), false},
+		{"without sub", hmacOnly, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("sub", nil)), false},
+
+		{"wrong iss", strict, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("iss", "https://other.example")), false},
+		{"without iss", strict, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("iss", nil)), false},
+		{"wrong aud", strict, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("aud", "other")), false},
+		{"aud list", strict, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("aud", []string{"other", "enricher"})), true},
+		{"without aud", strict, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("aud", nil)), false},
+		// Без настроенных iss и aud они не проверяются
+		{"iss and aud not configured", hmacOnly, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with("aud", "other")), true},
+
+		{"jwt not configured", Config{}, sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", valid()), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(discard, memory.New(), tt.cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			identity, err := a.Authenticate(context.Background(), tt.token)
+			if !tt.wantOK {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Fatalf("Authenticate() error = %v, want ErrUnauthenticated", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+
+			want := models.Identity{Method: MethodJWT, Subject: "alice", Role: models.RoleEditor}
+			if identity != want {
+				t.Errorf("Authenticate() = %+v, want %+v", identity, want)
+			}
+		})
+	}
+}
+
+func TestNewInvalidJWKS(t *testing.T) {
+	if _, err := New(discard, memory.New(), Config{JWKSPath: writeFile(t, "{}")}); err == nil {
+		t.Fatal("New() with empty jwks: want error")
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	// SHA-256("abc")
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+	if got := hashKey("abc"); got != want {
+		t.Errorf("hashKey() = %s, want %s", got, want)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+
+	a, err := New(discard, store, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, created, err := a.CreateAPIKey(ctx, "  importer  ", models.RoleEditor)
+	if err != nil {
+		t.Fatalf("CreateAPIKey() error = %v", err)
+	}
+
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(key) != len(apiKeyPrefix)+43 {
+		t.Errorf("key = %q, want enr_ and 32 random bytes", key)
+	}
+	if created.Name != "importer" || created.Role != models.RoleEditor || created.ID == 0 {
+		t.Errorf("created = %+v", created)
+	}
+	if created.Prefix != key[:displayPrefixLength] {
+		t.Errorf("prefix = %q, want %q", created.Prefix, key[:displayPrefixLength])
+	}
+
+	// В хранилище только хэш ключа
+	stored, err := store.GetAPIKeyByHash(ctx, hashKey(key))
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash() error = %v", err)
+	}
+	if stored.KeyHash == key || stored.KeyHash != hashKey(key) {
+		t.Errorf("stored hash = %q", stored.KeyHash)
+	}
+
+	identity, err := a.Authenticate(ctx, key)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	want := models.Identity{Method: MethodAPIKey, Subject: "importer", Role: models.RoleEditor}
+	if identity != want {
+		t.Errorf("Authenticate() = %+v, want %+v", identity, want)
+	}
+
+	keys, err := a.ListAPIKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("ListAPIKeys() = %+v, want one key with last use", keys)
+	}
+
+	// Ключ, отличающийся одним символом, не подходит
+	tampered := key[:len(key)-1] + string(key[len(key)-1]^1)
+	if _, err := a.Authenticate(ctx, tampered); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Authenticate(tampered) error = %v, want ErrUnauthenticated", err)
+	}
+
+	if _, _, err := a.CreateAPIKey(ctx, "importer", models.RoleReader); !errors.Is(err, ErrAPIKeyExists) {
+		t.Errorf("CreateAPIKey(duplicate) error = %v, want ErrAPIKeyExists", err)
+	}
+
+	if err := a.RevokeAPIKey(ctx, created.ID); err != nil {
+		t.Fatalf("RevokeAPIKey() error = %v", err)
+	}
+	if _, err := a.Authenticate(ctx, key); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Authenticate(revoked) error = %v, want ErrUnauthenticated", err)
+	}
+	if err := a.RevokeAPIKey(ctx, created.ID+100); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey(unknown) error = %v, want ErrAPIKeyNotFound", err)
+	}
+
+	// После отзыва имя снова свободно
+	if _, _, err := a.CreateAPIKey(ctx, "importer", models.RoleReader); err != nil {
+		t.Errorf("CreateAPIKey(after revoke) error = %v", err)
+	}
+}
+
+func TestCreateAPIKeyInvalid(t *testing.T) {
+	a, err := New(discard, memory.New(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keyName string
+		role    models.Role
+		wantErr error
+	}{
+		{"empty name", "   ", models.RoleReader, ErrInvalidKeyName},
+		{"long name", strings.Repeat("я", 256), models.RoleReader, ErrInvalidKeyName},
+		{"empty role", "importer", "", ErrInvalidRole},
+		{"unknown role", "importer", "owner", ErrInvalidRole},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := a.CreateAPIKey(context.Background(), tt.keyName, tt.role); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CreateAPIKey() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoleFromClaim(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim any
+		want  models.Role
+	}{
+		{"string", "editor", models.RoleEditor},
+		{"array takes highest known role", []any{"reader", "admin", "editor"}, models.RoleAdmin},
+		{"unknown values are skipped", []any{"owner", "reader", 1}, models.RoleReader},
+		// Без известной роли вызывающий опознается, но не получает никаких прав
+		{"missing", nil, ""},
+		{"empty", "", ""},
+		{"unknown", "owner", ""},
+		{"case sensitive", "Admin", ""},
+		{"only unknown values", []any{"owner", "root"}, ""},
+		{"empty array", []any{}, ""},
+		{"not a string", 42, ""},
+		{"object", map[string]any{"role": "admin"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roleFromClaim(tt.claim); got != tt.want {
+				t.Errorf("roleFromClaim(%v) = %q, want %q", tt.claim, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleClaim(t *testing.T) {
+	tests := []struct {
+		name      string
+		roleClaim string
+		claims    jwt.MapClaims
+		want      models.Role
+	}{
+		{"default claim", "", jwt.MapClaims{"role": "editor"}, models.RoleEditor},
+		{"custom claim", "roles", jwt.MapClaims{"roles": []string{"reader", "admin"}, "role": "reader"}, models.RoleAdmin},
+		{"custom claim missing", "roles", jwt.MapClaims{"role": "admin"}, ""},
+		{"no role", "", jwt.MapClaims{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(discard, memory.New(), Config{HMACSecret: testSecret, RoleClaim: tt.roleClaim})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.claims["sub"] = "alice"
+			tt.claims["exp"] = time.Now().Add(time.Hour).Unix()
+
+			identity, err := a.Authenticate(context.Background(), sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", tt.claims))
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if identity.Role != tt.want {
+				t.Errorf("role = %q, want %q", identity.Role, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+)
+
+// keySet - ключи проверки подписи JWT: общий секрет HMAC и открытые ключи JWKS по kid
+type keySet struct {
+	hmac   []byte
+	public map[string]crypto.PublicKey
+}
+
+// jwk - ключ из JWKS (RFC 7517). Поддерживаются RSA и EC на кривых P-256, P-384, P-521
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// methods возвращает алгоритмы, для которых есть ключи. Токен с другим alg (в том числе
+// none или HS256, подписанный открытым ключом RSA) отклоняется до проверки подписи
+func (k *keySet) methods() []string {
+	var methods []string
+
+	if len(k.hmac) > 0 {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+
+	var hasRSA, hasEC bool
+	for _, key := range k.public {
+		switch key.(type) {
+		case *rsa.PublicKey:
+			hasRSA = true
+		case *ecdsa.PublicKey:
+			hasEC = true
+		}
+	}
+	if hasRSA {
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512")
+	}
+	if hasEC {
+		methods = append(methods, "ES256", "ES384", "ES512")
+	}
+
+	return methods
+}
+
+// keyFunc выбирает ключ для токена: секрет для HS*, иначе ключ JWKS по kid из заголовка.
+// Токен без kid принимается, только если в JWKS один ключ
+func (k *keySet) keyFunc(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(k.hmac) == 0 {
+			return nil, errors.New("hmac secret is not configured")
+		}
+		return k.hmac, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := k.public[kid]; ok {
+		return key, nil
+	}
+
+	if kid == "" && len(k.public) == 1 {
+		for _, key := range k.public {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// loadJWKS читает открытые ключи из файла JWKS. Ключи для шифрования (use=enc)
+// и неподдерживаемых типов пропускаются
+func loadJWKS(path string) (map[string]crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks %s: %w", path, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for i, key := range set.Keys {
+		if key.Use == "enc" {
+			continue
+		}
+
+		var public crypto.PublicKey
+		switch key.Kty {
+		case "RSA":
+			public, err = key.rsa()
+		case "EC":
+			public, err = key.ecdsa()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwks %s: key %d (kid %q): %w", path, i, key.Kid, err)
+		}
+
+		if _, ok := keys[key.Kid]; ok {
+			return nil, fmt.Errorf("jwks %s: duplicate kid %q", path, key.Kid)
+		}
+		keys[key.Kid] = public
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks %s: no usable RSA or EC signing keys", path)
+	}
+
+	return keys, nil
+}
+
+func (k jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := decodeInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("n: %w", err)
+	}
+	e, err := decodeInt(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("e: %w", err)
+	}
+
+	if n.BitLen() < 2048 {
+		return nil, fmt.Errorf("rsa key is %d bits, at least 2048 required", n.BitLen())
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid rsa exponent")
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jwk) ecdsa() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := decodeInt(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	y, err := decodeInt(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point is not on the curve")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// decodeInt читает целое из base64url без дополнения, как в JWK
+func decodeInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing value")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
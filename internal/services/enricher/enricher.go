@@ -5,41 +5,107 @@ import (
 	"errors"
 	"fmt"
 	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"go.opentelemetry.io/otel"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 )
 
 type Enricher struct {
 	log              *slog.Logger
 	enricherProvider Provider
+	nameEnricher     NameEnricher
+
+	// Фоновые задачи (импорт): stopping закрывается при Shutdown, после чего
+	// задачи сохраняют прогресс и завершаются, а новые не запускаются
+	mu         sync.Mutex
+	stopping   chan struct{}
+	background sync.WaitGroup
+
+	// Глубина очереди импорта: выполняемые задачи и их еще не обработанные строки
+	runningImports atomic.Int64
+	pendingRows    atomic.Int64
 }
 
-type Provider interface {
-	SaveUser(ctx context.Context, userData models.EnrichedUser) (int64, error)
-	EditUser(ctx context.Context, userData models.EnrichedUser) (models.EnrichedUser, error)
-	DeleteUser(ctx context.Context, id int64) error
-	GetUsers(ctx context.Context, filter models.UserFilter) ([]models.EnrichedUser, error)
-	GetUser(ctx context.Context, id int64) (models.EnrichedUser, error)
+// NameEnricher получает возраст, пол и национальность по имени из внешних источников
+type NameEnricher interface {
+	Enrich(ctx context.Context, name string) (models.Enrichment, error)
 }
 
+// Provider - хранилище пользователей и задач импорта, см. storage.Provider
+type Provider = storage.Provider
+
+// tracer открывает спаны методов сервиса, дочерние к спану HTTP-запроса или команды
+var tracer = otel.Tracer("github.com/sol1corejz/enricher/internal/services/enricher")
+
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrImportNotFound = errors.New("import not found")
+	ErrShuttingDown   = errors.New("service is shutting down")
 )
 
 // New returns a new instance of the Auth service.
 func New(
 	log *slog.Logger,
 	enricherProvider Provider,
+	nameEnricher NameEnricher,
 ) *Enricher {
 	return &Enricher{
 		log:              log,
 		enricherProvider: enricherProvider,
+		nameEnricher:     nameEnricher,
+		stopping:         make(chan struct{}),
+	}
+}
+
+// logger возвращает логгер запроса из ctx (с идентификатором запроса, маршрутом и инициатором)
+// или логгер сервиса для фоновых задач, запущенных не из запроса
+func (a *Enricher) logger(ctx context.Context) *slog.Logger {
+	return reqctx.Logger(ctx, a.log)
+}
+
+// userLogger - logger с user_id. Для запросов к /users/:id логгер запроса уже содержит
+// user_id того же пользователя, и он не повторяется
+func (a *Enricher) userLogger(ctx context.Context, id int64) *slog.Logger {
+	log := a.logger(ctx)
+	if requestUserID, ok := reqctx.UserID(ctx); ok && requestUserID == id {
+		return log
+	}
+
+	return log.With(slog.Int64("user_id", id))
+}
+
+// Enrich дополняет ФИО возрастом, полом и национальностью по имени
+func (a *Enricher) Enrich(ctx context.Context, userData models.SaveUserPayload) (models.EnrichedUser, error) {
+	const op = "enricher.Enrich"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	enrichment, err := a.nameEnricher.Enrich(ctx, userData.Name)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
+
+	return models.EnrichedUser{
+		Name:       userData.Name,
+		Surname:    userData.Surname,
+		Patronymic: userData.Patronymic,
+		Age:        enrichment.Age,
+		Sex:        enrichment.Sex,
+		Country:    enrichment.Country,
+	}, nil
 }
 
 func (a *Enricher) SaveUser(ctx context.Context, userData models.EnrichedUser) (int64, error) {
 	const op = "enricher.SaveUser"
 
-	log := a.log.With(
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(
 		slog.String("op", op),
 	)
 
@@ -47,7 +113,7 @@ func (a *Enricher) SaveUser(ctx context.Context, userData models.EnrichedUser) (
 
 	userID, err := a.enricherProvider.SaveUser(ctx, userData)
 	if err != nil {
-		a.log.Error("failed to save user", err.Error())
+		log.Error("failed to save user", slog.String("error", err.Error()))
 
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
@@ -58,7 +124,10 @@ func (a *Enricher) SaveUser(ctx context.Context, userData models.EnrichedUser) (
 func (a *Enricher) EditUser(ctx context.Context, userData models.EnrichedUser) (models.EnrichedUser, error) {
 	const op = "enricher.EditUser"
 
-	log := a.log.With(
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.userLogger(ctx, userData.ID).With(
 		slog.String("op", op),
 	)
 
@@ -66,7 +135,10 @@ func (a *Enricher) EditUser(ctx context.Context, userData models.EnrichedUser) (
 
 	user, err := a.enricherProvider.EditUser(ctx, userData)
 	if err != nil {
-		a.log.Error("failed to edit user", err.Error())
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.EnrichedUser{}, ErrUserNotFound
+		}
+		log.Error("failed to edit user", slog.String("error", err.Error()))
 
 		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -74,10 +146,59 @@ func (a *Enricher) EditUser(ctx context.Context, userData models.EnrichedUser) (
 	return user, nil
 }
 
+// UpdateUser читает пользователя с блокировкой, применяет к нему update и сохраняет в одной
+// транзакции, поэтому параллельные изменения не затирают друг друга. Ошибка update
+// отменяет изменение и возвращается обернутой (errors.Is/As по ней работают)
+func (a *Enricher) UpdateUser(
+	ctx context.Context,
+	id int64,
+	update func(user *models.EnrichedUser) error,
+) (models.EnrichedUser, error) {
+	const op = "enricher.UpdateUser"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.userLogger(ctx, id).With(
+		slog.String("op", op),
+	)
+
+	log.Info("attempting to update user")
+
+	var updated models.EnrichedUser
+
+	err := a.enricherProvider.WithTx(ctx, func(tx Provider) error {
+		user, err := tx.GetUserForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := update(&user); err != nil {
+			return err
+		}
+
+		updated, err = tx.EditUser(ctx, user)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.EnrichedUser{}, ErrUserNotFound
+		}
+		log.Error("failed to update user", slog.String("error", err.Error()))
+
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return updated, nil
+}
+
 func (a *Enricher) DeleteUser(ctx context.Context, id int64) error {
 	const op = "enricher.DeleteUser"
 
-	log := a.log.With(
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.userLogger(ctx, id).With(
 		slog.String("op", op),
 	)
 
@@ -85,7 +206,10 @@ func (a *Enricher) DeleteUser(ctx context.Context, id int64) error {
 
 	err := a.enricherProvider.DeleteUser(ctx, id)
 	if err != nil {
-		a.log.Error("failed to delete user", err.Error())
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		log.Error("failed to delete user", slog.String("error", err.Error()))
 
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -94,9 +218,12 @@ func (a *Enricher) DeleteUser(ctx context.Context, id int64) error {
 }
 
 func (a *Enricher) GetUsers(ctx context.Context, filter models.UserFilter) ([]models.EnrichedUser, error) {
-	const op = "enricher.GetUser"
+	const op = "enricher.GetUsers"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
 
-	log := a.log.With(
+	log := a.logger(ctx).With(
 		slog.String("op", op),
 	)
 
@@ -107,7 +234,7 @@ func (a *Enricher) GetUsers(ctx context.Context, filter models.UserFilter) ([]mo
 		if errors.Is(err, ErrUserNotFound) {
 			return []models.EnrichedUser{}, ErrUserNotFound
 		}
-		a.log.Error("failed to get user", err.Error())
+		log.Error("failed to get user", slog.String("error", err.Error()))
 
 		return []models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -118,7 +245,10 @@ func (a *Enricher) GetUsers(ctx context.Context, filter models.UserFilter) ([]mo
 func (a *Enricher) GetUser(ctx context.Context, id int64) (models.EnrichedUser, error) {
 	const op = "enricher.GetUser"
 
-	log := a.log.With(
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.userLogger(ctx, id).With(
 		slog.String("op", op),
 	)
 
@@ -126,13 +256,86 @@ func (a *Enricher) GetUser(ctx context.Context, id int64) (models.EnrichedUser,
 
 	user, err := a.enricherProvider.GetUser(ctx, id)
 	if err != nil {
-		if errors.Is(err, ErrUserNotFound) {
+		if errors.Is(err, storage.ErrUserNotFound) {
 			return models.EnrichedUser{}, ErrUserNotFound
 		}
-		a.log.Error("failed to get user", err.Error())
+		log.Error("failed to get user", slog.String("error", err.Error()))
 
 		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return user, nil
 }
+
+func (a *Enricher) SuggestUsers(ctx context.Context, query string, limit int) ([]models.UserSuggestion, error) {
+	const op = "enricher.SuggestUsers"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+	)
+
+	log.Info("attempting to suggest users")
+
+	suggestions, err := a.enricherProvider.SuggestUsers(ctx, query, limit)
+	if err != nil {
+		log.Error("failed to suggest users", slog.String("error", err.Error()))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return suggestions, nil
+}
+
+func (a *Enricher) GetUserStats(ctx context.Context, filter models.UserFilter, opts models.StatsOptions) (models.UserStats, error) {
+	const op = "enricher.GetUserStats"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+	)
+
+	log.Info("attempting to get user stats")
+
+	stats, err := a.enricherProvider.GetUserStats(ctx, filter, opts)
+	if err != nil {
+		log.Error("failed to get user stats", slog.String("error", err.Error()))
+
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
+
+// ExportUsers передает в fn всех пользователей, подходящих под фильтр, не загружая их в память целиком
+func (a *Enricher) ExportUsers(ctx context.Context, filter models.UserFilter, fn func(models.EnrichedUser) error) error {
+	const op = "enricher.ExportUsers"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+	)
+
+	log.Info("attempting to export users")
+
+	exported := 0
+	err := a.enricherProvider.StreamUsers(ctx, filter, func(user models.EnrichedUser) error {
+		exported++
+		return fn(user)
+	})
+	if err != nil {
+		log.Error("failed to export users", slog.Int("exported", exported), slog.String("error", err.Error()))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("users exported", slog.Int("exported", exported))
+
+	return nil
+}
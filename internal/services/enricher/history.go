@@ -0,0 +1,64 @@
+package enricher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"log/slog"
+	"time"
+)
+
+// GetUserHistory возвращает журнал изменений пользователя: кто, когда и что поменял
+func (a *Enricher) GetUserHistory(ctx context.Context, id int64) ([]models.UserAuditEntry, error) {
+	const op = "enricher.GetUserHistory"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.userLogger(ctx, id).With(
+		slog.String("op", op),
+	)
+
+	log.Info("attempting to get user history")
+
+	history, err := a.enricherProvider.GetUserHistory(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		log.Error("failed to get user history", slog.String("error", err.Error()))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return history, nil
+}
+
+// GetUserAsOf возвращает пользователя в том виде, в каком он был в момент asOf
+func (a *Enricher) GetUserAsOf(ctx context.Context, id int64, asOf time.Time) (models.EnrichedUser, error) {
+	const op = "enricher.GetUserAsOf"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.userLogger(ctx, id).With(
+		slog.String("op", op),
+		slog.Time("as_of", asOf),
+	)
+
+	log.Info("attempting to get user version")
+
+	user, err := a.enricherProvider.GetUserAsOf(ctx, id, asOf)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.EnrichedUser{}, ErrUserNotFound
+		}
+		log.Error("failed to get user version", slog.String("error", err.Error()))
+
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
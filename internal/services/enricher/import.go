@@ -0,0 +1,333 @@
+package enricher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"log/slog"
+	"time"
+)
+
+// importProgressEvery - как часто (в строках) фоновый импорт сохраняет прогресс
+const importProgressEvery = 50
+
+// importInterrupted - ошибка задачи, остановленной при завершении сервиса. Обработанные
+// строки к этому моменту уже сохранены вместе с прогрессом
+const importInterrupted = "interrupted by shutdown"
+
+// importAbandoned - ошибка задачи, которую не завершил остановившийся экземпляр сервиса
+// (например, он не уложился в SHUTDOWN_TIMEOUT или упал). Строки, сохраненные до этого, остаются
+const importAbandoned = "abandoned: service stopped before the import finished"
+
+// StartImport создает задачу импорта и запускает ее обработку в фоне.
+// rows - строки, прошедшие разбор и валидацию; rejected - отклоненные строки,
+// они сразу учитываются в прогрессе и отчете об ошибках
+func (a *Enricher) StartImport(
+	ctx context.Context,
+	format string,
+	rows []models.ImportRow,
+	rejected []models.ImportRowError,
+) (models.Import, error) {
+	const op = "enricher.StartImport"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	// Задача регистрируется до создания, чтобы Shutdown не пропустил ее
+	if !a.startBackground() {
+		return models.Import{}, fmt.Errorf("%s: %w", op, ErrShuttingDown)
+	}
+
+	imp, err := a.createImport(ctx, op, format, rows, rejected)
+	if err != nil {
+		a.background.Done()
+		return models.Import{}, err
+	}
+
+	// Задача переживает HTTP-запрос: от контекста запроса берутся только значения
+	// (инициатор и идентификатор запроса для аудита), но не отмена
+	go func() {
+		defer a.background.Done()
+		a.runImport(context.WithoutCancel(ctx), imp, rows)
+	}()
+
+	return imp, nil
+}
+
+// RunImport - синхронный вариант StartImport: возвращает задачу после обработки всех строк
+func (a *Enricher) RunImport(
+	ctx context.Context,
+	format string,
+	rows []models.ImportRow,
+	rejected []models.ImportRowError,
+) (models.Import, error) {
+	const op = "enricher.RunImport"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	imp, err := a.createImport(ctx, op, format, rows, rejected)
+	if err != nil {
+		return models.Import{}, err
+	}
+
+	return a.runImport(ctx, imp, rows), nil
+}
+
+func (a *Enricher) createImport(
+	ctx context.Context,
+	op string,
+	format string,
+	rows []models.ImportRow,
+	rejected []models.ImportRowError,
+) (models.Import, error) {
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+	)
+
+	log.Info("attempting to start import", slog.Int("rows", len(rows)), slog.Int("rejected", len(rejected)))
+
+	imp := models.Import{
+		Status:    models.ImportPending,
+		Format:    format,
+		Total:     len(rows) + len(rejected),
+		Processed: len(rejected),
+		Failed:    len(rejected),
+	}
+
+	// Задача и ошибки отклоненных строк сохраняются вместе: иначе сбой на ошибках оставил бы
+	// задачу, которую никто не выполнит
+	err := a.enricherProvider.WithTx(ctx, func(tx Provider) error {
+		id, err := tx.CreateImport(ctx, imp)
+		if err != nil {
+			return fmt.Errorf("failed to create import: %w", err)
+		}
+		imp.ID = id
+
+		if err := tx.AddImportErrors(ctx, id, rejected); err != nil {
+			return fmt.Errorf("failed to save import errors: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Error("failed to create import", slog.String("error", err.Error()))
+
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return imp, nil
+}
+
+// runImport обогащает и сохраняет строки пачками по importProgressEvery. Каждая пачка
+// сохраняется вместе с прогрессом и ошибками строк в одной транзакции. Ошибка строки
+// не прерывает импорт, а попадает в отчет; задача падает целиком только если не удается
+// сохранить пачку. Возвращает задачу в конечном состоянии
+func (a *Enricher) runImport(ctx context.Context, imp models.Import, rows []models.ImportRow) models.Import {
+	const op = "enricher.runImport"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Int64("import_id", imp.ID),
+	)
+
+	log.Info("import started")
+
+	a.runningImports.Add(1)
+	a.pendingRows.Add(int64(len(rows)))
+	remaining := int64(len(rows))
+	defer func() {
+		a.runningImports.Add(-1)
+		a.pendingRows.Add(-remaining)
+	}()
+
+	imp.Status = models.ImportRunning
+	if err := a.enricherProvider.UpdateImport(ctx, imp); err != nil {
+		log.Error("failed to update import", slog.String("error", err.Error()))
+		return imp
+	}
+
+	// Запросы к внешним API отменяются при Shutdown, чтобы импорт не задерживал остановку
+	// сервиса дольше одной строки. Прогресс сохраняется с исходным ctx
+	enrichCtx, cancel := a.stoppingContext(ctx)
+	defer cancel()
+
+	for start := 0; start < len(rows); start += importProgressEvery {
+		if a.isStopping() {
+			return a.interruptImport(ctx, log, imp)
+		}
+
+		batch := rows[start:min(start+importProgressEvery, len(rows))]
+
+		next, saved, err := a.importBatch(ctx, enrichCtx, imp, batch)
+		if err != nil {
+			log.Error("failed to save import batch", slog.String("error", err.Error()))
+
+			imp.Status = models.ImportFailed
+			imp.Error = "failed to save progress"
+			_ = a.enricherProvider.UpdateImport(ctx, imp)
+
+			return imp
+		}
+		imp = next
+
+		remaining -= int64(saved)
+		a.pendingRows.Add(-int64(saved))
+
+		if saved < len(batch) {
+			return a.interruptImport(ctx, log, imp)
+		}
+	}
+
+	imp.Status = models.ImportCompleted
+	if err := a.enricherProvider.UpdateImport(ctx, imp); err != nil {
+		log.Error("failed to finish import", slog.String("error", err.Error()))
+		return imp
+	}
+
+	log.Info("import finished",
+		slog.Int("succeeded", imp.Succeeded),
+		slog.Int("failed", imp.Failed),
+	)
+
+	return imp
+}
+
+// interruptImport сохраняет задачу, остановленную при завершении сервиса, как failed
+func (a *Enricher) interruptImport(ctx context.Context, log *slog.Logger, imp models.Import) models.Import {
+	log.Warn("import interrupted by shutdown", slog.Int("processed", imp.Processed))
+
+	imp.Status = models.ImportFailed
+	imp.Error = importInterrupted
+	if err := a.enricherProvider.UpdateImport(ctx, imp); err != nil {
+		log.Error("failed to update import", slog.String("error", err.Error()))
+	}
+
+	return imp
+}
+
+// importBatch обогащает строки пачки и сохраняет их, ошибки строк и прогресс задачи
+// в одной транзакции. Каждая строка сохраняется в своей точке сохранения, поэтому
+// ошибка одной строки не откатывает остальные. Если сервис останавливается, обогащение
+// прекращается и сохраняются только уже обработанные строки. Возвращает задачу
+// с обновленными счетчиками и число сохраненных строк
+func (a *Enricher) importBatch(
+	ctx context.Context,
+	enrichCtx context.Context,
+	imp models.Import,
+	batch []models.ImportRow,
+) (models.Import, int, error) {
+	// Обогащение идет до транзакции, чтобы не держать ее открытой на время запросов к внешним API
+	users := make([]models.EnrichedUser, len(batch))
+	enrichErrs := make([]error, len(batch))
+	for i, row := range batch {
+		if a.isStopping() {
+			batch = batch[:i]
+			break
+		}
+
+		users[i], enrichErrs[i] = a.Enrich(enrichCtx, row.Payload)
+
+		// Строка, запрос которой отменен остановкой, не считается ошибочной: она не обработана
+		if enrichErrs[i] != nil && enrichCtx.Err() != nil {
+			batch = batch[:i]
+			break
+		}
+	}
+
+	err := a.enricherProvider.WithTx(ctx, func(tx Provider) error {
+		var rowErrors []models.ImportRowError
+
+		for i, row := range batch {
+			imp.Processed++
+
+			var rowErr error
+			if enrichErrs[i] != nil {
+				rowErr = fmt.Errorf("failed to enrich user data: %w", enrichErrs[i])
+			} else if _, err := tx.SaveUser(ctx, users[i]); err != nil {
+				rowErr = fmt.Errorf("failed to save user: %w", err)
+			}
+
+			if rowErr != nil {
+				imp.Failed++
+				rowErrors = append(rowErrors, models.ImportRowError{Row: row.Row, Error: rowErr.Error()})
+				continue
+			}
+			imp.Succeeded++
+		}
+
+		if err := tx.AddImportErrors(ctx, imp.ID, rowErrors); err != nil {
+			return err
+		}
+
+		return tx.UpdateImport(ctx, imp)
+	})
+	if err != nil {
+		return models.Import{}, 0, err
+	}
+
+	return imp, len(batch), nil
+}
+
+// FailStaleImports помечает failed задачи импорта, брошенные остановившимися экземплярами
+// сервиса: незавершенные и без прогресса дольше staleAfter. Вызывается при старте, пока
+// этот экземпляр еще не запустил своих задач
+func (a *Enricher) FailStaleImports(ctx context.Context, staleAfter time.Duration) (int64, error) {
+	const op = "enricher.FailStaleImports"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+	)
+
+	failed, err := a.enricherProvider.FailStaleImports(ctx, time.Now().Add(-staleAfter), importAbandoned)
+	if err != nil {
+		log.Error("failed to fail stale imports", slog.String("error", err.Error()))
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if failed > 0 {
+		log.Warn("marked abandoned imports as failed", slog.Int64("imports", failed))
+	}
+
+	return failed, nil
+}
+
+// ImportQueue возвращает число выполняемых задач импорта и строк в них, которые еще не обработаны
+func (a *Enricher) ImportQueue() (imports, rows int64) {
+	return a.runningImports.Load(), a.pendingRows.Load()
+}
+
+func (a *Enricher) GetImport(ctx context.Context, id int64) (models.Import, error) {
+	const op = "enricher.GetImport"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Int64("import_id", id),
+	)
+
+	log.Info("attempting to get import")
+
+	imp, err := a.enricherProvider.GetImport(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrImportNotFound) {
+			return models.Import{}, ErrImportNotFound
+		}
+		log.Error("failed to get import", slog.String("error", err.Error()))
+
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return imp, nil
+}
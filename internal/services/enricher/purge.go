@@ -0,0 +1,80 @@
+package enricher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"log/slog"
+	"time"
+)
+
+// RestoreUser восстанавливает мягко удаленного пользователя
+func (a *Enricher) RestoreUser(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = "enricher.RestoreUser"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.userLogger(ctx, id).With(
+		slog.String("op", op),
+	)
+
+	log.Info("attempting to restore user")
+
+	user, err := a.enricherProvider.RestoreUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.EnrichedUser{}, ErrUserNotFound
+		}
+		log.Error("failed to restore user", slog.String("error", err.Error()))
+
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных больше retention назад
+func (a *Enricher) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	const op = "enricher.PurgeDeletedUsers"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Duration("retention", retention),
+	)
+
+	purged, err := a.enricherProvider.PurgeDeletedUsers(ctx, time.Now().Add(-retention))
+	if err != nil {
+		log.Error("failed to purge deleted users", slog.String("error", err.Error()))
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if purged > 0 {
+		log.Info("deleted users purged", slog.Int64("purged", purged))
+	}
+
+	return purged, nil
+}
+
+// RunPurgeJob раз в interval очищает пользователей, удаленных больше retention назад,
+// пока не будет отменен ctx. Ошибки очистки логируются и не прерывают работу
+func (a *Enricher) RunPurgeJob(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = a.PurgeDeletedUsers(ctx, retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package enricher
+
+import (
+	"context"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"log/slog"
+	"time"
+)
+
+// reEnrichBatchSize - сколько устаревших записей выбирается за раз
+const reEnrichBatchSize = 100
+
+// ReEnrich заново обогащает пользователей, данные которых получены раньше staleSince.
+// limit ограничивает количество проверяемых записей (0 - без ограничения).
+// В режиме dryRun данные запрашиваются, но не сохраняются
+func (a *Enricher) ReEnrich(ctx context.Context, staleSince time.Time, limit int, dryRun bool) (models.ReEnrichResult, error) {
+	const op = "enricher.ReEnrich"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Time("stale_since", staleSince),
+		slog.Bool("dry_run", dryRun),
+	)
+
+	log.Info("attempting to re-enrich users")
+
+	var result models.ReEnrichResult
+
+	// Обновленные записи перестают подходить под фильтр, поэтому смещение растет
+	// только на те, что остались устаревшими (ошибки и dry-run)
+	skip := 0
+
+	for limit == 0 || result.Checked < limit {
+		batchSize := reEnrichBatchSize
+		if limit > 0 {
+			batchSize = min(batchSize, limit-result.Checked)
+		}
+
+		users, err := a.enricherProvider.GetUsers(ctx, models.UserFilter{
+			EnrichedBefore: staleSince,
+			Limit:          batchSize,
+			Offset:         skip,
+		})
+		if err != nil {
+			log.Error("failed to get stale users", slog.String("error", err.Error()))
+
+			return result, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if len(users) == 0 {
+			break
+		}
+
+		for _, user := range users {
+			result.Checked++
+
+			enrichment, err := a.nameEnricher.Enrich(ctx, user.Name)
+			if err != nil {
+				log.Warn("failed to re-enrich user", slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+				result.Failed++
+				skip++
+				continue
+			}
+
+			if dryRun {
+				skip++
+				continue
+			}
+
+			user.Age = enrichment.Age
+			user.Sex = enrichment.Sex
+			user.Country = enrichment.Country
+
+			if _, err := a.enricherProvider.ReEnrichUser(ctx, user); err != nil {
+				log.Warn("failed to save re-enriched user", slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+				result.Failed++
+				skip++
+				continue
+			}
+
+			result.Updated++
+		}
+	}
+
+	log.Info("users re-enriched",
+		slog.Int("checked", result.Checked),
+		slog.Int("updated", result.Updated),
+		slog.Int("failed", result.Failed),
+	)
+
+	return result, nil
+}
@@ -0,0 +1,71 @@
+package enricher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Shutdown останавливает фоновые задачи: новые больше не запускаются, а запущенные
+// импорты прерывают запросы к внешним API, сохраняют уже обработанные строки вместе
+// с прогрессом и завершаются. Ждет их не дольше ctx
+func (a *Enricher) Shutdown(ctx context.Context) error {
+	const op = "enricher.Shutdown"
+
+	a.mu.Lock()
+	if !a.isStopping() {
+		close(a.stopping)
+	}
+	a.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		a.log.Info("background tasks stopped", slog.String("op", op))
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s: background tasks did not stop: %w", op, ctx.Err())
+	}
+}
+
+// startBackground регистрирует фоновую задачу. false - сервис уже останавливается
+func (a *Enricher) startBackground() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.isStopping() {
+		return false
+	}
+	a.background.Add(1)
+
+	return true
+}
+
+// stoppingContext возвращает контекст, отменяемый при Shutdown или отмене ctx
+func (a *Enricher) stoppingContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-a.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+func (a *Enricher) isStopping() bool {
+	select {
+	case <-a.stopping:
+		return true
+	default:
+		return false
+	}
+}
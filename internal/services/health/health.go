@@ -0,0 +1,124 @@
+// Package health - проверки готовности сервиса и состояние его зависимостей
+// для /healthz, /readyz и /status
+package health
+
+import (
+	"context"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"log/slog"
+)
+
+// Pinger - хранилище, доступность которого можно проверить
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// SchemaVersioner - хранилище с версионируемой схемой
+type SchemaVersioner interface {
+	SchemaVersion(ctx context.Context) (version uint, dirty bool, err error)
+}
+
+// EnrichmentStatuser отдает состояние источников обогащения и кэша
+type EnrichmentStatuser interface {
+	Status() models.EnrichmentStatus
+}
+
+type Health struct {
+	log        *slog.Logger
+	pinger     Pinger
+	schema     SchemaVersioner
+	latest     uint
+	enrichment EnrichmentStatuser
+}
+
+// New создает сервис проверок состояния. pinger и schema равны nil, если у хранилища нет
+// базы (STORAGE=memory); latest - версия последней встроенной миграции
+func New(
+	log *slog.Logger,
+	pinger Pinger,
+	schema SchemaVersioner,
+	latest uint,
+	enrichment EnrichmentStatuser,
+) *Health {
+	return &Health{
+		log:        log,
+		pinger:     pinger,
+		schema:     schema,
+		latest:     latest,
+		enrichment: enrichment,
+	}
+}
+
+// Ready проверяет, что база отвечает и ее схема совпадает с последней встроенной миграцией.
+// Источники обогащения на готовность не влияют: без них сервис продолжает отдавать данные
+func (h *Health) Ready(ctx context.Context) models.Readiness {
+	const op = "health.Ready"
+
+	log := h.log.With(
+		slog.String("op", op),
+	)
+
+	readiness := models.Readiness{Ready: true}
+
+	if h.pinger != nil {
+		readiness.Database = &models.Check{Status: models.CheckOK}
+
+		if err := h.pinger.Ping(ctx); err != nil {
+			log.Warn("database is not reachable", slog.String("error", err.Error()))
+
+			readiness.Ready = false
+			readiness.Database = &models.Check{Status: models.CheckFailing, Error: err.Error()}
+		}
+	}
+
+	if h.schema != nil {
+		readiness.Migrations = h.migrations(ctx)
+
+		if readiness.Migrations.Status != models.CheckOK {
+			log.Warn("database schema is not ready",
+				slog.Uint64("version", uint64(readiness.Migrations.Version)),
+				slog.Uint64("latest", uint64(readiness.Migrations.Latest)),
+				slog.Bool("dirty", readiness.Migrations.Dirty),
+			)
+
+			readiness.Ready = false
+		}
+	}
+
+	return readiness
+}
+
+func (h *Health) migrations(ctx context.Context) *models.MigrationsCheck {
+	check := &models.MigrationsCheck{Latest: h.latest}
+
+	version, dirty, err := h.schema.SchemaVersion(ctx)
+	if err != nil {
+		check.Status = models.CheckFailing
+		check.Error = err.Error()
+
+		return check
+	}
+	check.Version, check.Dirty = version, dirty
+
+	switch {
+	case dirty:
+		check.Status = models.CheckFailing
+		check.Error = fmt.Sprintf("migration %d failed, the schema is dirty", version)
+	case version != h.latest:
+		check.Status = models.CheckFailing
+		check.Error = fmt.Sprintf("schema version %d does not match the latest migration %d", version, h.latest)
+	default:
+		check.Status = models.CheckOK
+	}
+
+	return check
+}
+
+// Status возвращает готовность вместе с состоянием источников обогащения и кэша
+func (h *Health) Status(ctx context.Context) models.ServiceStatus {
+	return models.ServiceStatus{
+		Readiness:  h.Ready(ctx),
+		Enrichment: h.enrichment.Status(),
+	}
+}
@@ -0,0 +1,107 @@
+// Package quota - суточные квоты обогащения по клиентам: каждое имя, отправленное через API
+// на обогащение (добавление или импорт пользователя), расходует единицу квоты клиента.
+// Расход хранится в базе, поэтому общий для всех экземпляров сервиса, и обнуляется в полночь UTC
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"log/slog"
+	"time"
+)
+
+// ReasonQuota - метка reason для Observer
+const ReasonQuota = "quota"
+
+var ErrQuotaExceeded = errors.New("daily enrichment quota exceeded")
+
+// Store - хранилище расхода квот
+type Store interface {
+	ConsumeEnrichmentQuota(ctx context.Context, client string, day time.Time, n, limit int) (int, error)
+	RefundEnrichmentQuota(ctx context.Context, client string, day time.Time, n int) error
+}
+
+// Observer получает запросы, отклоненные из-за квоты (например, для метрик)
+type Observer interface {
+	ObserveRateLimited(reason string)
+}
+
+type Quota struct {
+	log      *slog.Logger
+	store    Store
+	daily    int
+	observer Observer
+	now      func() time.Time
+}
+
+// New создает сервис квот: daily обогащений на клиента за сутки UTC. observer может быть nil
+func New(log *slog.Logger, store Store, daily int, observer Observer) *Quota {
+	return &Quota{
+		log:      log,
+		store:    store,
+		daily:    daily,
+		observer: observer,
+		now:      time.Now,
+	}
+}
+
+// Consume списывает n обогащений с квоты клиента client за текущие сутки. Если их не хватает,
+// квота не расходуется, а возвращается ErrQuotaExceeded вместе с текущим расходом
+func (q *Quota) Consume(ctx context.Context, client string, n int) (models.QuotaUsage, error) {
+	const op = "quota.Consume"
+
+	day := q.now().UTC().Truncate(24 * time.Hour)
+	usage := models.QuotaUsage{
+		Limit:    q.daily,
+		ResetsAt: day.Add(24 * time.Hour),
+	}
+
+	used, err := q.store.ConsumeEnrichmentQuota(ctx, client, day, n, q.daily)
+	usage.Used = used
+	usage.Remaining = max(q.daily-used, 0)
+
+	if err != nil {
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			if q.observer != nil {
+				q.observer.ObserveRateLimited(ReasonQuota)
+			}
+			reqctx.Logger(ctx, q.log).Info("daily enrichment quota exceeded",
+				slog.String("op", op),
+				slog.String("client", client),
+				slog.Int("requested", n),
+				slog.Int("used", used),
+				slog.Int("limit", q.daily),
+			)
+			return usage, ErrQuotaExceeded
+		}
+		return models.QuotaUsage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return usage, nil
+}
+
+// Refund возвращает клиенту client n обогащений, списанных Consume с результатом usage,
+// если обогащение не состоялось. Возврат идет в те же сутки, даже если они уже сменились
+func (q *Quota) Refund(ctx context.Context, client string, usage models.QuotaUsage, n int) (models.QuotaUsage, error) {
+	const op = "quota.Refund"
+
+	day := usage.ResetsAt.Add(-24 * time.Hour)
+	if err := q.store.RefundEnrichmentQuota(ctx, client, day, n); err != nil {
+		reqctx.Logger(ctx, q.log).Error("failed to refund enrichment quota",
+			slog.String("op", op),
+			slog.String("client", client),
+			slog.Int("n", n),
+			slog.String("error", err.Error()),
+		)
+		return usage, fmt.Errorf("%s: %w", op, err)
+	}
+
+	usage.Used = max(usage.Used-n, 0)
+	usage.Remaining = max(usage.Limit-usage.Used, 0)
+
+	return usage, nil
+}
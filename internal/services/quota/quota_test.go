@@ -0,0 +1,118 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage/memory"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type observer struct {
+	reasons []string
+}
+
+func (o *observer) ObserveRateLimited(reason string) {
+	o.reasons = append(o.reasons, reason)
+}
+
+type failingStore struct{}
+
+func (failingStore) ConsumeEnrichmentQuota(context.Context, string, time.Time, int, int) (int, error) {
+	return 0, errors.New("connection refused")
+}
+
+func (failingStore) RefundEnrichmentQuota(context.Context, string, time.Time, int) error {
+	return errors.New("connection refused")
+}
+
+func TestConsume(t *testing.T) {
+	obs := &observer{}
+	q := New(slog.New(slog.NewTextHandler(io.Discard, nil)), memory.New(), 3, obs)
+
+	moscow := time.FixedZone("MSK", 3*60*60)
+	day1 := time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+
+	steps := []struct {
+		now     time.Time
+		client  string
+		n       int
+		want    models.QuotaUsage
+		wantErr error
+	}{
+		{day1.Add(-time.Hour), "api_key:a", 2, models.QuotaUsage{Limit: 3, Used: 2, Remaining: 1, ResetsAt: day1}, nil},
+		// Сутки считаются по UTC: 02:00 по Москве - еще те же сутки
+		{time.Date(2026, 1, 3, 2, 0, 0, 0, moscow), "api_key:a", 1, models.QuotaUsage{Limit: 3, Used: 3, Remaining: 0, ResetsAt: day1}, nil},
+		{day1.Add(-time.Nanosecond), "api_key:a", 1, models.QuotaUsage{Limit: 3, Used: 3, Remaining: 0, ResetsAt: day1}, ErrQuotaExceeded},
+		// Квоты клиентов независимы
+		{day1.Add(-time.Minute), "api_key:b", 3, models.QuotaUsage{Limit: 3, Used: 3, Remaining: 0, ResetsAt: day1}, nil},
+		// В полночь UTC квота обнуляется
+		{day1, "api_key:a", 1, models.QuotaUsage{Limit: 3, Used: 1, Remaining: 2, ResetsAt: day2}, nil},
+		// Запрос, которому не хватает квоты, не расходует ее частично
+		{day1.Add(time.Hour), "api_key:a", 3, models.QuotaUsage{Limit: 3, Used: 1, Remaining: 2, ResetsAt: day2}, ErrQuotaExceeded},
+		{day1.Add(time.Hour), "api_key:a", 2, models.QuotaUsage{Limit: 3, Used: 3, Remaining: 0, ResetsAt: day2}, nil},
+	}
+
+	for i, step := range steps {
+		q.now = func() time.Time { return step.now }
+
+		got, err := q.Consume(context.Background(), step.client, step.n)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("step %d: got error %v, want %v", i, err, step.wantErr)
+		}
+		if !got.ResetsAt.Equal(step.want.ResetsAt) || got.Limit != step.want.Limit ||
+			got.Used != step.want.Used || got.Remaining != step.want.Remaining {
+			t.Fatalf("step %d: got %+v, want %+v", i, got, step.want)
+		}
+	}
+
+	if len(obs.reasons) != 2 || obs.reasons[0] != ReasonQuota {
+		t.Fatalf("observer: got %q, want two %q", obs.reasons, ReasonQuota)
+	}
+}
+
+func TestConsumeStoreError(t *testing.T) {
+	q := New(slog.New(slog.NewTextHandler(io.Discard, nil)), failingStore{}, 3, nil)
+
+	_, err := q.Consume(context.Background(), "api_key:a", 1)
+	if err == nil || errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("got error %v, want storage error", err)
+	}
+}
+
+func TestRefund(t *testing.T) {
+	q := New(slog.New(slog.NewTextHandler(io.Discard, nil)), memory.New(), 2, nil)
+
+	day1 := time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return day1.Add(-time.Minute) }
+
+	usage, err := q.Consume(context.Background(), "api_key:a", 2)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+
+	// Возврат после полуночи уходит в сутки списания, а не в новые
+	q.now = func() time.Time { return day1.Add(time.Minute) }
+
+	refunded, err := q.Refund(context.Background(), "api_key:a", usage, 1)
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if refunded.Used != 1 || refunded.Remaining != 1 || !refunded.ResetsAt.Equal(day1) {
+		t.Fatalf("Refund: got %+v", refunded)
+	}
+
+	q.now = func() time.Time { return day1.Add(-time.Second) }
+	if got, err := q.Consume(context.Background(), "api_key:a", 1); err != nil || got.Used != 2 {
+		t.Fatalf("Consume after refund: got %+v, %v", got, err)
+	}
+
+	q.now = func() time.Time { return day1.Add(time.Minute) }
+	if got, err := q.Consume(context.Background(), "api_key:a", 2); err != nil || got.Used != 2 {
+		t.Fatalf("Consume on next day: got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,228 @@
+// Package instrumented оборачивает хранилища: замеряет длительность и результат каждой
+// операции и открывает на нее спан трассировки. Операции называются так же, как константы op
+// в самих хранилищах: префикс хранилища (storage.OpPrefix*) и имя метода
+package instrumented
+
+import (
+	"context"
+	"errors"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/metrics"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+// Observer получает длительность и результат операции хранилища
+type Observer interface {
+	ObserveStorage(op, result string, duration time.Duration)
+}
+
+// recorder замеряет операции одного хранилища. Общий для обертки Provider и
+// оберток отдельных хранилищ сервисов (ключей API, квот)
+type recorder struct {
+	opPrefix string
+	system   string
+	observer Observer
+	tracer   trace.Tracer
+}
+
+func newRecorder(opPrefix string, observer Observer) recorder {
+	// Имя хранилища - часть префикса между storage. и точкой. В семантических соглашениях
+	// OpenTelemetry Postgres называется postgresql
+	system := strings.TrimSuffix(strings.TrimPrefix(opPrefix, "storage."), ".")
+	if system == "postgres" {
+		system = "postgresql"
+	}
+
+	return recorder{
+		opPrefix: opPrefix,
+		system:   system,
+		observer: observer,
+		tracer:   otel.Tracer("github.com/sol1corejz/enricher/internal/storage"),
+	}
+}
+
+// start открывает спан операции method и возвращает функцию, которая по ее ошибке
+// закрывает спан и учитывает операцию в метриках
+func (r recorder) start(ctx context.Context, method string) (context.Context, func(err *error)) {
+	op := r.opPrefix + method
+	start := time.Now()
+
+	ctx, span := r.tracer.Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String(r.system),
+			semconv.DBOperationName(method),
+		),
+	)
+
+	return ctx, func(err *error) {
+		result := metrics.ResultOK
+		switch {
+		case *err == nil:
+		case errors.Is(*err, storage.ErrUserNotFound),
+			errors.Is(*err, storage.ErrImportNotFound),
+			errors.Is(*err, storage.ErrAPIKeyNotFound):
+			result = metrics.ResultNotFound
+		// Ожидаемые отказы: хранилище работает, но операция не применяется
+		case errors.Is(*err, storage.ErrAPIKeyExists), errors.Is(*err, storage.ErrQuotaExceeded):
+			result = metrics.ResultRejected
+		default:
+			result = metrics.ResultError
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+
+		r.observer.ObserveStorage(op, result, time.Since(start))
+	}
+}
+
+type Provider struct {
+	recorder
+	next storage.Provider
+}
+
+// New оборачивает next. opPrefix - префикс op хранилища, например storage.OpPrefixPostgres
+func New(next storage.Provider, opPrefix string, observer Observer) *Provider {
+	return &Provider{
+		recorder: newRecorder(opPrefix, observer),
+		next:     next,
+	}
+}
+
+func (p *Provider) SaveUser(ctx context.Context, userData models.EnrichedUser) (id int64, err error) {
+	ctx, done := p.start(ctx, "SaveUser")
+	defer done(&err)
+	return p.next.SaveUser(ctx, userData)
+}
+
+func (p *Provider) EditUser(ctx context.Context, userData models.EnrichedUser) (user models.EnrichedUser, err error) {
+	ctx, done := p.start(ctx, "EditUser")
+	defer done(&err)
+	return p.next.EditUser(ctx, userData)
+}
+
+func (p *Provider) ReEnrichUser(ctx context.Context, userData models.EnrichedUser) (user models.EnrichedUser, err error) {
+	ctx, done := p.start(ctx, "ReEnrichUser")
+	defer done(&err)
+	return p.next.ReEnrichUser(ctx, userData)
+}
+
+func (p *Provider) DeleteUser(ctx context.Context, id int64) (err error) {
+	ctx, done := p.start(ctx, "DeleteUser")
+	defer done(&err)
+	return p.next.DeleteUser(ctx, id)
+}
+
+func (p *Provider) RestoreUser(ctx context.Context, id int64) (user models.EnrichedUser, err error) {
+	ctx, done := p.start(ctx, "RestoreUser")
+	defer done(&err)
+	return p.next.RestoreUser(ctx, id)
+}
+
+func (p *Provider) PurgeDeletedUsers(ctx context.Context, before time.Time) (purged int64, err error) {
+	ctx, done := p.start(ctx, "PurgeDeletedUsers")
+	defer done(&err)
+	return p.next.PurgeDeletedUsers(ctx, before)
+}
+
+func (p *Provider) GetUserHistory(ctx context.Context, id int64) (entries []models.UserAuditEntry, err error) {
+	ctx, done := p.start(ctx, "GetUserHistory")
+	defer done(&err)
+	return p.next.GetUserHistory(ctx, id)
+}
+
+func (p *Provider) GetUsers(ctx context.Context, filter models.UserFilter) (users []models.EnrichedUser, err error) {
+	ctx, done := p.start(ctx, "GetUsers")
+	defer done(&err)
+	return p.next.GetUsers(ctx, filter)
+}
+
+func (p *Provider) GetUser(ctx context.Context, id int64) (user models.EnrichedUser, err error) {
+	ctx, done := p.start(ctx, "GetUser")
+	defer done(&err)
+	return p.next.GetUser(ctx, id)
+}
+
+func (p *Provider) GetUserForUpdate(ctx context.Context, id int64) (user models.EnrichedUser, err error) {
+	ctx, done := p.start(ctx, "GetUserForUpdate")
+	defer done(&err)
+	return p.next.GetUserForUpdate(ctx, id)
+}
+
+func (p *Provider) GetUserAsOf(ctx context.Context, id int64, asOf time.Time) (user models.EnrichedUser, err error) {
+	ctx, done := p.start(ctx, "GetUserAsOf")
+	defer done(&err)
+	return p.next.GetUserAsOf(ctx, id, asOf)
+}
+
+func (p *Provider) SuggestUsers(ctx context.Context, query string, limit int) (suggestions []models.UserSuggestion, err error) {
+	ctx, done := p.start(ctx, "SuggestUsers")
+	defer done(&err)
+	return p.next.SuggestUsers(ctx, query, limit)
+}
+
+func (p *Provider) GetUserStats(
+	ctx context.Context,
+	filter models.UserFilter,
+	opts models.StatsOptions,
+) (stats models.UserStats, err error) {
+	ctx, done := p.start(ctx, "GetUserStats")
+	defer done(&err)
+	return p.next.GetUserStats(ctx, filter, opts)
+}
+
+// StreamUsers замеряет весь проход, включая время обработки строк в fn
+func (p *Provider) StreamUsers(ctx context.Context, filter models.UserFilter, fn func(models.EnrichedUser) error) (err error) {
+	ctx, done := p.start(ctx, "StreamUsers")
+	defer done(&err)
+	return p.next.StreamUsers(ctx, filter, fn)
+}
+
+func (p *Provider) CreateImport(ctx context.Context, imp models.Import) (id int64, err error) {
+	ctx, done := p.start(ctx, "CreateImport")
+	defer done(&err)
+	return p.next.CreateImport(ctx, imp)
+}
+
+func (p *Provider) UpdateImport(ctx context.Context, imp models.Import) (err error) {
+	ctx, done := p.start(ctx, "UpdateImport")
+	defer done(&err)
+	return p.next.UpdateImport(ctx, imp)
+}
+
+func (p *Provider) FailStaleImports(ctx context.Context, before time.Time, reason string) (failed int64, err error) {
+	ctx, done := p.start(ctx, "FailStaleImports")
+	defer done(&err)
+	return p.next.FailStaleImports(ctx, before, reason)
+}
+
+func (p *Provider) AddImportErrors(ctx context.Context, importID int64, rowErrors []models.ImportRowError) (err error) {
+	ctx, done := p.start(ctx, "AddImportErrors")
+	defer done(&err)
+	return p.next.AddImportErrors(ctx, importID, rowErrors)
+}
+
+func (p *Provider) GetImport(ctx context.Context, id int64) (imp models.Import, err error) {
+	ctx, done := p.start(ctx, "GetImport")
+	defer done(&err)
+	return p.next.GetImport(ctx, id)
+}
+
+// WithTx замеряет транзакцию целиком, а операции внутри нее - по отдельности
+func (p *Provider) WithTx(ctx context.Context, fn storage.TxFunc) (err error) {
+	ctx, done := p.start(ctx, "WithTx")
+	defer done(&err)
+	return p.next.WithTx(ctx, func(tx storage.Provider) error {
+		inner := *p
+		inner.next = tx
+
+		return fn(&inner)
+	})
+}
@@ -0,0 +1,181 @@
+package instrumented
+
+import (
+	"context"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"github.com/sol1corejz/enricher/internal/storage/memory"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type observer struct {
+	ops []string
+}
+
+func (o *observer) ObserveStorage(op, result string, duration time.Duration) {
+	o.ops = append(o.ops, op)
+}
+
+// backendOps собирает значения констант op из исходников хранилища dir
+func backendOps(t *testing.T, dir string) map[string]bool {
+	t.Helper()
+
+	prefixes := map[string]string{
+		"OpPrefixPostgres": storage.OpPrefixPostgres,
+		"OpPrefixSQLite":   storage.OpPrefixSQLite,
+		"OpPrefixMemory":   storage.OpPrefixMemory,
+	}
+
+	ops := map[string]bool{}
+	fset := token.NewFileSet()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := parser.ParseFile(fset, path, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			spec, ok := n.(*ast.ValueSpec)
+			if !ok || len(spec.Names) != 1 || spec.Names[0].Name != "op" || len(spec.Values) != 1 {
+				return true
+			}
+
+			// storage.OpPrefix<Backend> + "<Method>"
+			expr, ok := spec.Values[0].(*ast.BinaryExpr)
+			if !ok {
+				t.Errorf("%s: op is not built from a storage prefix", fset.Position(spec.Pos()))
+				return true
+			}
+			prefix, _ := expr.X.(*ast.SelectorExpr)
+			method, _ := expr.Y.(*ast.BasicLit)
+			if prefix == nil || method == nil || prefixes[prefix.Sel.Name] == "" {
+				t.Errorf("%s: op is not built from a storage prefix", fset.Position(spec.Pos()))
+				return true
+			}
+
+			name, err := strconv.Unquote(method.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ops[prefixes[prefix.Sel.Name]+name] = true
+
+			return true
+		})
+	}
+
+	return ops
+}
+
+// callAll вызывает все методы wrapper с нулевыми аргументами и возвращает, какую операцию
+// записал каждый из них
+func callAll(t *testing.T, wrapper any, obs *observer) map[string]string {
+	t.Helper()
+
+	v := reflect.ValueOf(wrapper)
+	ctxType := reflect.TypeOf((*context.Context)(nil)).Elem()
+
+	recorded := map[string]string{}
+	for i := 0; i < v.NumMethod(); i++ {
+		method := v.Type().Method(i)
+		fn := v.Method(i)
+
+		args := make([]reflect.Value, fn.Type().NumIn())
+		for j := range args {
+			in := fn.Type().In(j)
+			switch {
+			case in == ctxType:
+				args[j] = reflect.ValueOf(context.Background())
+			case in.Kind() == reflect.Func:
+				args[j] = reflect.MakeFunc(in, func([]reflect.Value) []reflect.Value {
+					out := make([]reflect.Value, in.NumOut())
+					for k := range out {
+						out[k] = reflect.Zero(in.Out(k))
+					}
+					return out
+				})
+			default:
+				args[j] = reflect.Zero(in)
+			}
+		}
+
+		obs.ops = nil
+		fn.Call(args)
+
+		if len(obs.ops) != 1 {
+			t.Errorf("%s: recorded %v, want one operation", method.Name, obs.ops)
+			continue
+		}
+		recorded[method.Name] = obs.ops[0]
+	}
+
+	return recorded
+}
+
+// TestOpNames проверяет, что метрики и спаны оберток называются так же, как op
+// в хранилищах: префикс хранилища и имя метода
+func TestOpNames(t *testing.T) {
+	postgresOps := backendOps(t, "../postgres")
+	sqliteOps := backendOps(t, "../sqlite")
+	backendOps(t, "../memory")
+
+	obs := &observer{}
+	store := memory.New()
+
+	wrappers := map[string]any{
+		"Provider":   New(store, storage.OpPrefixMemory, obs),
+		"KeyStore":   NewKeyStore(store, storage.OpPrefixMemory, obs),
+		"QuotaStore": NewQuotaStore(store, storage.OpPrefixMemory, obs),
+	}
+
+	for name, wrapper := range wrappers {
+		t.Run(name, func(t *testing.T) {
+			for method, op := range callAll(t, wrapper, obs) {
+				if op != storage.OpPrefixMemory+method {
+					t.Errorf("%s: recorded op %q, want %q", method, op, storage.OpPrefixMemory+method)
+				}
+				if !postgresOps[storage.OpPrefixPostgres+method] {
+					t.Errorf("%s: postgres has no op %s", method, storage.OpPrefixPostgres+method)
+				}
+				if !sqliteOps[storage.OpPrefixSQLite+method] {
+					t.Errorf("%s: sqlite has no op %s", method, storage.OpPrefixSQLite+method)
+				}
+			}
+		})
+	}
+}
+
+func TestSystem(t *testing.T) {
+	tests := map[string]string{
+		storage.OpPrefixPostgres: "postgresql",
+		storage.OpPrefixSQLite:   "sqlite",
+		storage.OpPrefixMemory:   "memory",
+	}
+
+	for prefix, want := range tests {
+		if got := newRecorder(prefix, &observer{}).system; got != want {
+			t.Errorf("system for %s = %q, want %q", prefix, got, want)
+		}
+	}
+}
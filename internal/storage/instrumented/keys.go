@@ -0,0 +1,52 @@
+package instrumented
+
+import (
+	"context"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/services/auth"
+	"time"
+)
+
+// KeyStore - хранилище ключей API сервиса аутентификации с замерами операций
+type KeyStore struct {
+	recorder
+	next auth.KeyStore
+}
+
+// NewKeyStore оборачивает next. opPrefix - префикс op хранилища, как в New
+func NewKeyStore(next auth.KeyStore, opPrefix string, observer Observer) *KeyStore {
+	return &KeyStore{
+		recorder: newRecorder(opPrefix, observer),
+		next:     next,
+	}
+}
+
+func (k *KeyStore) CreateAPIKey(ctx context.Context, key models.APIKey) (id int64, err error) {
+	ctx, done := k.start(ctx, "CreateAPIKey")
+	defer done(&err)
+	return k.next.CreateAPIKey(ctx, key)
+}
+
+func (k *KeyStore) GetAPIKeyByHash(ctx context.Context, hash string) (key models.APIKey, err error) {
+	ctx, done := k.start(ctx, "GetAPIKeyByHash")
+	defer done(&err)
+	return k.next.GetAPIKeyByHash(ctx, hash)
+}
+
+func (k *KeyStore) ListAPIKeys(ctx context.Context) (keys []models.APIKey, err error) {
+	ctx, done := k.start(ctx, "ListAPIKeys")
+	defer done(&err)
+	return k.next.ListAPIKeys(ctx)
+}
+
+func (k *KeyStore) RevokeAPIKey(ctx context.Context, id int64) (err error) {
+	ctx, done := k.start(ctx, "RevokeAPIKey")
+	defer done(&err)
+	return k.next.RevokeAPIKey(ctx, id)
+}
+
+func (k *KeyStore) TouchAPIKey(ctx context.Context, id int64, at time.Time) (err error) {
+	ctx, done := k.start(ctx, "TouchAPIKey")
+	defer done(&err)
+	return k.next.TouchAPIKey(ctx, id, at)
+}
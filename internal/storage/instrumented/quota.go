@@ -0,0 +1,33 @@
+package instrumented
+
+import (
+	"context"
+	"github.com/sol1corejz/enricher/internal/services/quota"
+	"time"
+)
+
+// QuotaStore - хранилище расхода суточных квот обогащения с замерами операций
+type QuotaStore struct {
+	recorder
+	next quota.Store
+}
+
+// NewQuotaStore оборачивает next. opPrefix - префикс op хранилища, как в New
+func NewQuotaStore(next quota.Store, opPrefix string, observer Observer) *QuotaStore {
+	return &QuotaStore{
+		recorder: newRecorder(opPrefix, observer),
+		next:     next,
+	}
+}
+
+func (q *QuotaStore) ConsumeEnrichmentQuota(ctx context.Context, client string, day time.Time, n, limit int) (used int, err error) {
+	ctx, done := q.start(ctx, "ConsumeEnrichmentQuota")
+	defer done(&err)
+	return q.next.ConsumeEnrichmentQuota(ctx, client, day, n, limit)
+}
+
+func (q *QuotaStore) RefundEnrichmentQuota(ctx context.Context, client string, day time.Time, n int) (err error) {
+	ctx, done := q.start(ctx, "RefundEnrichmentQuota")
+	defer done(&err)
+	return q.next.RefundEnrichmentQuota(ctx, client, day, n)
+}
@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"github.com/sol1corejz/enricher/migrations"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// countriesMigration - миграция, заполняющая справочник стран в Postgres.
+// Справочник читается из нее же, чтобы названия не расходились
+const countriesMigration = "000002_add_primary_country.up.sql"
+
+var countryRowRe = regexp.MustCompile(`\('([A-Z]{2})', '((?:[^']|'')*)'\)`)
+
+// countryNames возвращает названия стран по коду ISO 3166
+var countryNames = sync.OnceValue(func() map[string]string {
+	names := map[string]string{}
+
+	sql, err := migrations.FS.ReadFile(countriesMigration)
+	if err != nil {
+		return names
+	}
+
+	for _, m := range countryRowRe.FindAllStringSubmatch(string(sql), -1) {
+		names[m[1]] = strings.ReplaceAll(m[2], "''", "'")
+	}
+
+	return names
+})
@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"sort"
+	"time"
+)
+
+func (s *Storage) CreateImport(ctx context.Context, imp models.Import) (int64, error) {
+	var id int64
+
+	err := s.write(func(d *data) error {
+		d.lastImportID++
+		id = d.lastImportID
+
+		now := time.Now()
+		d.imports[id] = models.Import{
+			ID:        id,
+			Status:    imp.Status,
+			Format:    imp.Format,
+			Total:     imp.Total,
+			Processed: imp.Processed,
+			Succeeded: imp.Succeeded,
+			Failed:    imp.Failed,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		d.importErrors[id] = map[int]string{}
+
+		return nil
+	})
+
+	return id, err
+}
+
+// UpdateImport сохраняет статус и счетчики прогресса задачи. finished_at проставляется
+// при переходе в конечный статус
+func (s *Storage) UpdateImport(ctx context.Context, imp models.Import) error {
+	const op = storage.OpPrefixMemory + "UpdateImport"
+
+	return s.write(func(d *data) error {
+		current, ok := d.imports[imp.ID]
+		if !ok {
+			return fmt.Errorf("%s: %w", op, storage.ErrImportNotFound)
+		}
+
+		now := time.Now()
+		current.Status = imp.Status
+		current.Processed = imp.Processed
+		current.Succeeded = imp.Succeeded
+		current.Failed = imp.Failed
+		current.Error = imp.Error
+		current.UpdatedAt = now
+		current.FinishedAt = nil
+		if imp.Status == models.ImportCompleted || imp.Status == models.ImportFailed {
+			current.FinishedAt = &now
+		}
+
+		d.imports[imp.ID] = current
+
+		return nil
+	})
+}
+
+// FailStaleImports переводит в failed с ошибкой reason незавершенные задачи, прогресс
+// которых не обновлялся с before, и возвращает их количество
+func (s *Storage) FailStaleImports(ctx context.Context, before time.Time, reason string) (int64, error) {
+	var failed int64
+
+	err := s.write(func(d *data) error {
+		now := time.Now()
+		for id, imp := range d.imports {
+			finished := imp.Status != models.ImportPending && imp.Status != models.ImportRunning
+			if finished || !imp.UpdatedAt.Before(before) {
+				continue
+			}
+
+			imp.Status = models.ImportFailed
+			imp.Error = reason
+			imp.UpdatedAt = now
+			imp.FinishedAt = &now
+			d.imports[id] = imp
+			failed++
+		}
+
+		return nil
+	})
+
+	return failed, err
+}
+
+// AddImportErrors сохраняет ошибки строк; повторная ошибка той же строки игнорируется
+func (s *Storage) AddImportErrors(ctx context.Context, importID int64, rowErrors []models.ImportRowError) error {
+	const op = storage.OpPrefixMemory + "AddImportErrors"
+
+	if len(rowErrors) == 0 {
+		return nil
+	}
+
+	return s.write(func(d *data) error {
+		stored, ok := d.importErrors[importID]
+		if !ok {
+			// В Postgres это нарушение внешнего ключа import_errors.import_id
+			return fmt.Errorf("%s: %w", op, storage.ErrImportNotFound)
+		}
+
+		for _, rowError := range rowErrors {
+			if _, exists := stored[rowError.Row]; !exists {
+				stored[rowError.Row] = rowError.Error
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *Storage) GetImport(ctx context.Context, id int64) (models.Import, error) {
+	const op = storage.OpPrefixMemory + "GetImport"
+
+	var imp models.Import
+	var ok bool
+	s.read(func(d *data) {
+		imp, ok = d.imports[id]
+		if !ok {
+			return
+		}
+
+		imp.Errors = make([]models.ImportRowError, 0, len(d.importErrors[id]))
+		for row, msg := range d.importErrors[id] {
+			imp.Errors = append(imp.Errors, models.ImportRowError{Row: row, Error: msg})
+		}
+	})
+
+	if !ok {
+		return models.Import{}, fmt.Errorf("%s: %w", op, storage.ErrImportNotFound)
+	}
+
+	sort.Slice(imp.Errors, func(i, j int) bool { return imp.Errors[i].Row < imp.Errors[j].Row })
+
+	return imp, nil
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"sort"
+	"time"
+)
+
+// CreateAPIKey сохраняет ключ API. Имя должно быть уникально среди действующих ключей
+func (s *Storage) CreateAPIKey(ctx context.Context, key models.APIKey) (int64, error) {
+	const op = storage.OpPrefixMemory + "CreateAPIKey"
+
+	var id int64
+
+	err := s.write(func(d *data) error {
+		for _, existing := range d.apiKeys {
+			if existing.KeyHash == key.KeyHash || (existing.Name == key.Name && existing.RevokedAt == nil) {
+				return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyExists)
+			}
+		}
+
+		d.lastAPIKeyID++
+		id = d.lastAPIKeyID
+
+		d.apiKeys[id] = models.APIKey{
+			ID:        id,
+			Name:      key.Name,
+			Prefix:    key.Prefix,
+			Role:      key.Role,
+			KeyHash:   key.KeyHash,
+			CreatedAt: time.Now(),
+		}
+
+		return nil
+	})
+
+	return id, err
+}
+
+// GetAPIKeyByHash возвращает действующий ключ по хэшу
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	const op = storage.OpPrefixMemory + "GetAPIKeyByHash"
+
+	var key models.APIKey
+	var found bool
+
+	s.read(func(d *data) {
+		for _, existing := range d.apiKeys {
+			if existing.KeyHash == hash && existing.RevokedAt == nil {
+				key, found = existing, true
+				return
+			}
+		}
+	})
+
+	if !found {
+		return models.APIKey{}, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys возвращает все ключи, включая отозванные, в порядке создания
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+
+	s.read(func(d *data) {
+		for _, key := range d.apiKeys {
+			keys = append(keys, key)
+		}
+	})
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает действующий ключ
+func (s *Storage) RevokeAPIKey(ctx context.Context, id int64) error {
+	const op = storage.OpPrefixMemory + "RevokeAPIKey"
+
+	return s.write(func(d *data) error {
+		key, ok := d.apiKeys[id]
+		if !ok || key.RevokedAt != nil {
+			return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+		}
+
+		now := time.Now()
+		key.RevokedAt = &now
+		d.apiKeys[id] = key
+
+		return nil
+	})
+}
+
+// TouchAPIKey отмечает время последнего использования ключа
+func (s *Storage) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	return s.write(func(d *data) error {
+		if key, ok := d.apiKeys[id]; ok {
+			key.LastUsedAt = &at
+			d.apiKeys[id] = key
+		}
+
+		return nil
+	})
+}
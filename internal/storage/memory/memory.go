@@ -0,0 +1,485 @@
+// Package memory - реализация storage.Provider в памяти процесса для тестов и демо-режима
+// (STORAGE=memory). Фильтрация, сортировка и пагинация повторяют postgres.Storage;
+// данные теряются при перезапуске
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Storage struct {
+	st *state
+
+	// tx - копия данных, которую меняет транзакция WithTx; остальным изменения видны только
+	// после фиксации. nil - вне транзакции. Хранилище с tx уже владеет txMu
+	tx *data
+}
+
+// state - общие данные всех копий Storage. Изменения сериализуются через txMu:
+// одиночная операция держит его на время записи, WithTx - на всю транзакцию.
+// mu защищает зафиксированные данные от одновременного чтения и записи
+type state struct {
+	txMu sync.Mutex
+	mu   sync.RWMutex
+	data data
+}
+
+type data struct {
+	lastUserID    int64
+	lastImportID  int64
+	lastAuditID   int64
+	lastVersionID int64
+	lastAPIKeyID  int64
+
+	users        map[int64]models.EnrichedUser
+	versions     []version
+	audit        []models.UserAuditEntry
+	imports      map[int64]models.Import
+	importErrors map[int64]map[int]string
+	apiKeys      map[int64]models.APIKey
+	usage        map[usageKey]int
+}
+
+// usageKey - клиент и сутки (UTC, YYYY-MM-DD) расхода квоты обогащения, как в enrichment_usage
+type usageKey struct {
+	client string
+	day    string
+}
+
+// version - состояние пользователя в интервале [validFrom, validTo), как в users_history
+type version struct {
+	id        int64
+	user      models.EnrichedUser
+	validFrom time.Time
+	validTo   *time.Time
+}
+
+func New() *Storage {
+	return &Storage{
+		st: &state{
+			data: data{
+				users:        map[int64]models.EnrichedUser{},
+				imports:      map[int64]models.Import{},
+				importErrors: map[int64]map[int]string{},
+				apiKeys:      map[int64]models.APIKey{},
+				usage:        map[usageKey]int{},
+			},
+		},
+	}
+}
+
+// clone копирует данные для транзакции. Записи пользователей и задач
+// не изменяются на месте, поэтому достаточно скопировать контейнеры
+func (d *data) clone() data {
+	c := *d
+
+	c.users = make(map[int64]models.EnrichedUser, len(d.users))
+	for id, user := range d.users {
+		c.users[id] = user
+	}
+
+	c.versions = slices.Clone(d.versions)
+	c.audit = slices.Clip(d.audit)
+
+	c.imports = make(map[int64]models.Import, len(d.imports))
+	for id, imp := range d.imports {
+		c.imports[id] = imp
+	}
+
+	c.importErrors = make(map[int64]map[int]string, len(d.importErrors))
+	for id, rowErrors := range d.importErrors {
+		c.importErrors[id] = make(map[int]string, len(rowErrors))
+		for row, msg := range rowErrors {
+			c.importErrors[id][row] = msg
+		}
+	}
+
+	c.apiKeys = make(map[int64]models.APIKey, len(d.apiKeys))
+	for id, key := range d.apiKeys {
+		c.apiKeys[id] = key
+	}
+
+	c.usage = make(map[usageKey]int, len(d.usage))
+	for key, used := range d.usage {
+		c.usage[key] = used
+	}
+
+	return c
+}
+
+// write применяет fn к данным под блокировкой записи. fn должна сначала проверить
+// все условия и только потом менять данные, чтобы ошибка не оставляла их наполовину измененными
+func (s *Storage) write(fn func(d *data) error) error {
+	// Копия транзакции принадлежит только ей
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	s.st.txMu.Lock()
+	defer s.st.txMu.Unlock()
+
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	return fn(&s.st.data)
+}
+
+// read применяет fn к данным транзакции или, вне ее, к зафиксированным данным
+func (s *Storage) read(fn func(d *data)) {
+	if s.tx != nil {
+		fn(s.tx)
+		return
+	}
+
+	s.st.mu.RLock()
+	defer s.st.mu.RUnlock()
+
+	fn(&s.st.data)
+}
+
+// WithTx выполняет fn как транзакцию над копией данных: другие изменения ждут ее завершения,
+// чтения вне нее видят данные до начала, а копия заменяет данные, только если fn вернула nil.
+// При ошибке или панике в fn копия отбрасывается. Вложенный WithTx работает с копией копии
+// и откатывает только свои изменения
+func (s *Storage) WithTx(ctx context.Context, fn storage.TxFunc) error {
+	if s.tx == nil {
+		s.st.txMu.Lock()
+		defer s.st.txMu.Unlock()
+	}
+
+	var staged data
+	s.read(func(d *data) {
+		staged = d.clone()
+	})
+
+	if err := fn(&Storage{st: s.st, tx: &staged}); err != nil {
+		return err
+	}
+
+	if s.tx != nil {
+		*s.tx = staged
+		return nil
+	}
+
+	s.st.mu.Lock()
+	s.st.data = staged
+	s.st.mu.Unlock()
+
+	return nil
+}
+
+func (s *Storage) SaveUser(ctx context.Context, user models.EnrichedUser) (int64, error) {
+	const op = storage.OpPrefixMemory + "SaveUser"
+
+	if err := validateUser(user); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var id int64
+	err := s.write(func(d *data) error {
+		d.lastUserID++
+		id = d.lastUserID
+
+		user.ID = id
+		user.EnrichedAt = time.Now()
+		user.DeletedAt = nil
+		created := withPrimaryCountry(user)
+
+		d.users[id] = created
+		d.recordChange(ctx, id, models.AuditCreate, nil, &created)
+
+		return nil
+	})
+
+	return id, err
+}
+
+func (s *Storage) EditUser(ctx context.Context, user models.EnrichedUser) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixMemory + "EditUser"
+
+	return s.update(ctx, op, user.ID, models.AuditEdit, func(current models.EnrichedUser) (models.EnrichedUser, error) {
+		if current.DeletedAt != nil {
+			return models.EnrichedUser{}, storage.ErrUserNotFound
+		}
+		if err := validateUser(user); err != nil {
+			return models.EnrichedUser{}, err
+		}
+
+		current.Name = user.Name
+		current.Surname = user.Surname
+		current.Patronymic = user.Patronymic
+		current.Age = user.Age
+		current.Sex = user.Sex
+		current.Country = user.Country
+
+		return current, nil
+	})
+}
+
+// ReEnrichUser обновляет данные обогащения пользователя и отмечает время обогащения
+func (s *Storage) ReEnrichUser(ctx context.Context, user models.EnrichedUser) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixMemory + "ReEnrichUser"
+
+	return s.update(ctx, op, user.ID, models.AuditReEnrich, func(current models.EnrichedUser) (models.EnrichedUser, error) {
+		if current.DeletedAt != nil {
+			return models.EnrichedUser{}, storage.ErrUserNotFound
+		}
+		if err := validateUser(user); err != nil {
+			return models.EnrichedUser{}, err
+		}
+
+		current.Age = user.Age
+		current.Sex = user.Sex
+		current.Country = user.Country
+		current.EnrichedAt = time.Now()
+
+		return current, nil
+	})
+}
+
+// DeleteUser мягко удаляет пользователя
+func (s *Storage) DeleteUser(ctx context.Context, id int64) error {
+	const op = storage.OpPrefixMemory + "DeleteUser"
+
+	_, err := s.update(ctx, op, id, models.AuditDelete, func(current models.EnrichedUser) (models.EnrichedUser, error) {
+		if current.DeletedAt != nil {
+			return models.EnrichedUser{}, storage.ErrUserNotFound
+		}
+
+		now := time.Now()
+		current.DeletedAt = &now
+
+		return current, nil
+	})
+
+	return err
+}
+
+// RestoreUser снимает отметку об удалении. Для неудаленного пользователя ничего не меняет
+func (s *Storage) RestoreUser(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixMemory + "RestoreUser"
+
+	var restored models.EnrichedUser
+	err := s.write(func(d *data) error {
+		before, ok := d.users[id]
+		if !ok {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		restored = before
+		if before.DeletedAt == nil {
+			return nil
+		}
+
+		restored.DeletedAt = nil
+		d.users[id] = restored
+		d.recordChange(ctx, id, models.AuditRestore, &before, &restored)
+
+		return nil
+	})
+
+	return restored, err
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных раньше before
+func (s *Storage) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+
+	err := s.write(func(d *data) error {
+		now := time.Now()
+
+		for id, user := range d.users {
+			if user.DeletedAt == nil || !user.DeletedAt.Before(before) {
+				continue
+			}
+
+			delete(d.users, id)
+			d.closeVersion(id, now)
+			purged++
+		}
+
+		return nil
+	})
+
+	return purged, err
+}
+
+func (s *Storage) GetUser(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixMemory + "GetUser"
+
+	var user models.EnrichedUser
+	var ok bool
+	s.read(func(d *data) {
+		user, ok = d.users[id]
+	})
+
+	if !ok || user.DeletedAt != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return user, nil
+}
+
+// GetUserForUpdate в памяти не отличается от GetUser: изменения внутри WithTx и так сериализованы
+func (s *Storage) GetUserForUpdate(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixMemory + "GetUserForUpdate"
+
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// GetUserAsOf возвращает версию пользователя, действовавшую в момент asOf
+func (s *Storage) GetUserAsOf(ctx context.Context, id int64, asOf time.Time) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixMemory + "GetUserAsOf"
+
+	var user models.EnrichedUser
+	found := false
+	s.read(func(d *data) {
+		for _, v := range d.versions {
+			if v.user.ID == id && v.validAt(asOf) && v.user.DeletedAt == nil {
+				user, found = v.user, true
+				return
+			}
+		}
+	})
+
+	if !found {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return user, nil
+}
+
+// GetUserHistory возвращает журнал изменений пользователя от старых записей к новым
+func (s *Storage) GetUserHistory(ctx context.Context, id int64) ([]models.UserAuditEntry, error) {
+	const op = storage.OpPrefixMemory + "GetUserHistory"
+
+	history := []models.UserAuditEntry{}
+	exists := false
+	s.read(func(d *data) {
+		for _, entry := range d.audit {
+			if entry.UserID == id {
+				history = append(history, entry)
+			}
+		}
+		_, exists = d.users[id]
+	})
+
+	if len(history) == 0 && !exists {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return history, nil
+}
+
+// update изменяет пользователя id функцией change и фиксирует событие action.
+// Отсутствующий пользователь - storage.ErrUserNotFound
+func (s *Storage) update(
+	ctx context.Context,
+	op string,
+	id int64,
+	action models.AuditAction,
+	change func(current models.EnrichedUser) (models.EnrichedUser, error),
+) (models.EnrichedUser, error) {
+	var after models.EnrichedUser
+
+	err := s.write(func(d *data) error {
+		before, ok := d.users[id]
+		if !ok {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		changed, err := change(before)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		after = withPrimaryCountry(changed)
+		d.users[id] = after
+		d.recordChange(ctx, id, action, &before, &after)
+
+		return nil
+	})
+
+	return after, err
+}
+
+// recordChange добавляет событие в журнал аудита и новую версию пользователя
+func (d *data) recordChange(
+	ctx context.Context,
+	id int64,
+	action models.AuditAction,
+	before, after *models.EnrichedUser,
+) {
+	now := time.Now()
+
+	d.lastAuditID++
+	d.audit = append(d.audit, models.UserAuditEntry{
+		ID:        d.lastAuditID,
+		UserID:    id,
+		Action:    action,
+		Before:    snapshot(before),
+		After:     snapshot(after),
+		Actor:     reqctx.Actor(ctx),
+		RequestID: reqctx.RequestID(ctx),
+		CreatedAt: now,
+	})
+
+	d.closeVersion(id, now)
+
+	if user, ok := d.users[id]; ok {
+		d.lastVersionID++
+		d.versions = append(d.versions, version{id: d.lastVersionID, user: user, validFrom: now})
+	}
+}
+
+func (d *data) closeVersion(id int64, now time.Time) {
+	for i := range d.versions {
+		if d.versions[i].user.ID == id && d.versions[i].validTo == nil {
+			d.versions[i].validTo = &now
+		}
+	}
+}
+
+func (v version) validAt(t time.Time) bool {
+	return !v.validFrom.After(t) && (v.validTo == nil || v.validTo.After(t))
+}
+
+func snapshot(user *models.EnrichedUser) *models.EnrichedUser {
+	if user == nil {
+		return nil
+	}
+
+	c := *user
+	return &c
+}
+
+// validateUser повторяет CHECK-ограничение таблицы users
+func validateUser(user models.EnrichedUser) error {
+	if user.Sex != "male" && user.Sex != "female" {
+		return fmt.Errorf("invalid sex %q", user.Sex)
+	}
+
+	return nil
+}
+
+// withPrimaryCountry заполняет наиболее вероятную страну с названием из справочника
+func withPrimaryCountry(user models.EnrichedUser) models.EnrichedUser {
+	user.PrimaryCountry = models.TopCountry(user.Country)
+	if user.PrimaryCountry != nil {
+		user.PrimaryCountry.Name = countryNames()[user.PrimaryCountry.CountryID]
+	}
+
+	return user
+}
@@ -0,0 +1,62 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"github.com/sol1corejz/enricher/internal/storage/memory"
+	"github.com/sol1corejz/enricher/internal/storage/storagetest"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Provider { return memory.New() })
+}
+
+// TestWithTxIsolation проверяет, что чтения вне транзакции не видят ее незафиксированных изменений
+func TestWithTxIsolation(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+
+	saved := make(chan int64)
+	commit := make(chan struct{})
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.WithTx(ctx, func(tx storage.Provider) error {
+			id, err := tx.SaveUser(ctx, models.EnrichedUser{Name: "Ivan", Surname: "Petrov", Age: 30, Sex: "male"})
+			if err != nil {
+				return err
+			}
+
+			saved <- id
+			<-commit
+
+			return nil
+		})
+	}()
+
+	var id int64
+	select {
+	case id = <-saved:
+	case err := <-done:
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	if _, err := s.GetUser(ctx, id); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("GetUser during transaction: got error %v, want %v", err, storage.ErrUserNotFound)
+	}
+	if users, err := s.GetUsers(ctx, models.UserFilter{}); err != nil || len(users) != 0 {
+		t.Errorf("GetUsers during transaction: got %d users, error %v, want none", len(users), err)
+	}
+
+	close(commit)
+	if err := <-done; err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	if _, err := s.GetUser(ctx, id); err != nil {
+		t.Errorf("GetUser after commit: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/filterexpr"
+	"github.com/sol1corejz/enricher/internal/lib/textsearch"
+	"sort"
+	"strings"
+)
+
+// similarityThreshold - порог оператора % из pg_trgm (pg_trgm.similarity_threshold по умолчанию)
+const similarityThreshold = 0.3
+
+func (s *Storage) GetUsers(ctx context.Context, filter models.UserFilter) ([]models.EnrichedUser, error) {
+	users, err := s.selectUsers(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Offset > 0 {
+		users = users[min(filter.Offset, len(users)):]
+	}
+	if filter.Limit > 0 && filter.Limit < len(users) {
+		users = users[:filter.Limit]
+	}
+
+	// Как и database/sql без строк, пустая выборка - nil
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	return users, nil
+}
+
+// StreamUsers вызывает fn для всех пользователей, подходящих под фильтр, без пагинации
+func (s *Storage) StreamUsers(ctx context.Context, filter models.UserFilter, fn func(models.EnrichedUser) error) error {
+	users, err := s.selectUsers(models.UserFilter{
+		Search:         filter.Search,
+		Name:           filter.Name,
+		Surname:        filter.Surname,
+		Patronymic:     filter.Patronymic,
+		AgeFrom:        filter.AgeFrom,
+		AgeTo:          filter.AgeTo,
+		EnrichedBefore: filter.EnrichedBefore,
+		Sex:            filter.Sex,
+		Country:        filter.Country,
+		Expression:     filter.Expression,
+		AsOf:           filter.AsOf,
+		IncludeDeleted: filter.IncludeDeleted,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Выгрузка всегда идет по порядку id, без ранжирования поиска
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) SuggestUsers(ctx context.Context, query string, limit int) ([]models.UserSuggestion, error) {
+	words := textsearch.Words(query)
+
+	type candidate struct {
+		user       models.EnrichedUser
+		rank       int
+		similarity float64
+	}
+
+	var candidates []candidate
+	s.read(func(d *data) {
+		for _, user := range d.users {
+			if user.DeletedAt != nil {
+				continue
+			}
+
+			rank := searchRank(user, words)
+			similarity := textsearch.Similarity(fullName(user), query)
+			if rank == 0 && similarity <= similarityThreshold {
+				continue
+			}
+
+			candidates = append(candidates, candidate{user: user, rank: rank, similarity: similarity})
+		}
+	})
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.rank != b.rank {
+			return a.rank > b.rank
+		}
+		if a.similarity != b.similarity {
+			return a.similarity > b.similarity
+		}
+		return a.user.ID < b.user.ID
+	})
+
+	suggestions := []models.UserSuggestion{}
+	for _, c := range candidates {
+		if len(suggestions) == limit {
+			break
+		}
+		suggestions = append(suggestions, models.UserSuggestion{ID: c.user.ID, FullName: fullName(c.user)})
+	}
+
+	return suggestions, nil
+}
+
+// selectUsers выбирает пользователей по фильтру (без пагинации) в порядке GetUsers:
+// по id, а при поиске - сначала по релевантности
+func (s *Storage) selectUsers(filter models.UserFilter) ([]models.EnrichedUser, error) {
+	words := textsearch.Words(filter.Search)
+
+	var source []models.EnrichedUser
+	s.read(func(d *data) {
+		if filter.AsOf.IsZero() {
+			source = make([]models.EnrichedUser, 0, len(d.users))
+			for _, user := range d.users {
+				source = append(source, user)
+			}
+			return
+		}
+
+		for _, v := range d.versions {
+			if v.validAt(filter.AsOf) {
+				source = append(source, v.user)
+			}
+		}
+	})
+
+	ranks := map[int64]int{}
+	users := make([]models.EnrichedUser, 0, len(source))
+
+	for _, user := range source {
+		ok, err := matchUser(user, filter, words)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		ranks[user.ID] = searchRank(user, words)
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if ri, rj := ranks[users[i].ID], ranks[users[j].ID]; ri != rj {
+			return ri > rj
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	return users, nil
+}
+
+// matchUser повторяет условия postgres.userConditions
+func matchUser(user models.EnrichedUser, filter models.UserFilter, words []string) (bool, error) {
+	switch {
+	case !filter.IncludeDeleted && user.DeletedAt != nil:
+		return false, nil
+	case len(words) > 0 && searchRank(user, words) == 0:
+		return false, nil
+	case filter.Name != "" && !containsFold(user.Name, filter.Name):
+		return false, nil
+	case filter.Surname != "" && !containsFold(user.Surname, filter.Surname):
+		return false, nil
+	case filter.Patronymic != "" && !containsFold(user.Patronymic, filter.Patronymic):
+		return false, nil
+	case filter.AgeFrom > 0 && user.Age < filter.AgeFrom:
+		return false, nil
+	case filter.AgeTo > 0 && user.Age > filter.AgeTo:
+		return false, nil
+	case !filter.EnrichedBefore.IsZero() && !user.EnrichedAt.Before(filter.EnrichedBefore):
+		return false, nil
+	case filter.Sex != "" && user.Sex != filter.Sex:
+		return false, nil
+	case filter.Country != "" && !containsFold(countryText(user.Country), filter.Country):
+		return false, nil
+	}
+
+	if filter.Expression == nil {
+		return true, nil
+	}
+
+	return filterexpr.Match(filter.Expression, func(field string) (filterexpr.Value, bool) {
+		switch field {
+		case "id":
+			return filterexpr.Value{Type: filterexpr.Int, Int: user.ID}, true
+		case "age":
+			return filterexpr.Value{Type: filterexpr.Int, Int: int64(user.Age)}, true
+		case "name":
+			return filterexpr.Value{Str: user.Name}, true
+		case "surname":
+			return filterexpr.Value{Str: user.Surname}, true
+		case "patronymic":
+			return filterexpr.Value{Str: user.Patronymic}, true
+		case "sex":
+			return filterexpr.Value{Str: user.Sex}, true
+		case "country":
+			if user.PrimaryCountry == nil {
+				return filterexpr.Value{}, false
+			}
+			return filterexpr.Value{Str: user.PrimaryCountry.CountryID}, true
+		default:
+			return filterexpr.Value{}, false
+		}
+	})
+}
+
+// searchRank - релевантность пользователя для слов поиска, 0 - не подходит
+func searchRank(user models.EnrichedUser, words []string) int {
+	return textsearch.PrefixRank(user.Name+" "+user.Surname+" "+user.Patronymic, words)
+}
+
+// fullName собирается так же, как сгенерированная колонка users.full_name
+func fullName(user models.EnrichedUser) string {
+	name := user.Name + " " + user.Surname
+	if user.Patronymic != "" {
+		name += " " + user.Patronymic
+	}
+
+	return name
+}
+
+// countryText - аналог country::text для поиска по подстроке
+func countryText(countries []models.Country) string {
+	data, err := json.Marshal(countries)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
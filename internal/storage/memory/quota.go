@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"time"
+)
+
+// ConsumeEnrichmentQuota списывает n обогащений клиента client за сутки day, если после этого
+// расход не превысит limit, и возвращает новый расход. Иначе ничего не меняет и возвращает
+// текущий расход и storage.ErrQuotaExceeded
+func (s *Storage) ConsumeEnrichmentQuota(ctx context.Context, client string, day time.Time, n, limit int) (int, error) {
+	const op = storage.OpPrefixMemory + "ConsumeEnrichmentQuota"
+
+	key := usageKey{client: client, day: day.UTC().Format("2006-01-02")}
+
+	var used int
+	err := s.write(func(d *data) error {
+		used = d.usage[key]
+		if used+n > limit {
+			return fmt.Errorf("%s: %w", op, storage.ErrQuotaExceeded)
+		}
+
+		used += n
+		d.usage[key] = used
+
+		return nil
+	})
+
+	return used, err
+}
+
+// RefundEnrichmentQuota возвращает клиенту client n обогащений, списанных за сутки day
+// (например, если обогащение не удалось). Расход не становится меньше нуля
+func (s *Storage) RefundEnrichmentQuota(ctx context.Context, client string, day time.Time, n int) error {
+	key := usageKey{client: client, day: day.UTC().Format("2006-01-02")}
+
+	return s.write(func(d *data) error {
+		if used, ok := d.usage[key]; ok {
+			d.usage[key] = max(used-n, 0)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"sort"
+)
+
+func (s *Storage) GetUserStats(ctx context.Context, filter models.UserFilter, opts models.StatsOptions) (models.UserStats, error) {
+	filter.Limit, filter.Offset = 0, 0
+
+	users, err := s.selectUsers(filter)
+	if err != nil {
+		return models.UserStats{}, err
+	}
+
+	stats := models.UserStats{
+		BySex:        map[string]int64{},
+		AgeHistogram: models.NewAgeHistogram(opts.AgeBuckets),
+		TopCountries: []models.CountryStats{},
+	}
+
+	type countryTotal struct {
+		count  int64
+		ageSum int64
+	}
+	countries := map[string]*countryTotal{}
+
+	for _, user := range users {
+		stats.Total++
+		stats.BySex[user.Sex]++
+		stats.AgeHistogram[widthBucket(user.Age, opts.AgeBuckets)].Count++
+
+		if user.PrimaryCountry == nil {
+			continue
+		}
+
+		total, ok := countries[user.PrimaryCountry.CountryID]
+		if !ok {
+			total = &countryTotal{}
+			countries[user.PrimaryCountry.CountryID] = total
+		}
+		total.count++
+		total.ageSum += int64(user.Age)
+	}
+
+	for code, total := range countries {
+		stats.TopCountries = append(stats.TopCountries, models.CountryStats{
+			CountryID:  code,
+			Name:       countryNames()[code],
+			Count:      total.count,
+			AverageAge: float64(total.ageSum) / float64(total.count),
+		})
+	}
+
+	sort.Slice(stats.TopCountries, func(i, j int) bool {
+		a, b := stats.TopCountries[i], stats.TopCountries[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.CountryID < b.CountryID
+	})
+
+	if len(stats.TopCountries) > opts.TopCountries {
+		stats.TopCountries = stats.TopCountries[:opts.TopCountries]
+	}
+
+	return stats, nil
+}
+
+// widthBucket повторяет width_bucket(age, bounds): 0 - меньше первой границы,
+// len(bounds) - не меньше последней
+func widthBucket(age int, bounds []int) int {
+	return sort.Search(len(bounds), func(i int) bool { return bounds[i] > age })
+}
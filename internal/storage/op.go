@@ -0,0 +1,10 @@
+package storage
+
+// Префиксы имен операций хранилищ. op метода - префикс и имя метода, например
+// storage.postgres.SaveUser: так операция называется в ошибках и логах хранилища,
+// а через instrumented - в метриках и спанах
+const (
+	OpPrefixPostgres = "storage.postgres."
+	OpPrefixSQLite   = "storage.sqlite."
+	OpPrefixMemory   = "storage.memory."
+)
@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"time"
+)
+
+// auditedUpdate выполняет изменяющий запрос query над пользователем id и в той же
+// транзакции записывает событие action в user_audit и новую версию в users_history. Строка блокируется до изменения,
+// чтобы снимок before совпадал с тем, что перезаписывается. query должен возвращать
+// строку по userColumns; если он ничего не вернул, пользователь считается не найденным
+func (s *Storage) auditedUpdate(
+	ctx context.Context,
+	id int64,
+	action models.AuditAction,
+	query string,
+	args ...any,
+) (models.EnrichedUser, error) {
+	tx, err := s.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return models.EnrichedUser{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockUser(ctx, tx, id)
+	if err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	after, err := scanUser(tx.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.EnrichedUser{}, storage.ErrUserNotFound
+		}
+		return models.EnrichedUser{}, err
+	}
+
+	if err := recordChange(ctx, tx, id, action, &before, &after); err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	return after, nil
+}
+
+// lockUser читает пользователя (в том числе мягко удаленного) с блокировкой строки до конца транзакции
+func lockUser(ctx context.Context, tx pgx.Tx, id int64) (models.EnrichedUser, error) {
+	user, err := scanUser(tx.QueryRow(ctx, `
+		SELECT `+userColumns+`
+		FROM `+userSource+`
+		WHERE u.id = $1
+		FOR UPDATE OF u
+	`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.EnrichedUser{}, storage.ErrUserNotFound
+		}
+		return models.EnrichedUser{}, err
+	}
+
+	return user, nil
+}
+
+// recordChange фиксирует изменение пользователя: событие в журнале аудита и новую версию
+func recordChange(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID int64,
+	action models.AuditAction,
+	before, after *models.EnrichedUser,
+) error {
+	if err := writeAudit(ctx, tx, userID, action, before, after); err != nil {
+		return err
+	}
+
+	return writeVersion(ctx, tx, userID)
+}
+
+// writeVersion закрывает текущую версию пользователя в users_history и открывает новую
+// по текущему состоянию строки users. Граница берется по clock_timestamp(), а не now():
+// now() - начало транзакции, и транзакция, начавшаяся раньше, но дождавшаяся блокировки
+// строки позже, закрыла бы версию соседа раньше ее начала. Обе стороны границы равны,
+// поэтому интервалы версий идут без разрывов
+func writeVersion(ctx context.Context, tx pgx.Tx, userID int64) error {
+	var boundary time.Time
+	err := tx.QueryRow(ctx, `
+		WITH closed AS (
+			UPDATE users_history SET valid_to = GREATEST(clock_timestamp(), valid_from)
+			WHERE id = $1 AND valid_to IS NULL
+			RETURNING valid_to
+		)
+		SELECT coalesce((SELECT valid_to FROM closed), clock_timestamp())
+	`, userID).Scan(&boundary)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO users_history (id, name, surname, patronymic, age, sex, country,
+			primary_country, primary_country_probability, enriched_at, deleted_at, valid_from)
+		SELECT id, name, surname, patronymic, age, sex, country,
+			primary_country, primary_country_probability, enriched_at, deleted_at, $2
+		FROM users
+		WHERE id = $1
+	`, userID, boundary)
+
+	return err
+}
+
+// writeAudit добавляет запись в user_audit. Инициатор и идентификатор запроса берутся из ctx
+func writeAudit(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID int64,
+	action models.AuditAction,
+	before, after *models.EnrichedUser,
+) error {
+	beforeData, err := auditSnapshot(before)
+	if err != nil {
+		return err
+	}
+
+	afterData, err := auditSnapshot(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_audit (user_id, action, before, after, actor, request_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+	`, userID, action, beforeData, afterData, reqctx.Actor(ctx), reqctx.RequestID(ctx))
+
+	return err
+}
+
+func auditSnapshot(user *models.EnrichedUser) (any, error) {
+	if user == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit snapshot: %w", err)
+	}
+
+	return data, nil
+}
+
+// GetUserHistory возвращает журнал изменений пользователя от старых записей к новым.
+// История доступна и для мягко удаленных пользователей
+func (s *Storage) GetUserHistory(ctx context.Context, id int64) ([]models.UserAuditEntry, error) {
+	const op = storage.OpPrefixPostgres + "GetUserHistory"
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, action, before, after, COALESCE(actor, ''), COALESCE(request_id, ''), created_at
+		FROM user_audit
+		WHERE user_id = $1
+		ORDER BY id ASC
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	history := []models.UserAuditEntry{}
+
+	for rows.Next() {
+		var entry models.UserAuditEntry
+		var beforeData, afterData []byte
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.Action,
+			&beforeData,
+			&afterData,
+			&entry.Actor,
+			&entry.RequestID,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if entry.Before, err = parseSnapshot(beforeData); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if entry.After, err = parseSnapshot(afterData); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		history = append(history, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(history) > 0 {
+		return history, nil
+	}
+
+	// Пользователи, созданные до появления аудита, существуют без истории
+	var exists bool
+	err = s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return history, nil
+}
+
+func parseSnapshot(data []byte) (*models.EnrichedUser, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var user models.EnrichedUser
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal audit snapshot: %w", err)
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/filterexpr"
+	"github.com/sol1corejz/enricher/internal/lib/textsearch"
+	"strings"
+)
+
+// filterColumns сопоставляет полям models.UserFilterFields колонки запроса
+var filterColumns = map[string]string{
+	"id":         "u.id",
+	"name":       "u.name",
+	"surname":    "u.surname",
+	"patronymic": "u.patronymic",
+	"age":        "u.age",
+	"sex":        "u.sex",
+	"country":    "u.primary_country",
+}
+
+// userConditions собирает условия WHERE по фильтру (без сортировки и пагинации) для запросов
+// к userSourceFor(filter). Каждое условие начинается с " AND ", плейсхолдеры нумеруются с $1.
+// Если задан полнотекстовый поиск, tsquery всегда передается первым аргументом.
+// Мягко удаленные пользователи исключаются, если не задан IncludeDeleted
+func userConditions(filter models.UserFilter) (string, []any, error) {
+	var conditions strings.Builder
+	args := []any{}
+	argPos := 1
+
+	if !filter.IncludeDeleted {
+		conditions.WriteString(" AND u.deleted_at IS NULL")
+	}
+
+	if tsQuery := prefixTSQuery(filter.Search); tsQuery != "" {
+		conditions.WriteString(fmt.Sprintf(" AND u.search_vector @@ to_tsquery('simple', $%d)", argPos))
+		args = append(args, tsQuery)
+		argPos++
+	}
+
+	if filter.Name != "" {
+		conditions.WriteString(fmt.Sprintf(" AND u.name ILIKE $%d", argPos))
+		args = append(args, "%"+filter.Name+"%")
+		argPos++
+	}
+
+	if filter.Surname != "" {
+		conditions.WriteString(fmt.Sprintf(" AND u.surname ILIKE $%d", argPos))
+		args = append(args, "%"+filter.Surname+"%")
+		argPos++
+	}
+
+	if filter.Patronymic != "" {
+		conditions.WriteString(fmt.Sprintf(" AND u.patronymic ILIKE $%d", argPos))
+		args = append(args, "%"+filter.Patronymic+"%")
+		argPos++
+	}
+
+	if filter.AgeFrom > 0 {
+		conditions.WriteString(fmt.Sprintf(" AND u.age >= $%d", argPos))
+		args = append(args, filter.AgeFrom)
+		argPos++
+	}
+
+	if filter.AgeTo > 0 {
+		conditions.WriteString(fmt.Sprintf(" AND u.age <= $%d", argPos))
+		args = append(args, filter.AgeTo)
+		argPos++
+	}
+
+	if !filter.AsOf.IsZero() {
+		conditions.WriteString(fmt.Sprintf(" AND u.valid_from <= $%d AND (u.valid_to IS NULL OR u.valid_to > $%d)", argPos, argPos))
+		args = append(args, filter.AsOf)
+		argPos++
+	}
+
+	if !filter.EnrichedBefore.IsZero() {
+		conditions.WriteString(fmt.Sprintf(" AND u.enriched_at < $%d", argPos))
+		args = append(args, filter.EnrichedBefore)
+		argPos++
+	}
+
+	if filter.Sex != "" {
+		conditions.WriteString(fmt.Sprintf(" AND u.sex = $%d", argPos))
+		args = append(args, filter.Sex)
+		argPos++
+	}
+
+	if filter.Country != "" {
+		conditions.WriteString(fmt.Sprintf(" AND u.country::text ILIKE $%d", argPos))
+		args = append(args, "%"+filter.Country+"%")
+		argPos++
+	}
+
+	if filter.Expression != nil {
+		condition, exprArgs, err := filterexpr.ToSQL(filter.Expression, filterColumns, argPos)
+		if err != nil {
+			return "", nil, err
+		}
+
+		conditions.WriteString(" AND " + condition)
+		args = append(args, exprArgs...)
+	}
+
+	return conditions.String(), args, nil
+}
+
+// userSourceFor выбирает источник строк: текущие данные или, если задан AsOf, версии из users_history
+func userSourceFor(filter models.UserFilter) string {
+	if !filter.AsOf.IsZero() {
+		return historySource
+	}
+
+	return userSource
+}
+
+// prefixTSQuery превращает строку поиска в tsquery с префиксным совпадением каждого слова:
+// "ivan petr" -> "ivan:* & petr:*". Все символы, кроме букв и цифр, отбрасываются,
+// поэтому результат безопасно передавать в to_tsquery
+func prefixTSQuery(search string) string {
+	words := textsearch.Words(search)
+
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
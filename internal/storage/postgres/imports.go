@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"strings"
+	"time"
+)
+
+const importErrorsBatchSize = 1000
+
+func (s *Storage) CreateImport(ctx context.Context, imp models.Import) (int64, error) {
+	const op = storage.OpPrefixPostgres + "CreateImport"
+
+	var id int64
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO imports (status, format, total, processed, succeeded, failed)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, imp.Status, imp.Format, imp.Total, imp.Processed, imp.Succeeded, imp.Failed).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// UpdateImport сохраняет статус и счетчики прогресса задачи. finished_at проставляется
+// при переходе в конечный статус
+func (s *Storage) UpdateImport(ctx context.Context, imp models.Import) error {
+	const op = storage.OpPrefixPostgres + "UpdateImport"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE imports
+		SET status = $1, processed = $2, succeeded = $3, failed = $4, error = NULLIF($5, ''),
+			updated_at = now(),
+			finished_at = CASE WHEN $1 IN ('completed', 'failed') THEN now() END
+		WHERE id = $6
+	`, imp.Status, imp.Processed, imp.Succeeded, imp.Failed, imp.Error, imp.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrImportNotFound)
+	}
+
+	return nil
+}
+
+// FailStaleImports переводит в failed с ошибкой reason незавершенные задачи, прогресс
+// которых не обновлялся с before, и возвращает их количество
+func (s *Storage) FailStaleImports(ctx context.Context, before time.Time, reason string) (int64, error) {
+	const op = storage.OpPrefixPostgres + "FailStaleImports"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE imports
+		SET status = 'failed', error = $1, updated_at = now(), finished_at = now()
+		WHERE status IN ('pending', 'running') AND updated_at < $2
+	`, reason, before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (s *Storage) AddImportErrors(ctx context.Context, importID int64, rowErrors []models.ImportRowError) error {
+	const op = storage.OpPrefixPostgres + "AddImportErrors"
+
+	// Вставляем пачками, чтобы не упереться в лимит параметров запроса
+	for len(rowErrors) > 0 {
+		batch := rowErrors[:min(len(rowErrors), importErrorsBatchSize)]
+		rowErrors = rowErrors[len(batch):]
+
+		values := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*2+1)
+		args = append(args, importID)
+
+		for i, rowError := range batch {
+			values = append(values, fmt.Sprintf("($1, $%d, $%d)", i*2+2, i*2+3))
+			args = append(args, rowError.Row, rowError.Error)
+		}
+
+		_, err := s.db.Exec(ctx, `
+			INSERT INTO import_errors (import_id, row_number, error)
+			VALUES `+strings.Join(values, ", ")+`
+			ON CONFLICT (import_id, row_number) DO NOTHING
+		`, args...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) GetImport(ctx context.Context, id int64) (models.Import, error) {
+	const op = storage.OpPrefixPostgres + "GetImport"
+
+	var imp models.Import
+
+	err := s.db.QueryRow(ctx, `
+		SELECT id, status, format, total, processed, succeeded, failed, coalesce(error, ''),
+			created_at, updated_at, finished_at
+		FROM imports
+		WHERE id = $1
+	`, id).Scan(
+		&imp.ID,
+		&imp.Status,
+		&imp.Format,
+		&imp.Total,
+		&imp.Processed,
+		&imp.Succeeded,
+		&imp.Failed,
+		&imp.Error,
+		&imp.CreatedAt,
+		&imp.UpdatedAt,
+		&imp.FinishedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Import{}, fmt.Errorf("%s: %w", op, storage.ErrImportNotFound)
+		}
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT row_number, error
+		FROM import_errors
+		WHERE import_id = $1
+		ORDER BY row_number ASC
+	`, id)
+	if err != nil {
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	imp.Errors = []models.ImportRowError{}
+
+	for rows.Next() {
+		var rowError models.ImportRowError
+		if err := rows.Scan(&rowError.Row, &rowError.Error); err != nil {
+			return models.Import{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		imp.Errors = append(imp.Errors, rowError)
+	}
+
+	if err = rows.Err(); err != nil {
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return imp, nil
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"time"
+)
+
+// CreateAPIKey сохраняет ключ API. Имя должно быть уникально среди действующих ключей
+func (s *Storage) CreateAPIKey(ctx context.Context, key models.APIKey) (int64, error) {
+	const op = storage.OpPrefixPostgres + "CreateAPIKey"
+
+	var id int64
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO api_keys (name, prefix, role, key_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, key.Name, key.Prefix, key.Role, key.KeyHash).Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// GetAPIKeyByHash возвращает действующий ключ по хэшу
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	const op = storage.OpPrefixPostgres + "GetAPIKeyByHash"
+
+	var key models.APIKey
+	err := s.db.QueryRow(ctx, `
+		SELECT id, name, prefix, role, key_hash, created_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL
+	`, hash).Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.Role,
+		&key.KeyHash,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.APIKey{}, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+		}
+		return models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys возвращает все ключи, включая отозванные, в порядке создания
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	const op = storage.OpPrefixPostgres + "ListAPIKeys"
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, prefix, role, key_hash, created_at, last_used_at, revoked_at
+		FROM api_keys
+		ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+
+	for rows.Next() {
+		var key models.APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.Name,
+			&key.Prefix,
+			&key.Role,
+			&key.KeyHash,
+			&key.CreatedAt,
+			&key.LastUsedAt,
+			&key.RevokedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает действующий ключ
+func (s *Storage) RevokeAPIKey(ctx context.Context, id int64) error {
+	const op = storage.OpPrefixPostgres + "RevokeAPIKey"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE api_keys
+		SET revoked_at = now()
+		WHERE id = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+	}
+
+	return nil
+}
+
+// TouchAPIKey отмечает время последнего использования ключа
+func (s *Storage) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	const op = storage.OpPrefixPostgres + "TouchAPIKey"
+
+	if _, err := s.db.Exec(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, at); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -2,213 +2,489 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	_ "github.com/jackc/pgx/v5/stdlib"
-	"github.com/joho/godotenv"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sol1corejz/enricher/internal/domain/models"
 	"github.com/sol1corejz/enricher/internal/storage"
-	"os"
+	"time"
 )
 
 type Storage struct {
-	db *sql.DB
+	pool *pgxpool.Pool
+
+	// db - пул или, внутри WithTx, транзакция. Все запросы идут через него
+	db querier
+}
+
+// querier - общее подмножество pgxpool.Pool и pgx.Tx
+type querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Config - параметры пула соединений. Нулевые значения оставляют настройки
+// из строки подключения (pool_max_conns и т.п.) или значения pgxpool по умолчанию
+type Config struct {
+	URL string
+
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+
+	// Сколько подготовленных запросов кэшируется на каждом соединении
+	StatementCacheCapacity int
+
+	// Сколько ждать ответа на Ping при подключении
+	ConnectTimeout time.Duration
 }
 
-func New() (*Storage, error) {
-	const op = "storage.postgres.New"
+const defaultConnectTimeout = 5 * time.Second
+
+// userColumns - список колонок пользователя вместе с названием основной страны из справочника
+const userColumns = `u.id, u.name, u.surname, u.patronymic, u.age, u.sex, u.country,
+	u.primary_country, u.primary_country_probability, c.name, u.enriched_at, u.deleted_at`
+
+// exportBatchSize - сколько строк за раз читается из курсора в StreamUsers
+const exportBatchSize = 500
+
+// userSource - таблица пользователей, присоединенная к справочнику стран
+const userSource = `users u LEFT JOIN countries c ON c.code = u.primary_country`
+
+// historySource - версии пользователей под тем же псевдонимом u, что и в userSource,
+// чтобы к ним подходили userColumns и userConditions
+const historySource = `users_history u LEFT JOIN countries c ON c.code = u.primary_country`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// New создает пул соединений и проверяет доступность базы
+func New(ctx context.Context, cfg Config) (*Storage, error) {
+	const op = storage.OpPrefixPostgres + "New"
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+	// Запросы выполняются в режиме QueryExecModeCacheStatement: каждый запрос
+	// подготавливается один раз на соединение и дальше берется из кэша
+	if cfg.StatementCacheCapacity > 0 {
+		poolConfig.ConnConfig.StatementCacheCapacity = cfg.StatementCacheCapacity
+	}
+	poolConfig.ConnConfig.Tracer = newQueryTracer()
 
-	db, err := sql.Open("pgx", GetDatabaseURL())
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Storage{db: db}, nil
+	connectTimeout := cfg.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	if err := pool.Ping(pingCtx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Storage{pool: pool, db: pool}, nil
 }
 
+// WithTx выполняет fn в одной транзакции. Provider, переданный в fn, работает внутри нее:
+// чтение через GetUserForUpdate блокирует строки до конца транзакции. Если fn вернула ошибку,
+// транзакция откатывается, и ошибка возвращается как есть. Вложенный WithTx использует
+// точку сохранения
+func (s *Storage) WithTx(ctx context.Context, fn storage.TxFunc) error {
+	const op = storage.OpPrefixPostgres + "WithTx"
+
+	tx, err := s.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&Storage{pool: s.pool, db: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// begin начинает транзакцию, а внутри WithTx - точку сохранения (opts тогда не применяются,
+// действуют параметры внешней транзакции)
+func (s *Storage) begin(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	if tx, ok := s.db.(pgx.Tx); ok {
+		return tx.Begin(ctx)
+	}
+
+	return s.pool.BeginTx(ctx, opts)
+}
+
+// Ping проверяет, что база отвечает
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = storage.OpPrefixPostgres + "Ping"
+
+	if err := s.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SchemaVersion возвращает версию схемы из таблицы мигратора. Если миграции еще
+// не применялись, возвращается 0 без ошибки
+func (s *Storage) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	const op = storage.OpPrefixPostgres + "SchemaVersion"
+
+	var version int64
+	var dirty bool
+
+	err := s.pool.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == "42P01") {
+			return 0, false, nil
+		}
+
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uint(version), dirty, nil
+}
+
+// Stats возвращает текущее состояние пула соединений
+func (s *Storage) Stats() models.PoolStats {
+	stat := s.pool.Stat()
+
+	return models.PoolStats{
+		MaxConns:             stat.MaxConns(),
+		TotalConns:           stat.TotalConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		IdleConns:            stat.IdleConns(),
+		ConstructingConns:    stat.ConstructingConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireDuration:      stat.AcquireDuration(),
+		NewConnsCount:        stat.NewConnsCount(),
+	}
+}
+
+// Close закрывает все соединения пула, дожидаясь возврата занятых
+func (s *Storage) Close() {
+	s.pool.Close()
+}
+
+// SaveUser сохраняет нового пользователя, записывает событие create в журнал аудита и первую версию
 func (s *Storage) SaveUser(ctx context.Context, user models.EnrichedUser) (int64, error) {
-	const op = "storage.postgres.SaveUser"
+	const op = storage.OpPrefixPostgres + "SaveUser"
 
-	stmt, err := s.db.Prepare(`INSERT INTO users (name, surname, patronymic, age, sex, country) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`)
+	tx, err := s.begin(ctx, pgx.TxOptions{})
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback(ctx)
+
+	primaryCountry, primaryProbability := primaryCountryArgs(user.Country)
 
-	var id int64
-	err = stmt.QueryRowContext(ctx, user.Name, user.Surname, user.Patronymic, user.Age, user.Sex, user.Country).Scan(&id)
+	created, err := scanUser(tx.QueryRow(ctx, `
+		WITH u AS (
+			INSERT INTO users (name, surname, patronymic, age, sex, country, primary_country, primary_country_probability)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING *
+		)
+		SELECT `+userColumns+`
+		FROM u LEFT JOIN countries c ON c.code = u.primary_country
+	`,
+		user.Name,
+		user.Surname,
+		user.Patronymic,
+		user.Age,
+		user.Sex,
+		user.Country,
+		primaryCountry,
+		primaryProbability,
+	))
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return id, nil
+	if err := recordChange(ctx, tx, created.ID, models.AuditCreate, nil, &created); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return created.ID, nil
 }
 
 func (s *Storage) EditUser(ctx context.Context, user models.EnrichedUser) (models.EnrichedUser, error) {
-	const op = "storage.postgres.EditUser"
-
-	stmt, err := s.db.Prepare(`
-		UPDATE users 
-		SET name = $1, surname = $2, patronymic = $3, age = $4, sex = $5, country = $6
-		WHERE id = $7
-		RETURNING id, name, surname, patronymic, age, sex, country
-	`)
-	if err != nil {
-		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
-	}
-	defer stmt.Close()
+	const op = storage.OpPrefixPostgres + "EditUser"
 
-	var countryData []byte
-	var updatedUser models.EnrichedUser
-	err = stmt.QueryRowContext(
-		ctx,
+	primaryCountry, primaryProbability := primaryCountryArgs(user.Country)
+
+	updatedUser, err := s.auditedUpdate(ctx, user.ID, models.AuditEdit, `
+		WITH u AS (
+			UPDATE users
+			SET name = $1, surname = $2, patronymic = $3, age = $4, sex = $5, country = $6,
+				primary_country = $7, primary_country_probability = $8
+			WHERE id = $9 AND deleted_at IS NULL
+			RETURNING *
+		)
+		SELECT `+userColumns+`
+		FROM u LEFT JOIN countries c ON c.code = u.primary_country
+	`,
 		user.Name,
 		user.Surname,
 		user.Patronymic,
 		user.Age,
 		user.Sex,
 		user.Country,
+		primaryCountry,
+		primaryProbability,
 		user.ID,
-	).Scan(
-		&updatedUser.ID,
-		&updatedUser.Name,
-		&updatedUser.Surname,
-		&updatedUser.Patronymic,
-		&updatedUser.Age,
-		&updatedUser.Sex,
-		&countryData,
 	)
 	if err != nil {
 		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if len(countryData) > 0 {
-		if err := json.Unmarshal(countryData, &updatedUser.Country); err != nil {
-			return models.EnrichedUser{}, fmt.Errorf("%s: failed to unmarshal country data: %w", op, err)
-		}
+	return updatedUser, nil
+}
+
+// ReEnrichUser обновляет данные обогащения пользователя и отмечает время обогащения
+func (s *Storage) ReEnrichUser(ctx context.Context, user models.EnrichedUser) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixPostgres + "ReEnrichUser"
+
+	primaryCountry, primaryProbability := primaryCountryArgs(user.Country)
+
+	updatedUser, err := s.auditedUpdate(ctx, user.ID, models.AuditReEnrich, `
+		WITH u AS (
+			UPDATE users
+			SET age = $1, sex = $2, country = $3,
+				primary_country = $4, primary_country_probability = $5,
+				enriched_at = now()
+			WHERE id = $6 AND deleted_at IS NULL
+			RETURNING *
+		)
+		SELECT `+userColumns+`
+		FROM u LEFT JOIN countries c ON c.code = u.primary_country
+	`,
+		user.Age,
+		user.Sex,
+		user.Country,
+		primaryCountry,
+		primaryProbability,
+		user.ID,
+	)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return updatedUser, nil
 }
 
+// DeleteUser мягко удаляет пользователя: строка скрывается из выборок, но ее можно
+// восстановить через RestoreUser до очистки PurgeDeletedUsers
 func (s *Storage) DeleteUser(ctx context.Context, id int64) error {
-	const op = "storage.postgres.DeleteUser"
-
-	stmt, err := s.db.Prepare(`DELETE FROM users WHERE id = $1`)
+	const op = storage.OpPrefixPostgres + "DeleteUser"
+
+	_, err := s.auditedUpdate(ctx, id, models.AuditDelete, `
+		WITH u AS (
+			UPDATE users
+			SET deleted_at = now()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING *
+		)
+		SELECT `+userColumns+`
+		FROM u LEFT JOIN countries c ON c.code = u.primary_country
+	`, id)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
 
-	result, err := stmt.ExecContext(ctx, id)
+	return nil
+}
+
+// RestoreUser снимает отметку об удалении. Для неудаленного пользователя ничего не меняет
+func (s *Storage) RestoreUser(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixPostgres + "RestoreUser"
+
+	tx, err := s.begin(ctx, pgx.TxOptions{})
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback(ctx)
 
-	rowsAffected, err := result.RowsAffected()
+	before, err := lockUser(ctx, tx, id)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("%s: %w", op, sql.ErrNoRows)
+	if before.DeletedAt == nil {
+		return before, nil
 	}
 
-	return nil
-}
-func (s *Storage) GetUser(ctx context.Context, id int64) (models.EnrichedUser, error) {
-	const op = "storage.postgres.GetUser"
-
-	stmt, err := s.db.Prepare(`
-        SELECT id, name, surname, patronymic, age, sex, country 
-        FROM users 
-        WHERE id = $1
-    `)
+	restored, err := scanUser(tx.QueryRow(ctx, `
+		WITH u AS (
+			UPDATE users
+			SET deleted_at = NULL
+			WHERE id = $1
+			RETURNING *
+		)
+		SELECT `+userColumns+`
+		FROM u LEFT JOIN countries c ON c.code = u.primary_country
+	`, id))
 	if err != nil {
 		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
 
-	var user models.EnrichedUser
-	var countryData []byte
+	if err := recordChange(ctx, tx, id, models.AuditRestore, &before, &restored); err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
 
-	err = stmt.QueryRowContext(ctx, id).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Surname,
-		&user.Patronymic,
-		&user.Age,
-		&user.Sex,
-		&countryData,
-	)
+	if err := tx.Commit(ctx); err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return restored, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных раньше before.
+// Возвращает количество удаленных строк
+func (s *Storage) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	const op = storage.OpPrefixPostgres + "PurgeDeletedUsers"
+
+	// Открытые версии удаляемых пользователей закрываются, чтобы на более поздние
+	// моменты пользователь не находился. Время - clock_timestamp(), как в writeVersion
+	var purged int64
+	if err := s.db.QueryRow(ctx, `
+		WITH d AS (
+			DELETE FROM users WHERE deleted_at < $1
+			RETURNING id
+		), closed AS (
+			UPDATE users_history h SET valid_to = GREATEST(clock_timestamp(), h.valid_from)
+			FROM d
+			WHERE h.id = d.id AND h.valid_to IS NULL
+		)
+		SELECT count(*) FROM d
+	`, before).Scan(&purged); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return purged, nil
+}
+
+func (s *Storage) GetUser(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixPostgres + "GetUser"
+
+	user, err := scanUser(s.db.QueryRow(ctx, `
+        SELECT `+userColumns+`
+        FROM `+userSource+`
+        WHERE u.id = $1 AND u.deleted_at IS NULL
+    `, id))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
 		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if len(countryData) > 0 {
-		if err := json.Unmarshal(countryData, &user.Country); err != nil {
-			return models.EnrichedUser{}, fmt.Errorf("%s: failed to unmarshal country data: %w", op, err)
+	return user, nil
+}
+
+// GetUserForUpdate читает пользователя и блокирует строку до конца транзакции.
+// Имеет смысл внутри WithTx
+func (s *Storage) GetUserForUpdate(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixPostgres + "GetUserForUpdate"
+
+	user, err := scanUser(s.db.QueryRow(ctx, `
+		SELECT `+userColumns+`
+		FROM `+userSource+`
+		WHERE u.id = $1 AND u.deleted_at IS NULL
+		FOR UPDATE OF u
+	`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return user, nil
 }
 
-func (s *Storage) GetUsers(ctx context.Context, filter models.UserFilter) ([]models.EnrichedUser, error) {
-	const op = "storage.postgres.GetUsers"
-
-	baseQuery := `SELECT id, name, surname, patronymic, age, sex, country FROM users WHERE 1=1`
-	args := []interface{}{}
-	argPos := 1
+// GetUserAsOf возвращает версию пользователя, действовавшую в момент asOf
+func (s *Storage) GetUserAsOf(ctx context.Context, id int64, asOf time.Time) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixPostgres + "GetUserAsOf"
 
-	if filter.Name != "" {
-		baseQuery += fmt.Sprintf(" AND name ILIKE $%d", argPos)
-		args = append(args, "%"+filter.Name+"%")
-		argPos++
-	}
-
-	if filter.Surname != "" {
-		baseQuery += fmt.Sprintf(" AND surname ILIKE $%d", argPos)
-		args = append(args, "%"+filter.Surname+"%")
-		argPos++
+	user, err := scanUser(s.db.QueryRow(ctx, `
+		SELECT `+userColumns+`
+		FROM `+historySource+`
+		WHERE u.id = $1 AND u.deleted_at IS NULL
+			AND u.valid_from <= $2 AND (u.valid_to IS NULL OR u.valid_to > $2)
+	`, id, asOf))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if filter.Patronymic != "" {
-		baseQuery += fmt.Sprintf(" AND patronymic ILIKE $%d", argPos)
-		args = append(args, "%"+filter.Patronymic+"%")
-		argPos++
-	}
+	return user, nil
+}
 
-	if filter.AgeFrom > 0 {
-		baseQuery += fmt.Sprintf(" AND age >= $%d", argPos)
-		args = append(args, filter.AgeFrom)
-		argPos++
-	}
+func (s *Storage) GetUsers(ctx context.Context, filter models.UserFilter) ([]models.EnrichedUser, error) {
+	const op = storage.OpPrefixPostgres + "GetUsers"
 
-	if filter.AgeTo > 0 {
-		baseQuery += fmt.Sprintf(" AND age <= $%d", argPos)
-		args = append(args, filter.AgeTo)
-		argPos++
+	conditions, args, err := userConditions(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	argPos := len(args) + 1
 
-	if filter.Sex != "" {
-		baseQuery += fmt.Sprintf(" AND sex = $%d", argPos)
-		args = append(args, filter.Sex)
-		argPos++
-	}
+	baseQuery := `SELECT ` + userColumns + ` FROM ` + userSourceFor(filter) + ` WHERE 1=1` + conditions
 
-	if filter.Country != "" {
-		baseQuery += fmt.Sprintf(" AND country::text ILIKE $%d", argPos)
-		args = append(args, "%"+filter.Country+"%")
-		argPos++
+	orderBy := " ORDER BY u.id ASC"
+	if prefixTSQuery(filter.Search) != "" {
+		// userConditions передает tsquery первым аргументом
+		orderBy = " ORDER BY ts_rank(u.search_vector, to_tsquery('simple', $1)) DESC, u.id ASC"
 	}
 
-	baseQuery += " ORDER BY id ASC"
+	baseQuery += orderBy
 
 	if filter.Limit > 0 {
 		baseQuery += fmt.Sprintf(" LIMIT $%d", argPos)
@@ -221,7 +497,7 @@ func (s *Storage) GetUsers(ctx context.Context, filter models.UserFilter) ([]mod
 		args = append(args, filter.Offset)
 	}
 
-	rows, err := s.db.QueryContext(ctx, baseQuery, args...)
+	rows, err := s.db.Query(ctx, baseQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -230,45 +506,169 @@ func (s *Storage) GetUsers(ctx context.Context, filter models.UserFilter) ([]mod
 	var users []models.EnrichedUser
 
 	for rows.Next() {
-		var user models.EnrichedUser
-		var countryData []byte
-
-		err := rows.Scan(
-			&user.ID,
-			&user.Name,
-			&user.Surname,
-			&user.Patronymic,
-			&user.Age,
-			&user.Sex,
-			&countryData,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 
-		if len(countryData) > 0 {
-			if err := json.Unmarshal(countryData, &user.Country); err != nil {
-				return nil, fmt.Errorf("%s: failed to unmarshal country data: %w", op, err)
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+// StreamUsers проходит по всем пользователям, подходящим под фильтр (без пагинации), через
+// серверный курсор и вызывает fn для каждого. В памяти одновременно держится не больше
+// exportBatchSize строк. Ошибка fn прерывает выборку и возвращается как есть
+func (s *Storage) StreamUsers(ctx context.Context, filter models.UserFilter, fn func(models.EnrichedUser) error) error {
+	const op = storage.OpPrefixPostgres + "StreamUsers"
+
+	conditions, args, err := userConditions(filter)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Курсор живет только внутри транзакции
+	tx, err := s.begin(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DECLARE users_export NO SCROLL CURSOR FOR
+		SELECT `+userColumns+`
+		FROM `+userSourceFor(filter)+`
+		WHERE 1=1`+conditions+`
+		ORDER BY u.id ASC
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf(`FETCH FORWARD %d FROM users_export`, exportBatchSize))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		fetched := 0
+		for rows.Next() {
+			fetched++
+
+			user, err := scanUser(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			if err := fn(user); err != nil {
+				rows.Close()
+				return err
 			}
 		}
+		rows.Close()
 
-		users = append(users, user)
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if fetched < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *Storage) SuggestUsers(ctx context.Context, query string, limit int) ([]models.UserSuggestion, error) {
+	const op = storage.OpPrefixPostgres + "SuggestUsers"
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, full_name
+		FROM users
+		WHERE (search_vector @@ to_tsquery('simple', $1) OR full_name % $2)
+			AND deleted_at IS NULL
+		ORDER BY ts_rank(search_vector, to_tsquery('simple', $1)) DESC,
+			similarity(full_name, $2) DESC,
+			id ASC
+		LIMIT $3
+	`, prefixTSQuery(query), query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	suggestions := []models.UserSuggestion{}
+
+	for rows.Next() {
+		var suggestion models.UserSuggestion
+		if err := rows.Scan(&suggestion.ID, &suggestion.FullName); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		suggestions = append(suggestions, suggestion)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return users, nil
+	return suggestions, nil
 }
 
-func GetDatabaseURL() string {
-	if err := godotenv.Load(); err == nil {
-		dbURL := os.Getenv("DB_URL")
-		if dbURL != "" {
-			return dbURL
+// scanUser читает строку, выбранную по userColumns
+func scanUser(row rowScanner) (models.EnrichedUser, error) {
+	var user models.EnrichedUser
+	var countryData []byte
+	var primaryCountry, primaryCountryName *string
+	var primaryProbability *float64
+
+	err := row.Scan(
+		&user.ID,
+		&user.Name,
+		&user.Surname,
+		&user.Patronymic,
+		&user.Age,
+		&user.Sex,
+		&countryData,
+		&primaryCountry,
+		&primaryProbability,
+		&primaryCountryName,
+		&user.EnrichedAt,
+		&user.DeletedAt,
+	)
+	if err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	if len(countryData) > 0 {
+		if err := json.Unmarshal(countryData, &user.Country); err != nil {
+			return models.EnrichedUser{}, fmt.Errorf("failed to unmarshal country data: %w", err)
 		}
 	}
 
-	panic("DB_URL not found")
+	if primaryCountry != nil {
+		user.PrimaryCountry = &models.Country{CountryID: *primaryCountry}
+		if primaryCountryName != nil {
+			user.PrimaryCountry.Name = *primaryCountryName
+		}
+		if primaryProbability != nil {
+			user.PrimaryCountry.Probability = *primaryProbability
+		}
+	}
+
+	return user, nil
+}
+
+// primaryCountryArgs возвращает код и вероятность наиболее вероятной страны для записи в БД
+func primaryCountryArgs(countries []models.Country) (any, any) {
+	top := models.TopCountry(countries)
+	if top == nil {
+		return nil, nil
+	}
+
+	return top.CountryID, top.Probability
 }
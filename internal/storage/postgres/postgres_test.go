@@ -0,0 +1,53 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/sol1corejz/enricher/internal/migrator"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"github.com/sol1corejz/enricher/internal/storage/postgres"
+	"github.com/sol1corejz/enricher/internal/storage/storagetest"
+	"os"
+	"testing"
+)
+
+// testDBURLEnv - переменная с адресом отдельной тестовой базы. Каждая проверка откатывает
+// и заново применяет в ней все миграции, поэтому рабочую базу сюда указывать нельзя
+const testDBURLEnv = "TEST_DB_URL"
+
+func TestStorage(t *testing.T) {
+	dbURL := os.Getenv(testDBURLEnv)
+	if dbURL == "" {
+		t.Skip(testDBURLEnv + " is not set")
+	}
+
+	storagetest.Run(t, func(t *testing.T) storage.Provider {
+		resetDatabase(t, dbURL)
+
+		s, err := postgres.New(context.Background(), postgres.Config{URL: dbURL})
+		if err != nil {
+			t.Fatalf("postgres.New: %v", err)
+		}
+		t.Cleanup(s.Close)
+
+		return s
+	})
+}
+
+// resetDatabase приводит базу к состоянию сразу после миграций: без пользователей,
+// но со справочником стран
+func resetDatabase(t *testing.T, dbURL string) {
+	t.Helper()
+
+	m, err := migrator.New(dbURL)
+	if err != nil {
+		t.Fatalf("migrator.New: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Down(); err != nil {
+		t.Fatalf("migrator.Down: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("migrator.Up: %v", err)
+	}
+}
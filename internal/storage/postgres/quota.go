@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"time"
+)
+
+// ConsumeEnrichmentQuota списывает n обогащений клиента client за сутки day, если после этого
+// расход не превысит limit, и возвращает новый расход. Иначе ничего не меняет и возвращает
+// текущий расход и storage.ErrQuotaExceeded. Проверка и списание - один запрос, поэтому
+// параллельные запросы клиента не превышают квоту
+func (s *Storage) ConsumeEnrichmentQuota(ctx context.Context, client string, day time.Time, n, limit int) (int, error) {
+	const op = storage.OpPrefixPostgres + "ConsumeEnrichmentQuota"
+
+	var used int
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO enrichment_usage (client, day, used)
+		SELECT $1, $2::date, $3::integer
+		WHERE $3::integer <= $4::integer
+		ON CONFLICT (client, day) DO UPDATE
+		SET used = enrichment_usage.used + EXCLUDED.used
+		WHERE enrichment_usage.used + EXCLUDED.used <= $4::integer
+		RETURNING used
+	`, client, day, n, limit).Scan(&used)
+	if err == nil {
+		return used, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.db.QueryRow(ctx, `
+		SELECT coalesce(max(used), 0)
+		FROM enrichment_usage
+		WHERE client = $1 AND day = $2::date
+	`, client, day).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return used, fmt.Errorf("%s: %w", op, storage.ErrQuotaExceeded)
+}
+
+// RefundEnrichmentQuota возвращает клиенту client n обогащений, списанных за сутки day
+// (например, если обогащение не удалось). Расход не становится меньше нуля
+func (s *Storage) RefundEnrichmentQuota(ctx context.Context, client string, day time.Time, n int) error {
+	const op = storage.OpPrefixPostgres + "RefundEnrichmentQuota"
+
+	_, err := s.db.Exec(ctx, `
+		UPDATE enrichment_usage
+		SET used = GREATEST(used - $3::integer, 0)
+		WHERE client = $1 AND day = $2::date
+	`, client, day, n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
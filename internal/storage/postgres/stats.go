@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+)
+
+func (s *Storage) GetUserStats(ctx context.Context, filter models.UserFilter, opts models.StatsOptions) (models.UserStats, error) {
+	const op = storage.OpPrefixPostgres + "GetUserStats"
+
+	conditions, args, err := userConditions(filter)
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	argPos := len(args) + 1
+
+	// Все агрегаты считаются по одному снимку данных
+	tx, err := s.begin(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	stats := models.UserStats{
+		BySex:        map[string]int64{},
+		AgeHistogram: models.NewAgeHistogram(opts.AgeBuckets),
+		TopCountries: []models.CountryStats{},
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT u.sex, count(*)
+		FROM `+userSourceFor(filter)+`
+		WHERE 1=1`+conditions+`
+		GROUP BY u.sex
+	`, args...)
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for rows.Next() {
+		var sex string
+		var count int64
+		if err := rows.Scan(&sex, &count); err != nil {
+			rows.Close()
+			return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+		}
+		stats.BySex[sex] = count
+		stats.Total += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// width_bucket возвращает 0 для возраста меньше первой границы
+	// и len(границ) для возраста не меньше последней
+	rows, err = tx.Query(ctx, fmt.Sprintf(`
+		SELECT width_bucket(u.age, $%d::int[]), count(*)
+		FROM `+userSourceFor(filter)+`
+		WHERE 1=1`+conditions+`
+		GROUP BY 1
+	`, argPos), append(args, opts.AgeBuckets)...)
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for rows.Next() {
+		var bucket int
+		var count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			rows.Close()
+			return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if bucket >= 0 && bucket < len(stats.AgeHistogram) {
+			stats.AgeHistogram[bucket].Count = count
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err = tx.Query(ctx, fmt.Sprintf(`
+		SELECT u.primary_country, coalesce(c.name, ''), count(*), avg(u.age)::float8
+		FROM `+userSourceFor(filter)+`
+		WHERE u.primary_country IS NOT NULL`+conditions+`
+		GROUP BY u.primary_country, c.name
+		ORDER BY count(*) DESC, u.primary_country ASC
+		LIMIT $%d
+	`, argPos), append(args, opts.TopCountries)...)
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for rows.Next() {
+		var country models.CountryStats
+		if err := rows.Scan(&country.CountryID, &country.Name, &country.Count, &country.AverageAge); err != nil {
+			rows.Close()
+			return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+		}
+		stats.TopCountries = append(stats.TopCountries, country)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
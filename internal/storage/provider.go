@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"time"
+)
+
+// Provider - хранилище пользователей и задач импорта. Реализации - пакеты postgres, sqlite
+// и memory; сервис обогащения работает с ним через enricher.Provider
+type Provider interface {
+	SaveUser(ctx context.Context, userData models.EnrichedUser) (int64, error)
+	EditUser(ctx context.Context, userData models.EnrichedUser) (models.EnrichedUser, error)
+	ReEnrichUser(ctx context.Context, userData models.EnrichedUser) (models.EnrichedUser, error)
+	DeleteUser(ctx context.Context, id int64) error
+	RestoreUser(ctx context.Context, id int64) (models.EnrichedUser, error)
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
+	GetUserHistory(ctx context.Context, id int64) ([]models.UserAuditEntry, error)
+	GetUsers(ctx context.Context, filter models.UserFilter) ([]models.EnrichedUser, error)
+	GetUser(ctx context.Context, id int64) (models.EnrichedUser, error)
+	GetUserForUpdate(ctx context.Context, id int64) (models.EnrichedUser, error)
+	GetUserAsOf(ctx context.Context, id int64, asOf time.Time) (models.EnrichedUser, error)
+	SuggestUsers(ctx context.Context, query string, limit int) ([]models.UserSuggestion, error)
+	GetUserStats(ctx context.Context, filter models.UserFilter, opts models.StatsOptions) (models.UserStats, error)
+	StreamUsers(ctx context.Context, filter models.UserFilter, fn func(models.EnrichedUser) error) error
+
+	CreateImport(ctx context.Context, imp models.Import) (int64, error)
+	UpdateImport(ctx context.Context, imp models.Import) error
+	FailStaleImports(ctx context.Context, before time.Time, reason string) (int64, error)
+	AddImportErrors(ctx context.Context, importID int64, rowErrors []models.ImportRowError) error
+	GetImport(ctx context.Context, id int64) (models.Import, error)
+
+	// WithTx выполняет fn в одной транзакции: все вызовы переданного Provider
+	// либо применяются вместе, либо откатываются
+	WithTx(ctx context.Context, fn TxFunc) error
+}
+
+// TxFunc - тело транзакции WithTx. tx работает внутри транзакции; ошибка откатывает ее
+type TxFunc func(tx Provider) error
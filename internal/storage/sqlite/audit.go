@@ -0,0 +1,248 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"time"
+)
+
+// auditedUpdate выполняет UPDATE query над пользователем id и в той же транзакции
+// записывает событие action в user_audit и новую версию в users_history. В query можно
+// сослаться на время изменения как на $now. Если query не изменил ни одной строки,
+// пользователь считается не найденным
+func (s *Storage) auditedUpdate(
+	ctx context.Context,
+	id int64,
+	action models.AuditAction,
+	query string,
+	args ...any,
+) (models.EnrichedUser, error) {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return models.EnrichedUser{}, err
+	}
+	defer t.Rollback(ctx)
+
+	before, err := lockUser(ctx, t, id)
+	if err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	now := formatTime(time.Now())
+
+	result, err := t.ExecContext(ctx, query, append(args, sql.Named("now", now))...)
+	if err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return models.EnrichedUser{}, err
+	}
+	if updated == 0 {
+		return models.EnrichedUser{}, storage.ErrUserNotFound
+	}
+
+	after, err := lockUser(ctx, t, id)
+	if err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	if err := recordChange(ctx, t, id, action, &before, &after, now); err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	if err := t.Commit(ctx); err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	return after, nil
+}
+
+// lockUser читает пользователя (в том числе мягко удаленного) внутри транзакции.
+// Отдельная блокировка строки не нужна: транзакция и так держит базу на запись
+func lockUser(ctx context.Context, t *tx, id int64) (models.EnrichedUser, error) {
+	user, err := scanUser(t.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM `+userSource+`
+		WHERE u.id = $1
+	`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.EnrichedUser{}, storage.ErrUserNotFound
+		}
+		return models.EnrichedUser{}, err
+	}
+
+	return user, nil
+}
+
+// recordChange фиксирует изменение пользователя: событие в журнале аудита и новую версию.
+// now - время изменения в формате timeLayout
+func recordChange(
+	ctx context.Context,
+	t *tx,
+	userID int64,
+	action models.AuditAction,
+	before, after *models.EnrichedUser,
+	now string,
+) error {
+	if err := writeAudit(ctx, t, userID, action, before, after, now); err != nil {
+		return err
+	}
+
+	return writeVersion(ctx, t, userID, now)
+}
+
+// writeVersion закрывает текущую версию пользователя в users_history и открывает новую
+// по текущему состоянию строки users. Обе границы равны now, поэтому интервалы версий
+// идут без разрывов
+func writeVersion(ctx context.Context, t *tx, userID int64, now string) error {
+	_, err := t.ExecContext(ctx, `
+		UPDATE users_history SET valid_to = $1
+		WHERE id = $2 AND valid_to IS NULL
+	`, now, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.ExecContext(ctx, `
+		INSERT INTO users_history (id, name, surname, patronymic, age, sex, country,
+			primary_country, primary_country_probability, enriched_at, deleted_at, valid_from)
+		SELECT id, name, surname, patronymic, age, sex, country,
+			primary_country, primary_country_probability, enriched_at, deleted_at, $1
+		FROM users
+		WHERE id = $2
+	`, now, userID)
+
+	return err
+}
+
+// writeAudit добавляет запись в user_audit. Инициатор и идентификатор запроса берутся из ctx
+func writeAudit(
+	ctx context.Context,
+	t *tx,
+	userID int64,
+	action models.AuditAction,
+	before, after *models.EnrichedUser,
+	now string,
+) error {
+	beforeData, err := auditSnapshot(before)
+	if err != nil {
+		return err
+	}
+
+	afterData, err := auditSnapshot(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.ExecContext(ctx, `
+		INSERT INTO user_audit (user_id, action, before, after, actor, request_id, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+	`, userID, string(action), beforeData, afterData, reqctx.Actor(ctx), reqctx.RequestID(ctx), now)
+
+	return err
+}
+
+func auditSnapshot(user *models.EnrichedUser) (any, error) {
+	if user == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit snapshot: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// GetUserHistory возвращает журнал изменений пользователя от старых записей к новым.
+// История доступна и для мягко удаленных пользователей
+func (s *Storage) GetUserHistory(ctx context.Context, id int64) ([]models.UserAuditEntry, error) {
+	const op = storage.OpPrefixSQLite + "GetUserHistory"
+
+	rows, err := s.q().QueryContext(ctx, `
+		SELECT id, user_id, action, before, after, COALESCE(actor, ''), COALESCE(request_id, ''), created_at
+		FROM user_audit
+		WHERE user_id = $1
+		ORDER BY id ASC
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	history := []models.UserAuditEntry{}
+
+	for rows.Next() {
+		var entry models.UserAuditEntry
+		var beforeData, afterData []byte
+		var createdAt string
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.Action,
+			&beforeData,
+			&afterData,
+			&entry.Actor,
+			&entry.RequestID,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if entry.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if entry.Before, err = parseSnapshot(beforeData); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if entry.After, err = parseSnapshot(afterData); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		history = append(history, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(history) > 0 {
+		return history, nil
+	}
+
+	var exists bool
+	err = s.q().QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return history, nil
+}
+
+func parseSnapshot(data []byte) (*models.EnrichedUser, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var user models.EnrichedUser
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal audit snapshot: %w", err)
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/filterexpr"
+	"github.com/sol1corejz/enricher/internal/lib/textsearch"
+	"strings"
+)
+
+// filterColumns сопоставляет полям models.UserFilterFields колонки запроса
+var filterColumns = map[string]string{
+	"id":         "u.id",
+	"name":       "u.name",
+	"surname":    "u.surname",
+	"patronymic": "u.patronymic",
+	"age":        "u.age",
+	"sex":        "u.sex",
+	"country":    "u.primary_country",
+}
+
+// dialect - отличия SQLite для filterexpr: LIKE без учета регистра только для ASCII
+// и без экранирующего символа по умолчанию
+var dialect = filterexpr.Dialect{
+	Contains: func(column, pattern string) string {
+		return fmt.Sprintf(`(casefold(%s) LIKE casefold(%s) ESCAPE '\')`, column, pattern)
+	},
+}
+
+// userConditions собирает условия WHERE по фильтру так же, как postgres.userConditions.
+// Если задан поиск, строка поиска всегда передается первым аргументом
+func userConditions(filter models.UserFilter) (string, []any, error) {
+	var conditions strings.Builder
+	args := []any{}
+	argPos := 1
+
+	if !filter.IncludeDeleted {
+		conditions.WriteString(" AND u.deleted_at IS NULL")
+	}
+
+	if hasSearch(filter.Search) {
+		conditions.WriteString(fmt.Sprintf(" AND search_rank(%s, $%d) > 0", searchText, argPos))
+		args = append(args, filter.Search)
+		argPos++
+	}
+
+	if filter.Name != "" {
+		conditions.WriteString(fmt.Sprintf(" AND casefold(u.name) LIKE casefold($%d)", argPos))
+		args = append(args, "%"+filter.Name+"%")
+		argPos++
+	}
+
+	if filter.Surname != "" {
+		conditions.WriteString(fmt.Sprintf(" AND casefold(u.surname) LIKE casefold($%d)", argPos))
+		args = append(args, "%"+filter.Surname+"%")
+		argPos++
+	}
+
+	if filter.Patronymic != "" {
+		conditions.WriteString(fmt.Sprintf(" AND casefold(u.patronymic) LIKE casefold($%d)", argPos))
+		args = append(args, "%"+filter.Patronymic+"%")
+		argPos++
+	}
+
+	if filter.AgeFrom > 0 {
+		conditions.WriteString(fmt.Sprintf(" AND u.age >= $%d", argPos))
+		args = append(args, filter.AgeFrom)
+		argPos++
+	}
+
+	if filter.AgeTo > 0 {
+		conditions.WriteString(fmt.Sprintf(" AND u.age <= $%d", argPos))
+		args = append(args, filter.AgeTo)
+		argPos++
+	}
+
+	if !filter.AsOf.IsZero() {
+		conditions.WriteString(fmt.Sprintf(" AND u.valid_from <= $%d AND (u.valid_to IS NULL OR u.valid_to > $%d)", argPos, argPos))
+		args = append(args, formatTime(filter.AsOf))
+		argPos++
+	}
+
+	if !filter.EnrichedBefore.IsZero() {
+		conditions.WriteString(fmt.Sprintf(" AND u.enriched_at < $%d", argPos))
+		args = append(args, formatTime(filter.EnrichedBefore))
+		argPos++
+	}
+
+	if filter.Sex != "" {
+		conditions.WriteString(fmt.Sprintf(" AND u.sex = $%d", argPos))
+		args = append(args, filter.Sex)
+		argPos++
+	}
+
+	// Страна ищется по кодам всех стран из списка
+	if filter.Country != "" {
+		conditions.WriteString(fmt.Sprintf(
+			" AND EXISTS (SELECT 1 FROM json_each(u.country) WHERE casefold(value ->> 'country_id') LIKE casefold($%d))",
+			argPos,
+		))
+		args = append(args, "%"+filter.Country+"%")
+		argPos++
+	}
+
+	if filter.Expression != nil {
+		condition, exprArgs, err := filterexpr.ToDialectSQL(filter.Expression, filterColumns, argPos, dialect)
+		if err != nil {
+			return "", nil, err
+		}
+
+		conditions.WriteString(" AND " + condition)
+		args = append(args, exprArgs...)
+	}
+
+	return conditions.String(), args, nil
+}
+
+// userSourceFor выбирает источник строк: текущие данные или, если задан AsOf, версии из users_history
+func userSourceFor(filter models.UserFilter) string {
+	if !filter.AsOf.IsZero() {
+		return historySource
+	}
+
+	return userSource
+}
+
+// hasSearch - есть ли в строке поиска слова (как непустой tsquery в Postgres)
+func hasSearch(search string) bool {
+	return len(textsearch.Words(search)) > 0
+}
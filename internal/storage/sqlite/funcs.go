@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/lib/textsearch"
+	"strings"
+	"time"
+
+	sqlitedriver "modernc.org/sqlite"
+)
+
+// similarityThreshold - порог оператора % из pg_trgm (pg_trgm.similarity_threshold по умолчанию)
+const similarityThreshold = 0.3
+
+// timeLayout - формат хранения времени: UTC с фиксированным числом знаков, чтобы строки
+// сравнивались в том же порядке, что и моменты времени
+const timeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// searchText - текст, по которому идет поиск, как в search_vector у Postgres
+const searchText = `u.name || ' ' || u.surname || ' ' || coalesce(u.patronymic, '')`
+
+// Функции, которых нет во встроенной SQLite: регистр букв вне ASCII (casefold), поиск
+// по префиксам слов (search_rank) и похожесть по триграммам (similarity)
+func init() {
+	functions := []struct {
+		name  string
+		nArgs int32
+		fn    func(args []string) driver.Value
+	}{
+		{"casefold", 1, func(args []string) driver.Value {
+			return strings.ToLower(args[0])
+		}},
+		{"search_rank", 2, func(args []string) driver.Value {
+			return int64(textsearch.PrefixRank(args[0], textsearch.Words(args[1])))
+		}},
+		{"similarity", 2, func(args []string) driver.Value {
+			return textsearch.Similarity(args[0], args[1])
+		}},
+	}
+
+	for _, f := range functions {
+		err := sqlitedriver.RegisterDeterministicScalarFunction(f.name, f.nArgs,
+			func(_ *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+				texts := make([]string, len(args))
+				for i, arg := range args {
+					switch v := arg.(type) {
+					case nil:
+						return nil, nil
+					case string:
+						texts[i] = v
+					case []byte:
+						texts[i] = string(v)
+					default:
+						texts[i] = fmt.Sprint(v)
+					}
+				}
+
+				return f.fn(texts), nil
+			})
+		if err != nil {
+			panic(fmt.Sprintf("storage.sqlite: register function %s: %v", f.name, err))
+		}
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(timeLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse time %q: %w", s, err)
+	}
+
+	return t, nil
+}
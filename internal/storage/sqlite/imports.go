@@ -0,0 +1,189 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"strings"
+	"time"
+)
+
+// importErrorsBatchSize - строк ошибок в одном INSERT (лимит параметров SQLite - 32766)
+const importErrorsBatchSize = 1000
+
+func (s *Storage) CreateImport(ctx context.Context, imp models.Import) (int64, error) {
+	const op = storage.OpPrefixSQLite + "CreateImport"
+
+	now := formatTime(time.Now())
+
+	result, err := s.q().ExecContext(ctx, `
+		INSERT INTO imports (status, format, total, processed, succeeded, failed, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+	`, string(imp.Status), imp.Format, imp.Total, imp.Processed, imp.Succeeded, imp.Failed, now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// UpdateImport сохраняет статус и счетчики прогресса задачи. finished_at проставляется
+// при переходе в конечный статус
+func (s *Storage) UpdateImport(ctx context.Context, imp models.Import) error {
+	const op = storage.OpPrefixSQLite + "UpdateImport"
+
+	result, err := s.q().ExecContext(ctx, `
+		UPDATE imports
+		SET status = $1, processed = $2, succeeded = $3, failed = $4, error = NULLIF($5, ''),
+			updated_at = $6,
+			finished_at = CASE WHEN $1 IN ('completed', 'failed') THEN $6 END
+		WHERE id = $7
+	`, string(imp.Status), imp.Processed, imp.Succeeded, imp.Failed, imp.Error, formatTime(time.Now()), imp.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrImportNotFound)
+	}
+
+	return nil
+}
+
+// FailStaleImports переводит в failed с ошибкой reason незавершенные задачи, прогресс
+// которых не обновлялся с before, и возвращает их количество
+func (s *Storage) FailStaleImports(ctx context.Context, before time.Time, reason string) (int64, error) {
+	const op = storage.OpPrefixSQLite + "FailStaleImports"
+
+	result, err := s.q().ExecContext(ctx, `
+		UPDATE imports
+		SET status = 'failed', error = $1, updated_at = $2, finished_at = $2
+		WHERE status IN ('pending', 'running') AND updated_at < $3
+	`, reason, formatTime(time.Now()), formatTime(before))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	failed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return failed, nil
+}
+
+func (s *Storage) AddImportErrors(ctx context.Context, importID int64, rowErrors []models.ImportRowError) error {
+	const op = storage.OpPrefixSQLite + "AddImportErrors"
+
+	for len(rowErrors) > 0 {
+		batch := rowErrors[:min(len(rowErrors), importErrorsBatchSize)]
+		rowErrors = rowErrors[len(batch):]
+
+		values := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*2+1)
+		args = append(args, importID)
+
+		for i, rowError := range batch {
+			values = append(values, fmt.Sprintf("($1, $%d, $%d)", i*2+2, i*2+3))
+			args = append(args, rowError.Row, rowError.Error)
+		}
+
+		_, err := s.q().ExecContext(ctx, `
+			INSERT INTO import_errors (import_id, row_number, error)
+			VALUES `+strings.Join(values, ", ")+`
+			ON CONFLICT (import_id, row_number) DO NOTHING
+		`, args...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) GetImport(ctx context.Context, id int64) (models.Import, error) {
+	const op = storage.OpPrefixSQLite + "GetImport"
+
+	var imp models.Import
+	var createdAt, updatedAt string
+	var finishedAt *string
+
+	err := s.q().QueryRowContext(ctx, `
+		SELECT id, status, format, total, processed, succeeded, failed, coalesce(error, ''),
+			created_at, updated_at, finished_at
+		FROM imports
+		WHERE id = $1
+	`, id).Scan(
+		&imp.ID,
+		&imp.Status,
+		&imp.Format,
+		&imp.Total,
+		&imp.Processed,
+		&imp.Succeeded,
+		&imp.Failed,
+		&imp.Error,
+		&createdAt,
+		&updatedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Import{}, fmt.Errorf("%s: %w", op, storage.ErrImportNotFound)
+		}
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if imp.CreatedAt, err = parseTime(createdAt); err != nil {
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if imp.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if finishedAt != nil {
+		t, err := parseTime(*finishedAt)
+		if err != nil {
+			return models.Import{}, fmt.Errorf("%s: %w", op, err)
+		}
+		imp.FinishedAt = &t
+	}
+
+	rows, err := s.q().QueryContext(ctx, `
+		SELECT row_number, error
+		FROM import_errors
+		WHERE import_id = $1
+		ORDER BY row_number ASC
+	`, id)
+	if err != nil {
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	imp.Errors = []models.ImportRowError{}
+
+	for rows.Next() {
+		var rowError models.ImportRowError
+		if err := rows.Scan(&rowError.Row, &rowError.Error); err != nil {
+			return models.Import{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		imp.Errors = append(imp.Errors, rowError)
+	}
+
+	if err = rows.Err(); err != nil {
+		return models.Import{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return imp, nil
+}
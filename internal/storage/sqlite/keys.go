@@ -0,0 +1,163 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"time"
+
+	sqlitedriver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const apiKeyColumns = `id, name, prefix, role, key_hash, created_at, last_used_at, revoked_at`
+
+// CreateAPIKey сохраняет ключ API. Имя должно быть уникально среди действующих ключей
+func (s *Storage) CreateAPIKey(ctx context.Context, key models.APIKey) (int64, error) {
+	const op = storage.OpPrefixSQLite + "CreateAPIKey"
+
+	result, err := s.q().ExecContext(ctx, `
+		INSERT INTO api_keys (name, prefix, role, key_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, key.Name, key.Prefix, string(key.Role), key.KeyHash, formatTime(time.Now()))
+	if err != nil {
+		var sqliteErr *sqlitedriver.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// GetAPIKeyByHash возвращает действующий ключ по хэшу
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	const op = storage.OpPrefixSQLite + "GetAPIKeyByHash"
+
+	key, err := scanAPIKey(s.q().QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL
+	`, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.APIKey{}, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+		}
+		return models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys возвращает все ключи, включая отозванные, в порядке создания
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	const op = storage.OpPrefixSQLite + "ListAPIKeys"
+
+	rows, err := s.q().QueryContext(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает действующий ключ
+func (s *Storage) RevokeAPIKey(ctx context.Context, id int64) error {
+	const op = storage.OpPrefixSQLite + "RevokeAPIKey"
+
+	result, err := s.q().ExecContext(ctx, `
+		UPDATE api_keys
+		SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`, id, formatTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+	}
+
+	return nil
+}
+
+// TouchAPIKey отмечает время последнего использования ключа
+func (s *Storage) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	const op = storage.OpPrefixSQLite + "TouchAPIKey"
+
+	_, err := s.q().ExecContext(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, formatTime(at))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var createdAt string
+	var lastUsedAt, revokedAt *string
+
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Role, &key.KeyHash, &createdAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	if key.CreatedAt, err = parseTime(createdAt); err != nil {
+		return models.APIKey{}, err
+	}
+	if key.LastUsedAt, err = parseOptionalTime(lastUsedAt); err != nil {
+		return models.APIKey{}, err
+	}
+	if key.RevokedAt, err = parseOptionalTime(revokedAt); err != nil {
+		return models.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+func parseOptionalTime(s *string) (*time.Time, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	t, err := parseTime(*s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"time"
+)
+
+// dayLayout - формат суток в enrichment_usage.day
+const dayLayout = "2006-01-02"
+
+// ConsumeEnrichmentQuota списывает n обогащений клиента client за сутки day, если после этого
+// расход не превысит limit, и возвращает новый расход. Иначе ничего не меняет и возвращает
+// текущий расход и storage.ErrQuotaExceeded
+func (s *Storage) ConsumeEnrichmentQuota(ctx context.Context, client string, day time.Time, n, limit int) (int, error) {
+	const op = storage.OpPrefixSQLite + "ConsumeEnrichmentQuota"
+
+	date := day.UTC().Format(dayLayout)
+
+	var used int
+	err := s.q().QueryRowContext(ctx, `
+		INSERT INTO enrichment_usage (client, day, used)
+		SELECT $1, $2, $3
+		WHERE $3 <= $4
+		ON CONFLICT (client, day) DO UPDATE
+		SET used = enrichment_usage.used + excluded.used
+		WHERE enrichment_usage.used + excluded.used <= $4
+		RETURNING used
+	`, client, date, n, limit).Scan(&used)
+	if err == nil {
+		return used, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.q().QueryRowContext(ctx, `
+		SELECT coalesce(max(used), 0)
+		FROM enrichment_usage
+		WHERE client = $1 AND day = $2
+	`, client, date).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return used, fmt.Errorf("%s: %w", op, storage.ErrQuotaExceeded)
+}
+
+// RefundEnrichmentQuota возвращает клиенту client n обогащений, списанных за сутки day
+// (например, если обогащение не удалось). Расход не становится меньше нуля
+func (s *Storage) RefundEnrichmentQuota(ctx context.Context, client string, day time.Time, n int) error {
+	const op = storage.OpPrefixSQLite + "RefundEnrichmentQuota"
+
+	_, err := s.q().ExecContext(ctx, `
+		UPDATE enrichment_usage
+		SET used = max(used - $3, 0)
+		WHERE client = $1 AND day = $2
+	`, client, day.UTC().Format(dayLayout), n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
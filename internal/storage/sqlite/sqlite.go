@@ -0,0 +1,639 @@
+// Package sqlite - реализация storage.Provider поверх встроенной SQLite (modernc.org/sqlite,
+// без cgo) для однонодовых инсталляций без Postgres. Схема создается отдельным набором
+// миграций migrations.SQLite. Полнотекстовый поиск и похожесть имен считаются функциями
+// из internal/lib/textsearch, зарегистрированными в SQLite
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"net/url"
+	"time"
+)
+
+type Storage struct {
+	db *sql.DB
+
+	// tx - текущая транзакция или точка сохранения внутри WithTx, nil - вне транзакции
+	tx *tx
+}
+
+// Config - параметры подключения к файлу базы
+type Config struct {
+	// Путь к файлу базы, создается при первом подключении
+	Path string
+
+	// Сколько ждать освобождения базы другой записывающей транзакцией
+	BusyTimeout time.Duration
+}
+
+const defaultBusyTimeout = 5 * time.Second
+
+// userColumns - список колонок пользователя вместе с названием основной страны из справочника
+const userColumns = `u.id, u.name, u.surname, u.patronymic, u.age, u.sex, u.country,
+	u.primary_country, u.primary_country_probability, c.name, u.enriched_at, u.deleted_at`
+
+// userSource - таблица пользователей, присоединенная к справочнику стран
+const userSource = `users u LEFT JOIN countries c ON c.code = u.primary_country`
+
+// historySource - версии пользователей под тем же псевдонимом u, что и в userSource
+const historySource = `users_history u LEFT JOIN countries c ON c.code = u.primary_country`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// querier - общее подмножество sql.DB и sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// DatabaseURL возвращает адрес базы для мигратора (golang-migrate, драйвер sqlite)
+func DatabaseURL(path string) string {
+	return "sqlite://" + path
+}
+
+// New открывает файл базы и проверяет подключение. База работает в режиме WAL, поэтому
+// чтение не ждет записи; записывающие транзакции начинаются с BEGIN IMMEDIATE и ждут
+// друг друга не дольше BusyTimeout
+func New(ctx context.Context, cfg Config) (*Storage, error) {
+	const op = storage.OpPrefixSQLite + "New"
+
+	busyTimeout := cfg.BusyTimeout
+	if busyTimeout <= 0 {
+		busyTimeout = defaultBusyTimeout
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", cfg.Path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Storage{db: db}, nil
+}
+
+// WithTx выполняет fn в одной транзакции. Provider, переданный в fn, работает внутри нее.
+// Если fn вернула ошибку, транзакция откатывается, и ошибка возвращается как есть.
+// Вложенный WithTx использует точку сохранения
+func (s *Storage) WithTx(ctx context.Context, fn storage.TxFunc) error {
+	const op = storage.OpPrefixSQLite + "WithTx"
+
+	t, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer t.Rollback(ctx)
+
+	if err := fn(&Storage{db: s.db, tx: t}); err != nil {
+		return err
+	}
+
+	if err := t.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Ping проверяет, что база доступна
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = storage.OpPrefixSQLite + "Ping"
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SchemaVersion возвращает версию схемы из таблицы мигратора. Если миграции еще
+// не применялись, возвращается 0 без ошибки
+func (s *Storage) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	const op = storage.OpPrefixSQLite + "SchemaVersion"
+
+	var exists bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`,
+	).Scan(&exists)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return 0, false, nil
+	}
+
+	var version int64
+	var dirty bool
+
+	err = s.db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uint(version), dirty, nil
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// q возвращает, через что выполнять запросы: транзакцию или базу
+func (s *Storage) q() querier {
+	if s.tx != nil {
+		return s.tx.Tx
+	}
+
+	return s.db
+}
+
+// SaveUser сохраняет нового пользователя, записывает событие create в журнал аудита и первую версию
+func (s *Storage) SaveUser(ctx context.Context, user models.EnrichedUser) (int64, error) {
+	const op = storage.OpPrefixSQLite + "SaveUser"
+
+	countryData, err := json.Marshal(user.Country)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	t, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer t.Rollback(ctx)
+
+	now := formatTime(time.Now())
+	primaryCountry, primaryProbability := primaryCountryArgs(user.Country)
+
+	result, err := t.ExecContext(ctx, `
+		INSERT INTO users (name, surname, patronymic, age, sex, country,
+			primary_country, primary_country_probability, enriched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		user.Name,
+		user.Surname,
+		user.Patronymic,
+		user.Age,
+		user.Sex,
+		string(countryData),
+		primaryCountry,
+		primaryProbability,
+		now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	created, err := lockUser(ctx, t, id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := recordChange(ctx, t, id, models.AuditCreate, nil, &created, now); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) EditUser(ctx context.Context, user models.EnrichedUser) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixSQLite + "EditUser"
+
+	countryData, err := json.Marshal(user.Country)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	primaryCountry, primaryProbability := primaryCountryArgs(user.Country)
+
+	updatedUser, err := s.auditedUpdate(ctx, user.ID, models.AuditEdit, `
+		UPDATE users
+		SET name = $1, surname = $2, patronymic = $3, age = $4, sex = $5, country = $6,
+			primary_country = $7, primary_country_probability = $8
+		WHERE id = $9 AND deleted_at IS NULL
+	`,
+		user.Name,
+		user.Surname,
+		user.Patronymic,
+		user.Age,
+		user.Sex,
+		string(countryData),
+		primaryCountry,
+		primaryProbability,
+		user.ID,
+	)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return updatedUser, nil
+}
+
+// ReEnrichUser обновляет данные обогащения пользователя и отмечает время обогащения
+func (s *Storage) ReEnrichUser(ctx context.Context, user models.EnrichedUser) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixSQLite + "ReEnrichUser"
+
+	countryData, err := json.Marshal(user.Country)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	primaryCountry, primaryProbability := primaryCountryArgs(user.Country)
+
+	// $now подставляет auditedUpdate - то же время, что и у версии в users_history
+	updatedUser, err := s.auditedUpdate(ctx, user.ID, models.AuditReEnrich, `
+		UPDATE users
+		SET age = $1, sex = $2, country = $3,
+			primary_country = $4, primary_country_probability = $5,
+			enriched_at = $now
+		WHERE id = $6 AND deleted_at IS NULL
+	`,
+		user.Age,
+		user.Sex,
+		string(countryData),
+		primaryCountry,
+		primaryProbability,
+		user.ID,
+	)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return updatedUser, nil
+}
+
+// DeleteUser мягко удаляет пользователя: строка скрывается из выборок, но ее можно
+// восстановить через RestoreUser до очистки PurgeDeletedUsers
+func (s *Storage) DeleteUser(ctx context.Context, id int64) error {
+	const op = storage.OpPrefixSQLite + "DeleteUser"
+
+	_, err := s.auditedUpdate(ctx, id, models.AuditDelete, `
+		UPDATE users
+		SET deleted_at = $now
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RestoreUser снимает отметку об удалении. Для неудаленного пользователя ничего не меняет
+func (s *Storage) RestoreUser(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixSQLite + "RestoreUser"
+
+	t, err := s.begin(ctx)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer t.Rollback(ctx)
+
+	before, err := lockUser(ctx, t, id)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if before.DeletedAt == nil {
+		return before, nil
+	}
+
+	if _, err := t.ExecContext(ctx, `UPDATE users SET deleted_at = NULL WHERE id = $1`, id); err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	restored, err := lockUser(ctx, t, id)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := recordChange(ctx, t, id, models.AuditRestore, &before, &restored, formatTime(time.Now())); err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.Commit(ctx); err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return restored, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных раньше before.
+// Возвращает количество удаленных строк
+func (s *Storage) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	const op = storage.OpPrefixSQLite + "PurgeDeletedUsers"
+
+	t, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer t.Rollback(ctx)
+
+	// Открытые версии удаляемых пользователей закрываются, чтобы на более поздние
+	// моменты пользователь не находился
+	_, err = t.ExecContext(ctx, `
+		UPDATE users_history SET valid_to = $1
+		WHERE valid_to IS NULL AND id IN (SELECT id FROM users WHERE deleted_at < $2)
+	`, formatTime(time.Now()), formatTime(before))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	result, err := t.ExecContext(ctx, `DELETE FROM users WHERE deleted_at < $1`, formatTime(before))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return purged, nil
+}
+
+func (s *Storage) GetUser(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixSQLite + "GetUser"
+
+	user, err := scanUser(s.q().QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM `+userSource+`
+		WHERE u.id = $1 AND u.deleted_at IS NULL
+	`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// GetUserForUpdate читает пользователя внутри WithTx. Построчных блокировок в SQLite нет:
+// транзакция начинается с BEGIN IMMEDIATE и до конца не пускает другие записывающие транзакции
+func (s *Storage) GetUserForUpdate(ctx context.Context, id int64) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixSQLite + "GetUserForUpdate"
+
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// GetUserAsOf возвращает версию пользователя, действовавшую в момент asOf
+func (s *Storage) GetUserAsOf(ctx context.Context, id int64, asOf time.Time) (models.EnrichedUser, error) {
+	const op = storage.OpPrefixSQLite + "GetUserAsOf"
+
+	user, err := scanUser(s.q().QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM `+historySource+`
+		WHERE u.id = $1 AND u.deleted_at IS NULL
+			AND u.valid_from <= $2 AND (u.valid_to IS NULL OR u.valid_to > $2)
+	`, id, formatTime(asOf)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return models.EnrichedUser{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func (s *Storage) GetUsers(ctx context.Context, filter models.UserFilter) ([]models.EnrichedUser, error) {
+	const op = storage.OpPrefixSQLite + "GetUsers"
+
+	conditions, args, err := userConditions(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	argPos := len(args) + 1
+
+	baseQuery := `SELECT ` + userColumns + ` FROM ` + userSourceFor(filter) + ` WHERE 1=1` + conditions
+
+	orderBy := " ORDER BY u.id ASC"
+	if hasSearch(filter.Search) {
+		// userConditions передает строку поиска первым аргументом
+		orderBy = " ORDER BY search_rank(" + searchText + ", $1) DESC, u.id ASC"
+	}
+
+	baseQuery += orderBy
+
+	// В SQLite OFFSET без LIMIT не бывает, -1 - без ограничения
+	if filter.Limit > 0 || filter.Offset > 0 {
+		limit := -1
+		if filter.Limit > 0 {
+			limit = filter.Limit
+		}
+
+		baseQuery += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argPos, argPos+1)
+		args = append(args, limit, filter.Offset)
+	}
+
+	rows, err := s.q().QueryContext(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.EnrichedUser
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+// StreamUsers проходит по всем пользователям, подходящим под фильтр (без пагинации),
+// и вызывает fn для каждого. Строки читаются по одной, запрос видит снимок данных на момент
+// начала. Ошибка fn прерывает выборку и возвращается как есть
+func (s *Storage) StreamUsers(ctx context.Context, filter models.UserFilter, fn func(models.EnrichedUser) error) error {
+	const op = storage.OpPrefixSQLite + "StreamUsers"
+
+	conditions, args, err := userConditions(filter)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.q().QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM `+userSourceFor(filter)+`
+		WHERE 1=1`+conditions+`
+		ORDER BY u.id ASC
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SuggestUsers(ctx context.Context, query string, limit int) ([]models.UserSuggestion, error) {
+	const op = storage.OpPrefixSQLite + "SuggestUsers"
+
+	rows, err := s.q().QueryContext(ctx, `
+		SELECT id, full_name
+		FROM users
+		WHERE (search_rank(full_name, $1) > 0 OR similarity(full_name, $1) > $2)
+			AND deleted_at IS NULL
+		ORDER BY search_rank(full_name, $1) DESC,
+			similarity(full_name, $1) DESC,
+			id ASC
+		LIMIT $3
+	`, query, similarityThreshold, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	suggestions := []models.UserSuggestion{}
+
+	for rows.Next() {
+		var suggestion models.UserSuggestion
+		if err := rows.Scan(&suggestion.ID, &suggestion.FullName); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		suggestions = append(suggestions, suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return suggestions, nil
+}
+
+// scanUser читает строку, выбранную по userColumns
+func scanUser(row rowScanner) (models.EnrichedUser, error) {
+	var user models.EnrichedUser
+	var patronymic, primaryCountry, primaryCountryName, deletedAt *string
+	var countryData []byte
+	var primaryProbability *float64
+	var enrichedAt string
+
+	err := row.Scan(
+		&user.ID,
+		&user.Name,
+		&user.Surname,
+		&patronymic,
+		&user.Age,
+		&user.Sex,
+		&countryData,
+		&primaryCountry,
+		&primaryProbability,
+		&primaryCountryName,
+		&enrichedAt,
+		&deletedAt,
+	)
+	if err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	if patronymic != nil {
+		user.Patronymic = *patronymic
+	}
+
+	if len(countryData) > 0 {
+		if err := json.Unmarshal(countryData, &user.Country); err != nil {
+			return models.EnrichedUser{}, fmt.Errorf("failed to unmarshal country data: %w", err)
+		}
+	}
+
+	if primaryCountry != nil {
+		user.PrimaryCountry = &models.Country{CountryID: *primaryCountry}
+		if primaryCountryName != nil {
+			user.PrimaryCountry.Name = *primaryCountryName
+		}
+		if primaryProbability != nil {
+			user.PrimaryCountry.Probability = *primaryProbability
+		}
+	}
+
+	if user.EnrichedAt, err = parseTime(enrichedAt); err != nil {
+		return models.EnrichedUser{}, err
+	}
+
+	if deletedAt != nil {
+		t, err := parseTime(*deletedAt)
+		if err != nil {
+			return models.EnrichedUser{}, err
+		}
+		user.DeletedAt = &t
+	}
+
+	return user, nil
+}
+
+// primaryCountryArgs возвращает код и вероятность наиболее вероятной страны для записи в БД
+func primaryCountryArgs(countries []models.Country) (any, any) {
+	top := models.TopCountry(countries)
+	if top == nil {
+		return nil, nil
+	}
+
+	return top.CountryID, top.Probability
+}
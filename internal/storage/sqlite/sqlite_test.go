@@ -0,0 +1,35 @@
+package sqlite_test
+
+import (
+	"context"
+	"github.com/sol1corejz/enricher/internal/migrator"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"github.com/sol1corejz/enricher/internal/storage/sqlite"
+	"github.com/sol1corejz/enricher/internal/storage/storagetest"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Provider {
+		path := filepath.Join(t.TempDir(), "enricher.db")
+
+		m, err := migrator.New(sqlite.DatabaseURL(path))
+		if err != nil {
+			t.Fatalf("migrator.New: %v", err)
+		}
+		defer m.Close()
+
+		if err := m.Up(); err != nil {
+			t.Fatalf("migrator.Up: %v", err)
+		}
+
+		s, err := sqlite.New(context.Background(), sqlite.Config{Path: path})
+		if err != nil {
+			t.Fatalf("sqlite.New: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+
+		return s
+	})
+}
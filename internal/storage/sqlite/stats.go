@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"sort"
+)
+
+func (s *Storage) GetUserStats(ctx context.Context, filter models.UserFilter, opts models.StatsOptions) (models.UserStats, error) {
+	const op = storage.OpPrefixSQLite + "GetUserStats"
+
+	conditions, args, err := userConditions(filter)
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	argPos := len(args) + 1
+
+	// Все агрегаты считаются по одному снимку данных
+	t, err := s.begin(ctx)
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer t.Rollback(ctx)
+
+	stats := models.UserStats{
+		BySex:        map[string]int64{},
+		AgeHistogram: models.NewAgeHistogram(opts.AgeBuckets),
+		TopCountries: []models.CountryStats{},
+	}
+
+	rows, err := t.QueryContext(ctx, `
+		SELECT u.sex, count(*)
+		FROM `+userSourceFor(filter)+`
+		WHERE 1=1`+conditions+`
+		GROUP BY u.sex
+	`, args...)
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for rows.Next() {
+		var sex string
+		var count int64
+		if err := rows.Scan(&sex, &count); err != nil {
+			rows.Close()
+			return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+		}
+		stats.BySex[sex] = count
+		stats.Total += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// width_bucket в SQLite нет: считаем по каждому возрасту и раскладываем по корзинам здесь
+	rows, err = t.QueryContext(ctx, `
+		SELECT u.age, count(*)
+		FROM `+userSourceFor(filter)+`
+		WHERE 1=1`+conditions+`
+		GROUP BY u.age
+	`, args...)
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for rows.Next() {
+		var age int
+		var count int64
+		if err := rows.Scan(&age, &count); err != nil {
+			rows.Close()
+			return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+		}
+		bucket := sort.Search(len(opts.AgeBuckets), func(i int) bool { return opts.AgeBuckets[i] > age })
+		stats.AgeHistogram[bucket].Count += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err = t.QueryContext(ctx, fmt.Sprintf(`
+		SELECT u.primary_country, coalesce(c.name, ''), count(*), avg(u.age)
+		FROM `+userSourceFor(filter)+`
+		WHERE u.primary_country IS NOT NULL`+conditions+`
+		GROUP BY u.primary_country, c.name
+		ORDER BY count(*) DESC, u.primary_country ASC
+		LIMIT $%d
+	`, argPos), append(args, opts.TopCountries)...)
+	if err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for rows.Next() {
+		var country models.CountryStats
+		if err := rows.Scan(&country.CountryID, &country.Name, &country.Count, &country.AverageAge); err != nil {
+			rows.Close()
+			return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+		}
+		stats.TopCountries = append(stats.TopCountries, country)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.UserStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,72 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// tx - транзакция или точка сохранения внутри нее. Commit и Rollback у точки сохранения
+// освобождают и откатывают только ее
+type tx struct {
+	*sql.Tx
+
+	// depth - уровень вложенности: 0 - сама транзакция, иначе точка сохранения sp_<depth>
+	depth int
+	done  bool
+}
+
+// begin начинает транзакцию, а внутри WithTx - точку сохранения
+func (s *Storage) begin(ctx context.Context) (*tx, error) {
+	if s.tx == nil {
+		sqlTx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tx{Tx: sqlTx}, nil
+	}
+
+	t := &tx{Tx: s.tx.Tx, depth: s.tx.depth + 1}
+	if _, err := t.ExecContext(ctx, "SAVEPOINT "+t.savepoint()); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *tx) savepoint() string {
+	return fmt.Sprintf("sp_%d", t.depth)
+}
+
+func (t *tx) Commit(ctx context.Context) error {
+	t.done = true
+
+	if t.depth == 0 {
+		return t.Tx.Commit()
+	}
+
+	_, err := t.ExecContext(ctx, "RELEASE "+t.savepoint())
+
+	return err
+}
+
+// Rollback откатывает незавершенную транзакцию; после Commit ничего не делает
+func (t *tx) Rollback(ctx context.Context) error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+
+	if t.depth == 0 {
+		return t.Tx.Rollback()
+	}
+
+	// ROLLBACK TO оставляет точку сохранения открытой, поэтому ее нужно еще и освободить
+	if _, err := t.ExecContext(ctx, "ROLLBACK TO "+t.savepoint()); err != nil {
+		return err
+	}
+	_, err := t.ExecContext(ctx, "RELEASE "+t.savepoint())
+
+	return err
+}
@@ -3,5 +3,9 @@ package storage
 import "errors"
 
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrImportNotFound = errors.New("import not found")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyExists   = errors.New("api key with this name already exists")
+	ErrQuotaExceeded  = errors.New("quota exceeded")
 )
@@ -0,0 +1,938 @@
+// Package storagetest - общий набор проверок реализаций storage.Provider. Каждое хранилище
+// подключает его из своего теста, чтобы postgres и memory вели себя одинаково:
+//
+//	func TestStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Provider { return memory.New() })
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/sol1corejz/enricher/internal/domain/models"
+	"github.com/sol1corejz/enricher/internal/lib/filterexpr"
+	"github.com/sol1corejz/enricher/internal/lib/reqctx"
+	"github.com/sol1corejz/enricher/internal/services/auth"
+	"github.com/sol1corejz/enricher/internal/services/quota"
+	"github.com/sol1corejz/enricher/internal/storage"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// NewProvider возвращает пустое хранилище для одной проверки. Для Postgres это
+// база с примененными миграциями и без данных
+type NewProvider func(t *testing.T) storage.Provider
+
+// Run запускает все проверки, каждую на своем хранилище
+func Run(t *testing.T, newProvider NewProvider) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, p storage.Provider)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"EditUser", testEditUser},
+		{"ReEnrichUser", testReEnrichUser},
+		{"NotFound", testNotFound},
+		{"DeleteRestorePurge", testDeleteRestorePurge},
+		{"GetUsersFilters", testGetUsersFilters},
+		{"GetUsersPagination", testGetUsersPagination},
+		{"GetUsersExpression", testGetUsersExpression},
+		{"GetUsersSearch", testGetUsersSearch},
+		{"SuggestUsers", testSuggestUsers},
+		{"GetUserStats", testGetUserStats},
+		{"StreamUsers", testStreamUsers},
+		{"History", testHistory},
+		{"AsOf", testAsOf},
+		{"WithTx", testWithTx},
+		{"Imports", testImports},
+		{"FailStaleImports", testFailStaleImports},
+		{"APIKeys", testAPIKeys},
+		{"EnrichmentQuota", testEnrichmentQuota},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newProvider(t))
+		})
+	}
+}
+
+func user(name, surname string, age int, sex string, countries ...string) models.EnrichedUser {
+	u := models.EnrichedUser{Name: name, Surname: surname, Age: age, Sex: sex, Country: []models.Country{}}
+	for i, code := range countries {
+		// Первая страна - самая вероятная
+		u.Country = append(u.Country, models.Country{CountryID: code, Probability: 0.5 / float64(i+1)})
+	}
+
+	return u
+}
+
+func mustSave(t *testing.T, p storage.Provider, u models.EnrichedUser) int64 {
+	t.Helper()
+
+	id, err := p.SaveUser(context.Background(), u)
+	if err != nil {
+		t.Fatalf("SaveUser(%s %s): %v", u.Name, u.Surname, err)
+	}
+
+	return id
+}
+
+func mustGetUsers(t *testing.T, p storage.Provider, filter models.UserFilter) []int64 {
+	t.Helper()
+
+	users, err := p.GetUsers(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("GetUsers(%+v): %v", filter, err)
+	}
+
+	return ids(users)
+}
+
+func ids(users []models.EnrichedUser) []int64 {
+	result := []int64{}
+	for _, u := range users {
+		result = append(result, u.ID)
+	}
+
+	return result
+}
+
+func assertIDs(t *testing.T, what string, got, want []int64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%s: got ids %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got ids %v, want %v", what, got, want)
+		}
+	}
+}
+
+func assertNotFound(t *testing.T, what string, err error) {
+	t.Helper()
+
+	if !errors.Is(err, storage.ErrUserNotFound) {
+		t.Fatalf("%s: got error %v, want %v", what, err, storage.ErrUserNotFound)
+	}
+}
+
+func testSaveAndGet(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	saved := user("Ivan", "Petrov", 30, "male", "RU", "KZ")
+	saved.Patronymic = "Sergeevich"
+	id := mustSave(t, p, saved)
+
+	got, err := p.GetUser(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+
+	if got.ID != id || got.Name != "Ivan" || got.Surname != "Petrov" || got.Patronymic != "Sergeevich" ||
+		got.Age != 30 || got.Sex != "male" {
+		t.Fatalf("GetUser: got %+v", got)
+	}
+	if len(got.Country) != 2 {
+		t.Fatalf("GetUser: got countries %+v, want 2", got.Country)
+	}
+	if got.PrimaryCountry == nil || got.PrimaryCountry.CountryID != "RU" || got.PrimaryCountry.Name == "" {
+		t.Fatalf("GetUser: got primary country %+v, want RU with name", got.PrimaryCountry)
+	}
+	if got.EnrichedAt.IsZero() {
+		t.Fatal("GetUser: enriched_at is not set")
+	}
+	if got.DeletedAt != nil {
+		t.Fatalf("GetUser: got deleted_at %v for new user", got.DeletedAt)
+	}
+
+	second := mustSave(t, p, user("Anna", "Ivanova", 25, "female"))
+	if second <= id {
+		t.Fatalf("SaveUser: got id %d after %d, want increasing ids", second, id)
+	}
+
+	got, err = p.GetUser(ctx, second)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if got.PrimaryCountry != nil {
+		t.Fatalf("GetUser: got primary country %+v for user without countries", got.PrimaryCountry)
+	}
+
+	if _, err := p.SaveUser(ctx, user("Bad", "Sex", 20, "unknown")); err == nil {
+		t.Fatal("SaveUser: invalid sex accepted")
+	}
+}
+
+func testEditUser(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	id := mustSave(t, p, user("Ivan", "Petrov", 30, "male", "RU"))
+	before, err := p.GetUser(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+
+	edited := user("Ivan", "Sidorov", 31, "male", "KZ")
+	edited.ID = id
+
+	got, err := p.EditUser(ctx, edited)
+	if err != nil {
+		t.Fatalf("EditUser: %v", err)
+	}
+	if got.Surname != "Sidorov" || got.Age != 31 || got.PrimaryCountry == nil || got.PrimaryCountry.CountryID != "KZ" {
+		t.Fatalf("EditUser: got %+v", got)
+	}
+	if !got.EnrichedAt.Equal(before.EnrichedAt) {
+		t.Fatalf("EditUser: enriched_at changed from %v to %v", before.EnrichedAt, got.EnrichedAt)
+	}
+
+	stored, err := p.GetUser(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if stored.Surname != "Sidorov" {
+		t.Fatalf("GetUser after EditUser: got surname %q", stored.Surname)
+	}
+
+	locked, err := p.GetUserForUpdate(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserForUpdate: %v", err)
+	}
+	if locked.Surname != "Sidorov" {
+		t.Fatalf("GetUserForUpdate: got surname %q", locked.Surname)
+	}
+}
+
+func testReEnrichUser(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	id := mustSave(t, p, user("Ivan", "Petrov", 30, "male", "RU"))
+	before, err := p.GetUser(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+
+	enriched := user("Ignored", "Ignored", 40, "male", "US")
+	enriched.ID = id
+
+	got, err := p.ReEnrichUser(ctx, enriched)
+	if err != nil {
+		t.Fatalf("ReEnrichUser: %v", err)
+	}
+	if got.Name != "Ivan" || got.Surname != "Petrov" {
+		t.Fatalf("ReEnrichUser: name changed to %s %s", got.Name, got.Surname)
+	}
+	if got.Age != 40 || got.PrimaryCountry == nil || got.PrimaryCountry.CountryID != "US" {
+		t.Fatalf("ReEnrichUser: got %+v", got)
+	}
+	if got.EnrichedAt.Before(before.EnrichedAt) {
+		t.Fatalf("ReEnrichUser: enriched_at moved back from %v to %v", before.EnrichedAt, got.EnrichedAt)
+	}
+}
+
+func testNotFound(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	_, err := p.GetUser(ctx, 404)
+	assertNotFound(t, "GetUser", err)
+
+	_, err = p.GetUserForUpdate(ctx, 404)
+	assertNotFound(t, "GetUserForUpdate", err)
+
+	_, err = p.EditUser(ctx, models.EnrichedUser{ID: 404, Name: "Ivan", Surname: "Petrov", Sex: "male"})
+	assertNotFound(t, "EditUser", err)
+
+	_, err = p.ReEnrichUser(ctx, models.EnrichedUser{ID: 404, Sex: "male"})
+	assertNotFound(t, "ReEnrichUser", err)
+
+	assertNotFound(t, "DeleteUser", p.DeleteUser(ctx, 404))
+
+	_, err = p.RestoreUser(ctx, 404)
+	assertNotFound(t, "RestoreUser", err)
+
+	_, err = p.GetUserHistory(ctx, 404)
+	assertNotFound(t, "GetUserHistory", err)
+
+	_, err = p.GetUserAsOf(ctx, 404, time.Now())
+	assertNotFound(t, "GetUserAsOf", err)
+
+	if _, err := p.GetImport(ctx, 404); !errors.Is(err, storage.ErrImportNotFound) {
+		t.Fatalf("GetImport: got error %v, want %v", err, storage.ErrImportNotFound)
+	}
+}
+
+func testDeleteRestorePurge(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	kept := mustSave(t, p, user("Ivan", "Petrov", 30, "male"))
+	deleted := mustSave(t, p, user("Anna", "Ivanova", 25, "female"))
+
+	if err := p.DeleteUser(ctx, deleted); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	_, err := p.GetUser(ctx, deleted)
+	assertNotFound(t, "GetUser after DeleteUser", err)
+	assertNotFound(t, "repeated DeleteUser", p.DeleteUser(ctx, deleted))
+
+	edited := user("Anna", "Smirnova", 25, "female")
+	edited.ID = deleted
+	_, err = p.EditUser(ctx, edited)
+	assertNotFound(t, "EditUser of deleted user", err)
+
+	assertIDs(t, "GetUsers", mustGetUsers(t, p, models.UserFilter{}), []int64{kept})
+	assertIDs(t, "GetUsers includeDeleted", mustGetUsers(t, p, models.UserFilter{IncludeDeleted: true}), []int64{kept, deleted})
+
+	restored, err := p.RestoreUser(ctx, deleted)
+	if err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	if restored.DeletedAt != nil {
+		t.Fatalf("RestoreUser: got deleted_at %v", restored.DeletedAt)
+	}
+	if _, err := p.RestoreUser(ctx, deleted); err != nil {
+		t.Fatalf("RestoreUser of not deleted user: %v", err)
+	}
+	assertIDs(t, "GetUsers after RestoreUser", mustGetUsers(t, p, models.UserFilter{}), []int64{kept, deleted})
+
+	if err := p.DeleteUser(ctx, deleted); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	purged, err := p.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("PurgeDeletedUsers: %v", err)
+	}
+	if purged != 0 {
+		t.Fatalf("PurgeDeletedUsers before retention: purged %d, want 0", purged)
+	}
+
+	purged, err = p.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("PurgeDeletedUsers: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("PurgeDeletedUsers: purged %d, want 1", purged)
+	}
+
+	_, err = p.RestoreUser(ctx, deleted)
+	assertNotFound(t, "RestoreUser after purge", err)
+	assertIDs(t, "GetUsers includeDeleted after purge", mustGetUsers(t, p, models.UserFilter{IncludeDeleted: true}), []int64{kept})
+}
+
+func testGetUsersFilters(t *testing.T, p storage.Provider) {
+	ivan := mustSave(t, p, user("Ivan", "Petrov", 30, "male", "RU"))
+	anna := mustSave(t, p, user("Anna", "Petrova", 25, "female", "KZ"))
+	oleg := mustSave(t, p, user("Oleg", "Sidorov", 45, "male", "US", "RU"))
+
+	tests := []struct {
+		name   string
+		filter models.UserFilter
+		want   []int64
+	}{
+		{"all", models.UserFilter{}, []int64{ivan, anna, oleg}},
+		{"name contains, case insensitive", models.UserFilter{Name: "an"}, []int64{ivan, anna}},
+		{"surname contains", models.UserFilter{Surname: "petrov"}, []int64{ivan, anna}},
+		{"age from", models.UserFilter{AgeFrom: 30}, []int64{ivan, oleg}},
+		{"age to", models.UserFilter{AgeTo: 30}, []int64{ivan, anna}},
+		{"age range", models.UserFilter{AgeFrom: 26, AgeTo: 44}, []int64{ivan}},
+		{"sex", models.UserFilter{Sex: "female"}, []int64{anna}},
+		{"country in any position", models.UserFilter{Country: "ru"}, []int64{ivan, oleg}},
+		{"combined", models.UserFilter{Sex: "male", Country: "RU", AgeFrom: 40}, []int64{oleg}},
+		{"enriched before", models.UserFilter{EnrichedBefore: time.Now().Add(-time.Hour)}, []int64{}},
+		{"enriched before now", models.UserFilter{EnrichedBefore: time.Now().Add(time.Hour)}, []int64{ivan, anna, oleg}},
+	}
+
+	for _, tt := range tests {
+		assertIDs(t, tt.name, mustGetUsers(t, p, tt.filter), tt.want)
+	}
+}
+
+func testGetUsersPagination(t *testing.T, p storage.Provider) {
+	var all []int64
+	for i := 0; i < 5; i++ {
+		all = append(all, mustSave(t, p, user("Ivan", "Petrov", 20+i, "male")))
+	}
+
+	assertIDs(t, "limit", mustGetUsers(t, p, models.UserFilter{Limit: 2}), all[:2])
+	assertIDs(t, "limit offset", mustGetUsers(t, p, models.UserFilter{Limit: 2, Offset: 2}), all[2:4])
+	assertIDs(t, "offset", mustGetUsers(t, p, models.UserFilter{Offset: 3}), all[3:])
+	assertIDs(t, "offset past end", mustGetUsers(t, p, models.UserFilter{Offset: 10}), []int64{})
+}
+
+func testGetUsersExpression(t *testing.T, p storage.Provider) {
+	ivan := mustSave(t, p, user("Ivan", "Petrov", 30, "male", "RU"))
+	anna := mustSave(t, p, user("Anna", "O'Brien", 35, "female", "KZ"))
+	oleg := mustSave(t, p, user("Oleg", "Sidorov", 45, "male"))
+
+	tests := []struct {
+		expr string
+		want []int64
+	}{
+		{"sex eq 'male'", []int64{ivan, oleg}},
+		{"(sex eq 'female' and age gt 30) or country in ('RU')", []int64{ivan, anna}},
+		{"surname eq 'O''Brien'", []int64{anna}},
+		{"name contains 'LEG'", []int64{oleg}},
+		{"age ge 35 and age lt 45", []int64{anna}},
+		// country у пользователя без стран - NULL: не подходит ни под условие, ни под его отрицание
+		{"country ne 'RU'", []int64{anna}},
+		{"not (country eq 'RU')", []int64{anna}},
+		{"id in (" + itoa(ivan) + ", " + itoa(oleg) + ")", []int64{ivan, oleg}},
+	}
+
+	for _, tt := range tests {
+		expr, err := filterexpr.Parse(tt.expr, models.UserFilterFields)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+
+		assertIDs(t, tt.expr, mustGetUsers(t, p, models.UserFilter{Expression: expr}), tt.want)
+	}
+}
+
+func testGetUsersSearch(t *testing.T, p storage.Provider) {
+	ivan := mustSave(t, p, user("Ivan", "Petrov", 30, "male"))
+	ivanIvanov := mustSave(t, p, user("Ivan", "Ivanov", 40, "male"))
+	mustSave(t, p, user("Anna", "Sidorova", 25, "female"))
+
+	// Префиксный поиск по всем словам ФИО, более полные совпадения выше
+	assertIDs(t, "search by prefix", mustGetUsers(t, p, models.UserFilter{Search: "iva"}), []int64{ivanIvanov, ivan})
+	assertIDs(t, "search all words", mustGetUsers(t, p, models.UserFilter{Search: "ivan pet"}), []int64{ivan})
+	assertIDs(t, "search not found", mustGetUsers(t, p, models.UserFilter{Search: "oleg"}), []int64{})
+}
+
+func testSuggestUsers(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	ivan := mustSave(t, p, user("Ivan", "Petrov", 30, "male"))
+	mustSave(t, p, user("Anna", "Sidorova", 25, "female"))
+
+	suggestions, err := p.SuggestUsers(ctx, "Petr", 10)
+	if err != nil {
+		t.Fatalf("SuggestUsers: %v", err)
+	}
+	if len(suggestions) != 1 || suggestions[0].ID != ivan || suggestions[0].FullName != "Ivan Petrov" {
+		t.Fatalf("SuggestUsers(Petr): got %+v", suggestions)
+	}
+
+	// Опечатка находится по похожести триграмм
+	suggestions, err = p.SuggestUsers(ctx, "Ivan Petorv", 10)
+	if err != nil {
+		t.Fatalf("SuggestUsers: %v", err)
+	}
+	if len(suggestions) != 1 || suggestions[0].ID != ivan {
+		t.Fatalf("SuggestUsers(Ivan Petorv): got %+v", suggestions)
+	}
+
+	suggestions, err = p.SuggestUsers(ctx, "zzz", 10)
+	if err != nil {
+		t.Fatalf("SuggestUsers: %v", err)
+	}
+	if len(suggestions) != 0 {
+		t.Fatalf("SuggestUsers(zzz): got %+v, want none", suggestions)
+	}
+}
+
+func testGetUserStats(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	mustSave(t, p, user("Ivan", "Petrov", 17, "male", "RU"))
+	mustSave(t, p, user("Oleg", "Sidorov", 30, "male", "RU"))
+	mustSave(t, p, user("Anna", "Ivanova", 45, "female", "KZ"))
+	mustSave(t, p, user("Olga", "Orlova", 50, "female"))
+	deleted := mustSave(t, p, user("Petr", "Petrov", 60, "male", "KZ"))
+	if err := p.DeleteUser(ctx, deleted); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	stats, err := p.GetUserStats(ctx, models.UserFilter{}, models.StatsOptions{AgeBuckets: []int{18, 45}, TopCountries: 1})
+	if err != nil {
+		t.Fatalf("GetUserStats: %v", err)
+	}
+
+	if stats.Total != 4 || stats.BySex["male"] != 2 || stats.BySex["female"] != 2 {
+		t.Fatalf("GetUserStats: got total %d, by sex %v", stats.Total, stats.BySex)
+	}
+
+	wantCounts := []int64{1, 1, 2}
+	if len(stats.AgeHistogram) != len(wantCounts) {
+		t.Fatalf("GetUserStats: got histogram %+v", stats.AgeHistogram)
+	}
+	for i, want := range wantCounts {
+		if stats.AgeHistogram[i].Count != want {
+			t.Fatalf("GetUserStats: got histogram %+v, want counts %v", stats.AgeHistogram, wantCounts)
+		}
+	}
+
+	if len(stats.TopCountries) != 1 {
+		t.Fatalf("GetUserStats: got top countries %+v, want 1", stats.TopCountries)
+	}
+	top := stats.TopCountries[0]
+	if top.CountryID != "RU" || top.Count != 2 || top.AverageAge != 23.5 || top.Name == "" {
+		t.Fatalf("GetUserStats: got top country %+v", top)
+	}
+
+	stats, err = p.GetUserStats(ctx, models.UserFilter{Sex: "female"}, models.StatsOptions{TopCountries: 5})
+	if err != nil {
+		t.Fatalf("GetUserStats: %v", err)
+	}
+	if stats.Total != 2 || len(stats.TopCountries) != 1 || stats.TopCountries[0].CountryID != "KZ" {
+		t.Fatalf("GetUserStats(female): got %+v", stats)
+	}
+}
+
+func testStreamUsers(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	var want []int64
+	for i := 0; i < 3; i++ {
+		want = append(want, mustSave(t, p, user("Ivan", "Petrov", 30+i, "male")))
+	}
+	mustSave(t, p, user("Anna", "Ivanova", 25, "female"))
+
+	var got []int64
+	err := p.StreamUsers(ctx, models.UserFilter{Sex: "male", Limit: 1}, func(u models.EnrichedUser) error {
+		got = append(got, u.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamUsers: %v", err)
+	}
+
+	// Пагинация фильтра в выгрузке не применяется
+	assertIDs(t, "StreamUsers", got, want)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = p.StreamUsers(ctx, models.UserFilter{}, func(u models.EnrichedUser) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("StreamUsers: got error %v after %d calls, want callback error after 1 call", err, calls)
+	}
+}
+
+func testHistory(t *testing.T, p storage.Provider) {
+	ctx := reqctx.WithRequestID(reqctx.WithActor(context.Background(), "tester"), "req-1")
+
+	id, err := p.SaveUser(ctx, user("Ivan", "Petrov", 30, "male"))
+	if err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+
+	edited := user("Ivan", "Sidorov", 30, "male")
+	edited.ID = id
+	if _, err := p.EditUser(ctx, edited); err != nil {
+		t.Fatalf("EditUser: %v", err)
+	}
+	if err := p.DeleteUser(ctx, id); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := p.RestoreUser(ctx, id); err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+
+	history, err := p.GetUserHistory(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserHistory: %v", err)
+	}
+
+	wantActions := []models.AuditAction{models.AuditCreate, models.AuditEdit, models.AuditDelete, models.AuditRestore}
+	if len(history) != len(wantActions) {
+		t.Fatalf("GetUserHistory: got %d entries, want %d", len(history), len(wantActions))
+	}
+	for i, entry := range history {
+		if entry.Action != wantActions[i] || entry.UserID != id || entry.Actor != "tester" || entry.RequestID != "req-1" {
+			t.Fatalf("GetUserHistory: entry %d is %+v", i, entry)
+		}
+	}
+
+	if history[0].Before != nil || history[0].After == nil || history[0].After.Surname != "Petrov" {
+		t.Fatalf("GetUserHistory: create entry %+v", history[0])
+	}
+	if history[1].Before.Surname != "Petrov" || history[1].After.Surname != "Sidorov" {
+		t.Fatalf("GetUserHistory: edit entry %+v", history[1])
+	}
+	if history[2].After.DeletedAt == nil || history[3].After.DeletedAt != nil {
+		t.Fatalf("GetUserHistory: delete/restore entries %+v, %+v", history[2], history[3])
+	}
+}
+
+func testAsOf(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	id := mustSave(t, p, user("Ivan", "Petrov", 30, "male"))
+	beforeEdit := time.Now()
+	// Отделяем версии друг от друга, чтобы момент beforeEdit попал строго между ними
+	time.Sleep(10 * time.Millisecond)
+
+	edited := user("Ivan", "Sidorov", 30, "male")
+	edited.ID = id
+	if _, err := p.EditUser(ctx, edited); err != nil {
+		t.Fatalf("EditUser: %v", err)
+	}
+
+	old, err := p.GetUserAsOf(ctx, id, beforeEdit)
+	if err != nil {
+		t.Fatalf("GetUserAsOf: %v", err)
+	}
+	if old.Surname != "Petrov" {
+		t.Fatalf("GetUserAsOf: got surname %q, want Petrov", old.Surname)
+	}
+
+	current, err := p.GetUserAsOf(ctx, id, time.Now())
+	if err != nil {
+		t.Fatalf("GetUserAsOf: %v", err)
+	}
+	if current.Surname != "Sidorov" {
+		t.Fatalf("GetUserAsOf(now): got surname %q, want Sidorov", current.Surname)
+	}
+
+	_, err = p.GetUserAsOf(ctx, id, beforeEdit.Add(-time.Hour))
+	assertNotFound(t, "GetUserAsOf before creation", err)
+
+	users, err := p.GetUsers(ctx, models.UserFilter{AsOf: beforeEdit, Surname: "Petrov"})
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	assertIDs(t, "GetUsers asOf", ids(users), []int64{id})
+
+	time.Sleep(10 * time.Millisecond)
+	beforeDelete := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if err := p.DeleteUser(ctx, id); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	if _, err := p.GetUserAsOf(ctx, id, beforeDelete); err != nil {
+		t.Fatalf("GetUserAsOf before delete: %v", err)
+	}
+	_, err = p.GetUserAsOf(ctx, id, time.Now())
+	assertNotFound(t, "GetUserAsOf after delete", err)
+}
+
+func testWithTx(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	errRollback := errors.New("rollback")
+
+	var rolledBack int64
+	err := p.WithTx(ctx, func(tx storage.Provider) error {
+		id, err := tx.SaveUser(ctx, user("Ivan", "Petrov", 30, "male"))
+		if err != nil {
+			return err
+		}
+		rolledBack = id
+
+		// Внутри транзакции изменения видны
+		if _, err := tx.GetUser(ctx, id); err != nil {
+			return err
+		}
+
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx: got error %v, want %v", err, errRollback)
+	}
+
+	_, err = p.GetUser(ctx, rolledBack)
+	assertNotFound(t, "GetUser after rollback", err)
+
+	var committed, nested int64
+	err = p.WithTx(ctx, func(tx storage.Provider) error {
+		var err error
+		if committed, err = tx.SaveUser(ctx, user("Anna", "Ivanova", 25, "female")); err != nil {
+			return err
+		}
+
+		// Вложенная транзакция откатывает только свои изменения
+		nestedErr := tx.WithTx(ctx, func(tx storage.Provider) error {
+			if nested, err = tx.SaveUser(ctx, user("Oleg", "Sidorov", 45, "male")); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(nestedErr, errRollback) {
+			t.Errorf("nested WithTx: got error %v, want %v", nestedErr, errRollback)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	if _, err := p.GetUser(ctx, committed); err != nil {
+		t.Fatalf("GetUser after commit: %v", err)
+	}
+	_, err = p.GetUser(ctx, nested)
+	assertNotFound(t, "GetUser after nested rollback", err)
+
+	// Паника в fn откатывает транзакцию и не оставляет хранилище заблокированным
+	var panicked int64
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithTx: panic in fn was not propagated")
+			}
+		}()
+
+		_ = p.WithTx(ctx, func(tx storage.Provider) error {
+			var err error
+			if panicked, err = tx.SaveUser(ctx, user("Pavel", "Orlov", 50, "male")); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+
+	_, err = p.GetUser(ctx, panicked)
+	assertNotFound(t, "GetUser after panic", err)
+	mustSave(t, p, user("Maria", "Orlova", 48, "female"))
+}
+
+func testImports(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	id, err := p.CreateImport(ctx, models.Import{Status: models.ImportPending, Format: "csv", Total: 3, Processed: 1, Failed: 1})
+	if err != nil {
+		t.Fatalf("CreateImport: %v", err)
+	}
+
+	err = p.AddImportErrors(ctx, id, []models.ImportRowError{{Row: 3, Error: "bad row"}, {Row: 1, Error: "empty name"}})
+	if err != nil {
+		t.Fatalf("AddImportErrors: %v", err)
+	}
+	// Повтор ошибки той же строки игнорируется
+	if err := p.AddImportErrors(ctx, id, []models.ImportRowError{{Row: 1, Error: "again"}}); err != nil {
+		t.Fatalf("AddImportErrors: %v", err)
+	}
+
+	imp, err := p.GetImport(ctx, id)
+	if err != nil {
+		t.Fatalf("GetImport: %v", err)
+	}
+	if imp.ID != id || imp.Status != models.ImportPending || imp.Format != "csv" || imp.Total != 3 ||
+		imp.Processed != 1 || imp.Failed != 1 || imp.FinishedAt != nil || imp.CreatedAt.IsZero() {
+		t.Fatalf("GetImport: got %+v", imp)
+	}
+	if len(imp.Errors) != 2 || imp.Errors[0] != (models.ImportRowError{Row: 1, Error: "empty name"}) || imp.Errors[1].Row != 3 {
+		t.Fatalf("GetImport: got errors %+v", imp.Errors)
+	}
+
+	imp.Status = models.ImportRunning
+	imp.Processed = 2
+	imp.Succeeded = 1
+	if err := p.UpdateImport(ctx, imp); err != nil {
+		t.Fatalf("UpdateImport: %v", err)
+	}
+
+	imp, err = p.GetImport(ctx, id)
+	if err != nil {
+		t.Fatalf("GetImport: %v", err)
+	}
+	if imp.Status != models.ImportRunning || imp.Processed != 2 || imp.Succeeded != 1 || imp.FinishedAt != nil {
+		t.Fatalf("GetImport after update: got %+v", imp)
+	}
+
+	imp.Status = models.ImportFailed
+	imp.Error = "failed to save progress"
+	if err := p.UpdateImport(ctx, imp); err != nil {
+		t.Fatalf("UpdateImport: %v", err)
+	}
+
+	imp, err = p.GetImport(ctx, id)
+	if err != nil {
+		t.Fatalf("GetImport: %v", err)
+	}
+	if imp.Status != models.ImportFailed || imp.Error != "failed to save progress" || imp.FinishedAt == nil {
+		t.Fatalf("GetImport after finish: got %+v", imp)
+	}
+
+	err = p.UpdateImport(ctx, models.Import{ID: id + 100, Status: models.ImportCompleted})
+	if !errors.Is(err, storage.ErrImportNotFound) {
+		t.Fatalf("UpdateImport of unknown import: got error %v, want %v", err, storage.ErrImportNotFound)
+	}
+}
+
+func testFailStaleImports(t *testing.T, p storage.Provider) {
+	ctx := context.Background()
+
+	create := func(status models.ImportStatus) int64 {
+		t.Helper()
+
+		id, err := p.CreateImport(ctx, models.Import{Status: models.ImportPending, Format: "csv", Total: 10})
+		if err != nil {
+			t.Fatalf("CreateImport: %v", err)
+		}
+		if status != models.ImportPending {
+			if err := p.UpdateImport(ctx, models.Import{ID: id, Status: status, Processed: 4, Succeeded: 4}); err != nil {
+				t.Fatalf("UpdateImport: %v", err)
+			}
+		}
+
+		return id
+	}
+
+	pending := create(models.ImportPending)
+	running := create(models.ImportRunning)
+	completed := create(models.ImportCompleted)
+
+	// Задачи, обновленные позже before, не трогаются
+	failed, err := p.FailStaleImports(ctx, time.Now().Add(-time.Hour), "abandoned")
+	if err != nil || failed != 0 {
+		t.Fatalf("FailStaleImports with old cutoff: got %d, %v, want 0", failed, err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	fresh := create(models.ImportRunning)
+
+	failed, err = p.FailStaleImports(ctx, time.Now().Add(-5*time.Millisecond), "abandoned")
+	if err != nil || failed != 2 {
+		t.Fatalf("FailStaleImports: got %d, %v, want 2", failed, err)
+	}
+
+	for _, tt := range []struct {
+		id        int64
+		status    models.ImportStatus
+		error     string
+		processed int
+	}{
+		{pending, models.ImportFailed, "abandoned", 0},
+		{running, models.ImportFailed, "abandoned", 4},
+		{completed, models.ImportCompleted, "", 4},
+		{fresh, models.ImportRunning, "", 4},
+	} {
+		imp, err := p.GetImport(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("GetImport(%d): %v", tt.id, err)
+		}
+		if imp.Status != tt.status || imp.Error != tt.error {
+			t.Fatalf("GetImport(%d): got status %q, error %q, want %q, %q", tt.id, imp.Status, imp.Error, tt.status, tt.error)
+		}
+		if imp.Processed != tt.processed {
+			t.Fatalf("GetImport(%d): got processed %d, want %d", tt.id, imp.Processed, tt.processed)
+		}
+		if tt.status == models.ImportFailed && imp.FinishedAt == nil {
+			t.Fatalf("GetImport(%d): finished_at is not set", tt.id)
+		}
+	}
+}
+
+func testAPIKeys(t *testing.T, p storage.Provider) {
+	keys, ok := p.(auth.KeyStore)
+	if !ok {
+		t.Skip("storage does not store api keys")
+	}
+
+	ctx := context.Background()
+
+	id, err := keys.CreateAPIKey(ctx, models.APIKey{Name: "importer", Prefix: "enr_aaaa", Role: models.RoleEditor, KeyHash: "hash-1"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	_, err = keys.CreateAPIKey(ctx, models.APIKey{Name: "importer", Prefix: "enr_bbbb", Role: models.RoleReader, KeyHash: "hash-2"})
+	if !errors.Is(err, storage.ErrAPIKeyExists) {
+		t.Fatalf("CreateAPIKey with active name: got error %v, want %v", err, storage.ErrAPIKeyExists)
+	}
+
+	key, err := keys.GetAPIKeyByHash(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash: %v", err)
+	}
+	if key.ID != id || key.Name != "importer" || key.Prefix != "enr_aaaa" || key.Role != models.RoleEditor || key.CreatedAt.IsZero() ||
+		key.LastUsedAt != nil || key.RevokedAt != nil {
+		t.Fatalf("GetAPIKeyByHash: got %+v", key)
+	}
+
+	usedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := keys.TouchAPIKey(ctx, id, usedAt); err != nil {
+		t.Fatalf("TouchAPIKey: %v", err)
+	}
+
+	if err := keys.RevokeAPIKey(ctx, id); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if err := keys.RevokeAPIKey(ctx, id); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Fatalf("RevokeAPIKey twice: got error %v, want %v", err, storage.ErrAPIKeyNotFound)
+	}
+	if _, err := keys.GetAPIKeyByHash(ctx, "hash-1"); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Fatalf("GetAPIKeyByHash of revoked key: got error %v, want %v", err, storage.ErrAPIKeyNotFound)
+	}
+
+	// Имя отозванного ключа можно использовать снова
+	if _, err := keys.CreateAPIKey(ctx, models.APIKey{Name: "importer", Prefix: "enr_cccc", Role: models.RoleAdmin, KeyHash: "hash-3"}); err != nil {
+		t.Fatalf("CreateAPIKey after revoke: %v", err)
+	}
+
+	list, err := keys.ListAPIKeys(ctx)
+	if err != nil {
+		t.Fatalf("ListAPIKeys: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != id || list[0].RevokedAt == nil || list[1].RevokedAt != nil || list[1].Role != models.RoleAdmin {
+		t.Fatalf("ListAPIKeys: got %+v", list)
+	}
+	if list[0].LastUsedAt == nil || !list[0].LastUsedAt.Equal(usedAt) {
+		t.Fatalf("ListAPIKeys: got last used at %v, want %v", list[0].LastUsedAt, usedAt)
+	}
+}
+
+func testEnrichmentQuota(t *testing.T, p storage.Provider) {
+	store, ok := p.(quota.Store)
+	if !ok {
+		t.Skip("storage does not track enrichment quotas")
+	}
+
+	ctx := context.Background()
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	consume := func(client string, day time.Time, n int, wantUsed int, wantErr error) {
+		t.Helper()
+
+		used, err := store.ConsumeEnrichmentQuota(ctx, client, day, n, 5)
+		if !errors.Is(err, wantErr) || used != wantUsed {
+			t.Fatalf("ConsumeEnrichmentQuota(%s, %d): got %d, %v, want %d, %v", client, n, used, err, wantUsed, wantErr)
+		}
+	}
+
+	consume("api_key:a", day, 3, 3, nil)
+	consume("api_key:a", day, 2, 5, nil)
+	// Превышение ничего не списывает и сообщает текущий расход
+	consume("api_key:a", day, 1, 5, storage.ErrQuotaExceeded)
+	// Отдельные счетчики по клиентам и по суткам
+	consume("api_key:b", day, 5, 5, nil)
+	consume("api_key:a", day.AddDate(0, 0, 1), 4, 4, nil)
+	// Запрос больше всей квоты не проходит и для нового клиента
+	consume("api_key:c", day, 6, 0, storage.ErrQuotaExceeded)
+	consume("api_key:c", day, 1, 1, nil)
+	// Возврат уменьшает расход, но не ниже нуля, и только в своих сутках
+	if err := store.RefundEnrichmentQuota(ctx, "api_key:a", day, 2); err != nil {
+		t.Fatalf("RefundEnrichmentQuota: %v", err)
+	}
+	consume("api_key:a", day, 2, 5, nil)
+	if err := store.RefundEnrichmentQuota(ctx, "api_key:b", day, 10); err != nil {
+		t.Fatalf("RefundEnrichmentQuota: %v", err)
+	}
+	consume("api_key:b", day, 5, 5, nil)
+	if err := store.RefundEnrichmentQuota(ctx, "api_key:unknown", day, 1); err != nil {
+		t.Fatalf("RefundEnrichmentQuota of unknown client: %v", err)
+	}
+	consume("api_key:unknown", day, 5, 5, nil)
+	consume("api_key:a", day.AddDate(0, 0, 1), 1, 5, nil)
+
+	// Субъект JWT может быть сколь угодно длинным
+	long := "jwt:" + strings.Repeat("s", 1000)
+	consume(long, day, 2, 2, nil)
+	consume(long, day, 4, 2, storage.ErrQuotaExceeded)
+}
+
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
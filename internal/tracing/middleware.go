@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+const instrumentation = "github.com/sol1corejz/enricher/internal/tracing"
+
+// Middleware открывает серверный спан на каждый запрос, продолжая трассировку из заголовка
+// traceparent, и кладет его в UserContext, откуда его подхватывают сервис и хранилище.
+// Имя спана - метод и шаблон маршрута (GET /users/:id)
+func Middleware() fiber.Handler {
+	tracer := otel.Tracer(instrumentation)
+
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{c})
+
+		// Строки fiber ссылаются на переиспользуемые буферы запроса, а спан может экспортироваться позже
+		method := utils.CopyString(c.Method())
+
+		ctx, span := tracer.Start(ctx, method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.URLPath(utils.CopyString(c.Path())),
+			),
+		)
+		defer span.End()
+
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		route := utils.CopyString(c.Route().Path)
+		if err != nil {
+			// Запрос не попал ни в один маршрут: c.Route() тогда указывает на промежуточный обработчик
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusNotFound &&
+				strings.HasPrefix(fiberErr.Message, "Cannot ") {
+				route = ""
+			}
+
+			// Отдаем ошибку обработчику ошибок fiber сейчас, чтобы записать итоговый код ответа
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+			span.RecordError(err)
+			err = nil
+		}
+
+		status := c.Response().StatusCode()
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if route != "" {
+			span.SetName(method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, utils.StatusMessage(status))
+		}
+
+		return err
+	}
+}
+
+// headerCarrier дает пропагатору читать заголовки запроса fiber
+type headerCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string {
+	return h.c.Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.c.Request().Header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	headers := h.c.GetReqHeaders()
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_users_primary_country;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS primary_country,
+    DROP COLUMN IF EXISTS primary_country_probability;
+
+DROP TABLE IF EXISTS countries;
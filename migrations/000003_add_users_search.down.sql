@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_full_name_trgm;
+DROP INDEX IF EXISTS idx_users_search_vector;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS search_vector,
+    DROP COLUMN IF EXISTS full_name;
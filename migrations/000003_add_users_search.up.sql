@@ -0,0 +1,13 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE users
+    ADD COLUMN full_name TEXT GENERATED ALWAYS AS (
+        name || ' ' || surname ||
+        CASE WHEN coalesce(patronymic, '') = '' THEN '' ELSE ' ' || patronymic END
+    ) STORED,
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple', name || ' ' || surname || ' ' || coalesce(patronymic, ''))
+    ) STORED;
+
+CREATE INDEX idx_users_search_vector ON users USING GIN (search_vector);
+CREATE INDEX idx_users_full_name_trgm ON users USING GIN (full_name gin_trgm_ops);
@@ -0,0 +1,20 @@
+CREATE TABLE imports (
+    id          BIGSERIAL PRIMARY KEY,
+    status      VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    format      VARCHAR(16) NOT NULL,
+    total       INTEGER     NOT NULL DEFAULT 0,
+    processed   INTEGER     NOT NULL DEFAULT 0,
+    succeeded   INTEGER     NOT NULL DEFAULT 0,
+    failed      INTEGER     NOT NULL DEFAULT 0,
+    error       TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE TABLE import_errors (
+    import_id  BIGINT  NOT NULL REFERENCES imports (id) ON DELETE CASCADE,
+    row_number INTEGER NOT NULL,
+    error      TEXT    NOT NULL,
+    PRIMARY KEY (import_id, row_number)
+);
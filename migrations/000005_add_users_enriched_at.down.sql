@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_enriched_at;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS enriched_at;
@@ -0,0 +1,5 @@
+-- Для существующих строк время обогащения неизвестно, они считаются обогащенными в момент миграции
+ALTER TABLE users
+    ADD COLUMN enriched_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX idx_users_enriched_at ON users (enriched_at);
@@ -0,0 +1,7 @@
+-- Мягко удаленные строки при откате удаляются окончательно
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deleted_at;
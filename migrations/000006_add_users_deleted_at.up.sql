@@ -0,0 +1,5 @@
+-- Мягкое удаление: строка остается в таблице до очистки по сроку хранения
+ALTER TABLE users
+    ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,14 @@
+-- Журнал изменений пользователей. Внешнего ключа нет, чтобы история переживала
+-- окончательное удаление пользователя
+CREATE TABLE user_audit (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT      NOT NULL,
+    action     VARCHAR(16) NOT NULL CHECK (action IN ('create', 'edit', 'delete', 'restore', 're_enrich')),
+    before     JSONB,
+    after      JSONB,
+    actor      TEXT,
+    request_id TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_user_audit_user_id ON user_audit (user_id, id);
@@ -0,0 +1,39 @@
+-- Версии пользователей: каждая строка - состояние пользователя в интервале [valid_from, valid_to).
+-- Колонки повторяют users (id - идентификатор пользователя), поэтому к таблице применимы те же
+-- условия фильтрации. Текущая версия имеет valid_to IS NULL
+CREATE TABLE users_history (
+    version_id                  BIGSERIAL PRIMARY KEY,
+    id                          BIGINT       NOT NULL,
+    name                        VARCHAR(255) NOT NULL,
+    surname                     VARCHAR(255) NOT NULL,
+    patronymic                  VARCHAR(255),
+    age                         INTEGER      NOT NULL,
+    sex                         VARCHAR(10)  NOT NULL,
+    country                     JSONB        NOT NULL,
+    primary_country             CHAR(2),
+    primary_country_probability DOUBLE PRECISION,
+    enriched_at                 TIMESTAMPTZ  NOT NULL,
+    deleted_at                  TIMESTAMPTZ,
+    full_name                   TEXT GENERATED ALWAYS AS (
+        name || ' ' || surname ||
+        CASE WHEN coalesce(patronymic, '') = '' THEN '' ELSE ' ' || patronymic END
+    ) STORED,
+    search_vector               TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple', name || ' ' || surname || ' ' || coalesce(patronymic, ''))
+    ) STORED,
+    valid_from                  TIMESTAMPTZ  NOT NULL,
+    valid_to                    TIMESTAMPTZ,
+    CHECK (valid_to IS NULL OR valid_to >= valid_from)
+);
+
+CREATE INDEX idx_users_history_id_valid ON users_history (id, valid_from, valid_to);
+CREATE INDEX idx_users_history_valid ON users_history (valid_from, valid_to);
+CREATE UNIQUE INDEX idx_users_history_current ON users_history (id) WHERE valid_to IS NULL;
+
+-- Прошлые состояния существующих пользователей неизвестны: первая версия начинается
+-- с момента последнего обогащения
+INSERT INTO users_history (id, name, surname, patronymic, age, sex, country,
+                           primary_country, primary_country_probability, enriched_at, deleted_at, valid_from)
+SELECT id, name, surname, patronymic, age, sex, country,
+       primary_country, primary_country_probability, enriched_at, deleted_at, enriched_at
+FROM users;
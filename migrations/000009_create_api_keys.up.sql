@@ -0,0 +1,14 @@
+-- Ключи API для аутентификации. Сам ключ показывается один раз при создании, хранится
+-- только его SHA-256 (key_hash). prefix - начало ключа, по нему ключ можно узнать в списке.
+-- Имя уникально среди действующих ключей, имя отозванного ключа можно использовать снова
+CREATE TABLE api_keys (
+    id           BIGSERIAL PRIMARY KEY,
+    name         VARCHAR(255) NOT NULL,
+    prefix       VARCHAR(32)  NOT NULL,
+    key_hash     CHAR(64)     NOT NULL UNIQUE,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_api_keys_name_active ON api_keys (name) WHERE revoked_at IS NULL;
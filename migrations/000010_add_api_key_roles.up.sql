@@ -0,0 +1,10 @@
+-- Роль ключа API: reader - только чтение, editor - еще и добавление и изменение,
+-- admin - все, включая удаление. Ключи, выданные до появления ролей, имели полный доступ
+-- и получают admin, чтобы обновление не отобрало доступ у работающих клиентов; для новых
+-- ключей роль задается явно
+ALTER TABLE api_keys
+    ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'admin'
+        CHECK (role IN ('reader', 'editor', 'admin'));
+
+ALTER TABLE api_keys
+    ALTER COLUMN role DROP DEFAULT;
@@ -0,0 +1,9 @@
+-- Расход суточной квоты обогащения по клиентам (api_key:<имя>, jwt:<sub> или ip:<адрес>;
+-- длина sub не ограничена, поэтому TEXT, как user_audit.actor).
+-- day - сутки по UTC, used - сколько имен отправлено на обогащение за эти сутки
+CREATE TABLE enrichment_usage (
+    client TEXT    NOT NULL,
+    day    DATE    NOT NULL,
+    used   INTEGER NOT NULL CHECK (used >= 0),
+    PRIMARY KEY (client, day)
+);
@@ -0,0 +1,15 @@
+// Package migrations встраивает SQL-миграции в бинарники, чтобы мигратор
+// не зависел от текущей директории
+package migrations
+
+import "embed"
+
+// FS - миграции Postgres
+//
+//go:embed *.sql
+var FS embed.FS
+
+// SQLite - отдельный набор миграций для SQLite в директории sqlite
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
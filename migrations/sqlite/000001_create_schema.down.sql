@@ -0,0 +1,6 @@
+DROP TABLE users_history;
+DROP TABLE user_audit;
+DROP TABLE import_errors;
+DROP TABLE imports;
+DROP TABLE users;
+DROP TABLE countries;
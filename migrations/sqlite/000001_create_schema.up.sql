@@ -0,0 +1,346 @@
+-- Схема для SQLite собрана в одну миграцию и соответствует миграциям Postgres до 000008.
+-- JSON хранится текстом, время - текстом в UTC с фиксированной точностью (см. storage/sqlite),
+-- поэтому сравнение строк совпадает с порядком моментов времени
+CREATE TABLE countries (
+    code TEXT PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+INSERT INTO countries (code, name) VALUES
+    ('AD', 'Andorra'),
+    ('AE', 'United Arab Emirates'),
+    ('AF', 'Afghanistan'),
+    ('AG', 'Antigua and Barbuda'),
+    ('AI', 'Anguilla'),
+    ('AL', 'Albania'),
+    ('AM', 'Armenia'),
+    ('AO', 'Angola'),
+    ('AQ', 'Antarctica'),
+    ('AR', 'Argentina'),
+    ('AS', 'American Samoa'),
+    ('AT', 'Austria'),
+    ('AU', 'Australia'),
+    ('AW', 'Aruba'),
+    ('AX', 'Åland Islands'),
+    ('AZ', 'Azerbaijan'),
+    ('BA', 'Bosnia and Herzegovina'),
+    ('BB', 'Barbados'),
+    ('BD', 'Bangladesh'),
+    ('BE', 'Belgium'),
+    ('BF', 'Burkina Faso'),
+    ('BG', 'Bulgaria'),
+    ('BH', 'Bahrain'),
+    ('BI', 'Burundi'),
+    ('BJ', 'Benin'),
+    ('BL', 'Saint Barthélemy'),
+    ('BM', 'Bermuda'),
+    ('BN', 'Brunei Darussalam'),
+    ('BO', 'Bolivia, Plurinational State of'),
+    ('BQ', 'Bonaire, Sint Eustatius and Saba'),
+    ('BR', 'Brazil'),
+    ('BS', 'Bahamas'),
+    ('BT', 'Bhutan'),
+    ('BV', 'Bouvet Island'),
+    ('BW', 'Botswana'),
+    ('BY', 'Belarus'),
+    ('BZ', 'Belize'),
+    ('CA', 'Canada'),
+    ('CC', 'Cocos (Keeling) Islands'),
+    ('CD', 'Congo, Democratic Republic of the'),
+    ('CF', 'Central African Republic'),
+    ('CG', 'Congo'),
+    ('CH', 'Switzerland'),
+    ('CI', 'Côte d''Ivoire'),
+    ('CK', 'Cook Islands'),
+    ('CL', 'Chile'),
+    ('CM', 'Cameroon'),
+    ('CN', 'China'),
+    ('CO', 'Colombia'),
+    ('CR', 'Costa Rica'),
+    ('CU', 'Cuba'),
+    ('CV', 'Cabo Verde'),
+    ('CW', 'Curaçao'),
+    ('CX', 'Christmas Island'),
+    ('CY', 'Cyprus'),
+    ('CZ', 'Czechia'),
+    ('DE', 'Germany'),
+    ('DJ', 'Djibouti'),
+    ('DK', 'Denmark'),
+    ('DM', 'Dominica'),
+    ('DO', 'Dominican Republic'),
+    ('DZ', 'Algeria'),
+    ('EC', 'Ecuador'),
+    ('EE', 'Estonia'),
+    ('EG', 'Egypt'),
+    ('EH', 'Western Sahara'),
+    ('ER', 'Eritrea'),
+    ('ES', 'Spain'),
+    ('ET', 'Ethiopia'),
+    ('FI', 'Finland'),
+    ('FJ', 'Fiji'),
+    ('FK', 'Falkland Islands (Malvinas)'),
+    ('FM', 'Micronesia, Federated States of'),
+    ('FO', 'Faroe Islands'),
+    ('FR', 'France'),
+    ('GA', 'Gabon'),
+    ('GB', 'United Kingdom of Great Britain and Northern Ireland'),
+    ('GD', 'Grenada'),
+    ('GE', 'Georgia'),
+    ('GF', 'French Guiana'),
+    ('GG', 'Guernsey'),
+    ('GH', 'Ghana'),
+    ('GI', 'Gibraltar'),
+    ('GL', 'Greenland'),
+    ('GM', 'Gambia'),
+    ('GN', 'Guinea'),
+    ('GP', 'Guadeloupe'),
+    ('GQ', 'Equatorial Guinea'),
+    ('GR', 'Greece'),
+    ('GS', 'South Georgia and the South Sandwich Islands'),
+    ('GT', 'Guatemala'),
+    ('GU', 'Guam'),
+    ('GW', 'Guinea-Bissau'),
+    ('GY', 'Guyana'),
+    ('HK', 'Hong Kong'),
+    ('HM', 'Heard Island and McDonald Islands'),
+    ('HN', 'Honduras'),
+    ('HR', 'Croatia'),
+    ('HT', 'Haiti'),
+    ('HU', 'Hungary'),
+    ('ID', 'Indonesia'),
+    ('IE', 'Ireland'),
+    ('IL', 'Israel'),
+    ('IM', 'Isle of Man'),
+    ('IN', 'India'),
+    ('IO', 'British Indian Ocean Territory'),
+    ('IQ', 'Iraq'),
+    ('IR', 'Iran, Islamic Republic of'),
+    ('IS', 'Iceland'),
+    ('IT', 'Italy'),
+    ('JE', 'Jersey'),
+    ('JM', 'Jamaica'),
+    ('JO', 'Jordan'),
+    ('JP', 'Japan'),
+    ('KE', 'Kenya'),
+    ('KG', 'Kyrgyzstan'),
+    ('KH', 'Cambodia'),
+    ('KI', 'Kiribati'),
+    ('KM', 'Comoros'),
+    ('KN', 'Saint Kitts and Nevis'),
+    ('KP', 'Korea, Democratic People''s Republic of'),
+    ('KR', 'Korea, Republic of'),
+    ('KW', 'Kuwait'),
+    ('KY', 'Cayman Islands'),
+    ('KZ', 'Kazakhstan'),
+    ('LA', 'Lao People''s Democratic Republic'),
+    ('LB', 'Lebanon'),
+    ('LC', 'Saint Lucia'),
+    ('LI', 'Liechtenstein'),
+    ('LK', 'Sri Lanka'),
+    ('LR', 'Liberia'),
+    ('LS', 'Lesotho'),
+    ('LT', 'Lithuania'),
+    ('LU', 'Luxembourg'),
+    ('LV', 'Latvia'),
+    ('LY', 'Libya'),
+    ('MA', 'Morocco'),
+    ('MC', 'Monaco'),
+    ('MD', 'Moldova, Republic of'),
+    ('ME', 'Montenegro'),
+    ('MF', 'Saint Martin (French part)'),
+    ('MG', 'Madagascar'),
+    ('MH', 'Marshall Islands'),
+    ('MK', 'North Macedonia'),
+    ('ML', 'Mali'),
+    ('MM', 'Myanmar'),
+    ('MN', 'Mongolia'),
+    ('MO', 'Macao'),
+    ('MP', 'Northern Mariana Islands'),
+    ('MQ', 'Martinique'),
+    ('MR', 'Mauritania'),
+    ('MS', 'Montserrat'),
+    ('MT', 'Malta'),
+    ('MU', 'Mauritius'),
+    ('MV', 'Maldives'),
+    ('MW', 'Malawi'),
+    ('MX', 'Mexico'),
+    ('MY', 'Malaysia'),
+    ('MZ', 'Mozambique'),
+    ('NA', 'Namibia'),
+    ('NC', 'New Caledonia'),
+    ('NE', 'Niger'),
+    ('NF', 'Norfolk Island'),
+    ('NG', 'Nigeria'),
+    ('NI', 'Nicaragua'),
+    ('NL', 'Netherlands, Kingdom of the'),
+    ('NO', 'Norway'),
+    ('NP', 'Nepal'),
+    ('NR', 'Nauru'),
+    ('NU', 'Niue'),
+    ('NZ', 'New Zealand'),
+    ('OM', 'Oman'),
+    ('PA', 'Panama'),
+    ('PE', 'Peru'),
+    ('PF', 'French Polynesia'),
+    ('PG', 'Papua New Guinea'),
+    ('PH', 'Philippines'),
+    ('PK', 'Pakistan'),
+    ('PL', 'Poland'),
+    ('PM', 'Saint Pierre and Miquelon'),
+    ('PN', 'Pitcairn'),
+    ('PR', 'Puerto Rico'),
+    ('PS', 'Palestine, State of'),
+    ('PT', 'Portugal'),
+    ('PW', 'Palau'),
+    ('PY', 'Paraguay'),
+    ('QA', 'Qatar'),
+    ('RE', 'Réunion'),
+    ('RO', 'Romania'),
+    ('RS', 'Serbia'),
+    ('RU', 'Russian Federation'),
+    ('RW', 'Rwanda'),
+    ('SA', 'Saudi Arabia'),
+    ('SB', 'Solomon Islands'),
+    ('SC', 'Seychelles'),
+    ('SD', 'Sudan'),
+    ('SE', 'Sweden'),
+    ('SG', 'Singapore'),
+    ('SH', 'Saint Helena, Ascension and Tristan da Cunha'),
+    ('SI', 'Slovenia'),
+    ('SJ', 'Svalbard and Jan Mayen'),
+    ('SK', 'Slovakia'),
+    ('SL', 'Sierra Leone'),
+    ('SM', 'San Marino'),
+    ('SN', 'Senegal'),
+    ('SO', 'Somalia'),
+    ('SR', 'Suriname'),
+    ('SS', 'South Sudan'),
+    ('ST', 'Sao Tome and Principe'),
+    ('SV', 'El Salvador'),
+    ('SX', 'Sint Maarten (Dutch part)'),
+    ('SY', 'Syrian Arab Republic'),
+    ('SZ', 'Eswatini'),
+    ('TC', 'Turks and Caicos Islands'),
+    ('TD', 'Chad'),
+    ('TF', 'French Southern Territories'),
+    ('TG', 'Togo'),
+    ('TH', 'Thailand'),
+    ('TJ', 'Tajikistan'),
+    ('TK', 'Tokelau'),
+    ('TL', 'Timor-Leste'),
+    ('TM', 'Turkmenistan'),
+    ('TN', 'Tunisia'),
+    ('TO', 'Tonga'),
+    ('TR', 'Türkiye'),
+    ('TT', 'Trinidad and Tobago'),
+    ('TV', 'Tuvalu'),
+    ('TW', 'Taiwan, Province of China'),
+    ('TZ', 'Tanzania, United Republic of'),
+    ('UA', 'Ukraine'),
+    ('UG', 'Uganda'),
+    ('UM', 'United States Minor Outlying Islands'),
+    ('US', 'United States of America'),
+    ('UY', 'Uruguay'),
+    ('UZ', 'Uzbekistan'),
+    ('VA', 'Holy See'),
+    ('VC', 'Saint Vincent and the Grenadines'),
+    ('VE', 'Venezuela, Bolivarian Republic of'),
+    ('VG', 'Virgin Islands (British)'),
+    ('VI', 'Virgin Islands (U.S.)'),
+    ('VN', 'Viet Nam'),
+    ('VU', 'Vanuatu'),
+    ('WF', 'Wallis and Futuna'),
+    ('WS', 'Samoa'),
+    ('XK', 'Kosovo'),
+    ('YE', 'Yemen'),
+    ('YT', 'Mayotte'),
+    ('ZA', 'South Africa'),
+    ('ZM', 'Zambia'),
+    ('ZW', 'Zimbabwe');
+
+-- AUTOINCREMENT не дает переиспользовать идентификаторы окончательно удаленных пользователей,
+-- как и последовательность в Postgres
+CREATE TABLE users (
+    id                          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name                        TEXT    NOT NULL,
+    surname                     TEXT    NOT NULL,
+    patronymic                  TEXT,
+    age                         INTEGER NOT NULL,
+    sex                         TEXT    NOT NULL CHECK (sex IN ('male', 'female')),
+    country                     TEXT    NOT NULL CHECK (json_valid(country)),
+    primary_country             TEXT,
+    primary_country_probability REAL,
+    enriched_at                 TEXT    NOT NULL,
+    deleted_at                  TEXT,
+    full_name                   TEXT GENERATED ALWAYS AS (
+        name || ' ' || surname ||
+        CASE WHEN coalesce(patronymic, '') = '' THEN '' ELSE ' ' || patronymic END
+    ) STORED
+);
+
+CREATE INDEX idx_users_primary_country ON users (primary_country);
+CREATE INDEX idx_users_enriched_at ON users (enriched_at);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE imports (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    status      TEXT    NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    format      TEXT    NOT NULL,
+    total       INTEGER NOT NULL DEFAULT 0,
+    processed   INTEGER NOT NULL DEFAULT 0,
+    succeeded   INTEGER NOT NULL DEFAULT 0,
+    failed      INTEGER NOT NULL DEFAULT 0,
+    error       TEXT,
+    created_at  TEXT    NOT NULL,
+    updated_at  TEXT    NOT NULL,
+    finished_at TEXT
+);
+
+CREATE TABLE import_errors (
+    import_id  INTEGER NOT NULL REFERENCES imports (id) ON DELETE CASCADE,
+    row_number INTEGER NOT NULL,
+    error      TEXT    NOT NULL,
+    PRIMARY KEY (import_id, row_number)
+);
+
+-- Журнал изменений пользователей. Внешнего ключа нет, чтобы история переживала
+-- окончательное удаление пользователя
+CREATE TABLE user_audit (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER NOT NULL,
+    action     TEXT    NOT NULL CHECK (action IN ('create', 'edit', 'delete', 'restore', 're_enrich')),
+    before     TEXT,
+    after      TEXT,
+    actor      TEXT,
+    request_id TEXT,
+    created_at TEXT    NOT NULL
+);
+
+CREATE INDEX idx_user_audit_user_id ON user_audit (user_id, id);
+
+-- Версии пользователей в интервалах [valid_from, valid_to), колонки повторяют users
+CREATE TABLE users_history (
+    version_id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    id                          INTEGER NOT NULL,
+    name                        TEXT    NOT NULL,
+    surname                     TEXT    NOT NULL,
+    patronymic                  TEXT,
+    age                         INTEGER NOT NULL,
+    sex                         TEXT    NOT NULL,
+    country                     TEXT    NOT NULL,
+    primary_country             TEXT,
+    primary_country_probability REAL,
+    enriched_at                 TEXT    NOT NULL,
+    deleted_at                  TEXT,
+    full_name                   TEXT GENERATED ALWAYS AS (
+        name || ' ' || surname ||
+        CASE WHEN coalesce(patronymic, '') = '' THEN '' ELSE ' ' || patronymic END
+    ) STORED,
+    valid_from                  TEXT    NOT NULL,
+    valid_to                    TEXT,
+    CHECK (valid_to IS NULL OR valid_to >= valid_from)
+);
+
+CREATE INDEX idx_users_history_id_valid ON users_history (id, valid_from, valid_to);
+CREATE INDEX idx_users_history_valid ON users_history (valid_from, valid_to);
+CREATE UNIQUE INDEX idx_users_history_current ON users_history (id) WHERE valid_to IS NULL;
@@ -0,0 +1,13 @@
+-- Ключи API для аутентификации: хранится только SHA-256 ключа (key_hash).
+-- Имя уникально среди действующих ключей
+CREATE TABLE api_keys (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL,
+    key_hash     TEXT NOT NULL UNIQUE,
+    created_at   TEXT NOT NULL,
+    last_used_at TEXT,
+    revoked_at   TEXT
+);
+
+CREATE UNIQUE INDEX idx_api_keys_name_active ON api_keys (name) WHERE revoked_at IS NULL;
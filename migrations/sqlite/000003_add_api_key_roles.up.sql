@@ -0,0 +1,2 @@
+-- Роль ключа API (reader, editor или admin). Ключи, выданные до появления ролей, получают admin
+ALTER TABLE api_keys ADD COLUMN role TEXT NOT NULL DEFAULT 'admin' CHECK (role IN ('reader', 'editor', 'admin'));
@@ -0,0 +1 @@
+DROP TABLE enrichment_usage;
@@ -0,0 +1,7 @@
+-- Расход суточной квоты обогащения по клиентам; day - дата по UTC (YYYY-MM-DD)
+CREATE TABLE enrichment_usage (
+    client TEXT    NOT NULL,
+    day    TEXT    NOT NULL,
+    used   INTEGER NOT NULL CHECK (used >= 0),
+    PRIMARY KEY (client, day)
+);